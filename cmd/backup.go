@@ -2,22 +2,30 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net"
+	"io"
+	"io/ioutil"
 	"os"
 	"path"
-	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-co-op/gocron"
-	"github.com/james4k/rcon"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 
 	"github.com/saulmaldonado/agones-mc/internal/config"
+	"github.com/saulmaldonado/agones-mc/internal/version"
 	"github.com/saulmaldonado/agones-mc/pkg/backup"
-	"github.com/saulmaldonado/agones-mc/pkg/backup/google"
+	"github.com/saulmaldonado/agones-mc/pkg/backup/crypt"
+	"github.com/saulmaldonado/agones-mc/pkg/backup/incremental"
+	"github.com/saulmaldonado/agones-mc/pkg/notify"
+	"github.com/saulmaldonado/agones-mc/pkg/ping"
+	"github.com/saulmaldonado/agones-mc/pkg/save"
 	"github.com/saulmaldonado/agones-mc/pkg/signal"
+	"github.com/saulmaldonado/agones-mc/pkg/world"
 )
 
 var backupCmd = cobra.Command{
@@ -27,34 +35,93 @@ var backupCmd = cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		cfg := config.NewBackupConfig()
 
+		if err := checkReplicas(cfg); err != nil {
+			logger.Fatal("invalid backup replicas", zap.Error(err))
+		}
+
 		dur := cfg.GetInitialDelay()
 		if dur > 0 {
 			logger.Info("initial delay...", zap.Duration("duration", dur))
 			time.Sleep(dur)
 		}
 
-		if cron := cfg.GetBackupCron(); cron != "" {
+		cron := cfg.GetBackupCron()
+		forceCron := cfg.GetBackupForceCron()
+
+		if cron != "" || forceCron != "" || cfg.GetBackupOnRequest() || cfg.GetBackupOnShutdown() {
 			stop := signal.SetupSignalHandler(logger)
 
 			s := gocron.NewScheduler(time.UTC)
+			done := make(chan struct{})
+
+			if cron != "" {
+				s.Cron(cron).Do(func() { runScheduledBackup(cfg, done, false) })
+			}
 
-			s.Cron(cron).Do(func() {
-				if err := RunBackup(cfg); err != nil {
-					logger.Error("backup failed", zap.String("serverName", cfg.GetPodName()), zap.Error(err))
-				} else {
-					logger.Info("backup successful", zap.String("serverName", cfg.GetPodName()))
+			// backups of the force schedule are taken even if the world has not changed
+			if forceCron != "" {
+				s.Cron(forceCron).Do(func() { runScheduledBackup(cfg, done, true) })
+			}
+
+			if cron != "" || forceCron != "" {
+				s.StartAsync()
+			}
+
+			// nil unless BACKUP_ON_SHUTDOWN is set
+			var shutdown <-chan struct{}
+
+			if cfg.GetBackupOnRequest() || cfg.GetBackupOnShutdown() {
+				watcher, err := watchGameServer(cfg, done)
+				if err != nil {
+					logger.Fatal("error watching GameServer", zap.Error(err))
 				}
-			})
 
-			s.StartAsync()
-			<-stop // SIGTERM
+				if cfg.GetBackupOnShutdown() {
+					shutdown = watcher.Shutdown()
+				}
+			}
+
+			shuttingDown := false
+			select {
+			case <-stop: // SIGTERM
+				logger.Info("terminating. taking final backup", zap.String("serverName", cfg.GetPodName()))
+			case <-shutdown:
+				shuttingDown = true
+				logger.Info("GameServer shutting down. taking final backup", zap.String("serverName", cfg.GetPodName()))
+			}
+
+			close(done)
 			s.Clear()
 			s.Stop()
 			// attempt a final backup before terminating
+			name, err := runFinalBackup(cfg)
+			if errors.Is(err, errUnchanged) {
+				err = nil
+			} else if err != nil {
+				logger.Error("final backup failed", zap.String("serverName", cfg.GetPodName()), zap.Error(err))
+			} else {
+				logger.Info("final backup successful", zap.String("serverName", cfg.GetPodName()), zap.String("backupName", name))
+			}
+
+			// exiting before the pod is terminated would restart the container and back up again
+			if shuttingDown {
+				<-stop
+			}
+
+			if err != nil {
+				logger.Sync()
+				os.Exit(1)
+			}
+			return
 		}
 
-		if err := RunBackup(cfg); err != nil {
-			logger.Fatal("backup failed", zap.String("serverName", cfg.GetPodName()))
+		_, err := runLeasedBackup(context.Background(), cfg, false)
+		if errors.Is(err, errUnchanged) {
+			return
+		}
+
+		if err != nil {
+			logger.Fatal("backup failed", zap.String("serverName", cfg.GetPodName()), zap.Error(err))
 		}
 
 		logger.Info("backup successful", zap.String("serverName", cfg.GetPodName()))
@@ -66,85 +133,721 @@ func init() {
 	RootCmd.AddCommand(&backupCmd)
 }
 
-func RunBackup(cfg config.BackupConfig) error {
-	// Run save-all on minecraft server to force save-all before backup
-	if err := saveAll(cfg.GetHost(), cfg.GetPort(), cfg.GetRCONPassword()); err != nil {
-		logger.Warn("error saving world. skipping save-all", zap.Error(err))
+// Backs up the server on its schedule once its BACKUP_JITTER delay has passed. Backups that are not forced
+// are skipped if the world has not changed
+func runScheduledBackup(cfg config.BackupConfig, done <-chan struct{}, force bool) {
+	if !waitJitter(cfg, done) {
+		return
+	}
+
+	_, err := runLeasedBackup(context.Background(), cfg, force)
+	if errors.Is(err, errUnchanged) {
+		return
+	}
+
+	if err != nil {
+		logger.Error("backup failed", zap.String("serverName", cfg.GetPodName()), zap.Error(err))
+	} else {
+		logger.Info("backup successful", zap.String("serverName", cfg.GetPodName()))
+	}
+}
+
+// Scheduled and final backups must not overlap since each one pauses and resumes world saving
+var backupMu sync.Mutex
+
+// Backs up the server within FINAL_BACKUP_TIMEOUT so it finishes before the pod's terminationGracePeriod ends.
+// The final backup does not wait for a backup lease since the server's data would be lost if it missed the deadline
+func runFinalBackup(cfg config.BackupConfig) (string, error) {
+	ctx := context.Background()
+
+	if timeout := cfg.GetFinalBackupTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// the final backup is the last chance to back up the world, so it is taken even if the world looks unchanged
+	return RunBackup(ctx, cfg, true)
+}
+
+// Backs up the server and returns the name of the backup. Storage operations are cancelled with ctx.
+// Unless force is set, returns errUnchanged without backing up if BACKUP_SKIP_UNCHANGED is set and the
+// world has not changed. The outcome of backups that are taken is sent to the configured webhooks
+func RunBackup(ctx context.Context, cfg config.BackupConfig, force bool) (string, error) {
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
+	start := time.Now()
+	manifest, err := runBackup(ctx, cfg, force)
+	if errors.Is(err, errUnchanged) {
+		return "", err
+	}
+
+	event := notify.Event{Type: notify.BackupSucceeded, Server: cfg.GetPodName(), Fleet: cfg.GetFleetName(), Duration: time.Since(start)}
+	if err != nil {
+		event.Type = notify.BackupFailed
+		event.Error = err.Error()
+		notifyEvent(cfg, event)
+		return "", err
 	}
 
-	// Authenticate and create Google Cloud Storage client
-	cloudStorageClient, err := google.New(context.Background(), cfg.GetBucketName())
+	event.Backup = manifest.Name
+	event.Size = manifest.Size
+	notifyEvent(cfg, event)
+
+	return manifest.Name, nil
+}
+
+func runBackup(ctx context.Context, cfg config.BackupConfig, force bool) (*backup.Manifest, error) {
+	// Authenticate and create storage client for the configured provider
+	storageClient, err := newBackupClient(ctx, cfg)
 	if err != nil {
 		logger.Error("error connecting to bucket", zap.Error(err))
-		return err
+		return nil, err
+	}
+
+	defer storageClient.Close()
+	defer logRetryStats(storageClient)
+
+	worlds, err := serverWorlds(cfg)
+	if err != nil {
+		logger.Error("error listing worlds", zap.Error(err))
+		return nil, err
+	}
+
+	contents, err := backupContents(cfg, worlds)
+	if err != nil {
+		logger.Error("invalid backup contents", zap.Error(err))
+		return nil, err
+	}
+
+	// the last backup is looked up before saving is paused so the pause is not longer than it needs to be
+	var previous, previousBackup string
+	if cfg.GetBackupSkipUnchanged() && !force {
+		previous, previousBackup = previousFingerprint(ctx, cfg, storageClient)
+	}
+
+	// the server's worlds. Bedrock worlds are replaced below with copies, which are not fingerprinted
+	live := append([]backup.World(nil), worlds...)
+	var fingerprint string
+
+	// the world is fingerprinted once it is saved, and the backup is abandoned before anything is read if it is unchanged
+	onPaused := func() error {
+		fingerprint = recordFingerprint(cfg, contents, live)
+		if unchanged(previous, fingerprint) {
+			logger.Info("world has not changed since the last backup. skipping backup", zap.String("serverName", cfg.GetPodName()), zap.String("lastBackup", previousBackup))
+			return errUnchanged
+		}
+		return nil
+	}
+
+	// Bedrock worlds are backed up from a copy made while saving is held
+	if cfg.GetEdition() == config.BedrockEdition && contents.Select(worldDir(cfg, worlds[0]), true) == backup.Include {
+		staged, cleanup, err := stageBedrockWorld(ctx, cfg)
+		if err != nil {
+			logger.Warn("error copying held world. backing up while the server may be writing to the world", zap.Error(err))
+		} else {
+			defer cleanup()
+			worlds = withWorld(worlds, backup.World{Name: path.Base(staged), Path: staged})
+		}
+	}
+
+	set := selectFiles(cfg, contents, worlds)
+
+	logger.Info("backing up worlds", zap.Strings("worlds", set.names), zap.String("preset", contents.Preset), zap.String("layout", set.layout))
+
+	now := time.Now()
+
+	if cfg.GetBackupMode() == config.IncrementalBackup {
+		if set.layout != backup.WorldsLayout {
+			err := fmt.Errorf("incremental backups only back up worlds. use BACKUP_PRESET=%s without BACKUP_INCLUDE", world.WorldOnly)
+			logger.Error("invalid backup contents", zap.Error(err))
+			return nil, err
+		}
+
+		snapshotName := backup.Name(cfg.GetPodName(), now, incremental.SnapshotSuffix)
+
+		var snapshot *incremental.Snapshot
+		var stats *incremental.Stats
+		err := withWorldsPaused(cfg, set.worlds, onPaused, func(worlds []backup.World) error {
+			var err error
+			// chunks are only reused for half the GC grace period so gc can not delete them during the backup
+			snapshot, stats, err = incremental.UploadWorlds(ctx, storageClient, worlds, cfg.GetGCGracePeriod()/2)
+			return err
+		})
+
+		if errors.Is(err, errUnchanged) {
+			return nil, err
+		}
+
+		// the snapshot is only written once staged worlds are known to be consistent
+		if err == nil {
+			err = incremental.WriteSnapshot(ctx, storageClient, snapshotName, snapshot, stats)
+		}
+
+		if err != nil {
+			logger.Error("error backing up snapshot to bucket", zap.Error(err))
+			return nil, err
+		}
+
+		logger.Info("snapshot uploaded",
+			zap.String("snapshotName", snapshotName),
+			zap.Int("files", stats.Files),
+			zap.Int("chunks", stats.Chunks),
+			zap.Int("uploadedChunks", stats.UploadedChunks),
+			zap.Int64("uploadedBytes", stats.UploadedBytes),
+		)
+
+		manifest := newManifest(cfg, snapshotName, worlds, now)
+		set.describe(manifest)
+		manifest.SHA256 = stats.SnapshotSHA256
+		manifest.Size = stats.SnapshotSize
+		manifest.FileCount = stats.Files
+		manifest.UncompressedSize = stats.Size
+		manifest.Fingerprint = fingerprint
+		writeManifest(ctx, storageClient, manifest)
+		saveState(cfg, manifest)
+
+		applyRetention(ctx, storageClient, cfg)
+		return manifest, nil
 	}
 
-	defer cloudStorageClient.Close()
+	format, err := backup.ParseFormat(cfg.GetBackupFormat())
+	if err != nil {
+		logger.Error("invalid backup format", zap.Error(err))
+		return nil, err
+	}
 
-	backupName := fmt.Sprintf("%s-%v.zip", cfg.GetPodName(), time.Now().Format(time.RFC3339))
+	backupName := backup.Name(cfg.GetPodName(), now, format.Ext())
 
-	var worldPath string
-	if cfg.GetEdition() == config.JavaEdition {
-		worldPath = path.Join(cfg.GetVolume(), "worlds", "Bedrock level")
+	// the digest is computed while the archive is written so the backup is only read once
+	digest := backup.NewDigestWriter()
+	var archiveStats *backup.ArchiveStats
+
+	archive := func(w io.Writer) error {
+		return withWorldsPaused(cfg, set.worlds, onPaused, func(worlds []backup.World) error {
+			var err error
+			archiveStats, err = backup.ArchiveWorlds(worlds, io.MultiWriter(w, digest), format, cfg.GetCompressionLevel())
+			return err
+		})
+	}
+
+	if dir := cfg.GetScratchDir(); dir != "" {
+		err = spoolBackup(ctx, storageClient, backupName, dir, archive)
 	} else {
-		worldPath = path.Join(cfg.GetVolume(), "world")
+		err = backup.Stream(ctx, storageClient, backupName, archive)
+	}
+
+	if errors.Is(err, errUnchanged) {
+		return nil, err
 	}
 
-	// Create zip backup
-	err = backup.Zipit(worldPath, backupName)
 	if err != nil {
-		logger.Error("error creating zip backup", zap.Error(err))
-		return err
+		logger.Error("error backing up to bucket", zap.Error(err))
+		return nil, err
+	}
+
+	manifest := newManifest(cfg, backupName, worlds, now)
+	set.describe(manifest)
+	manifest.Format = string(format)
+	manifest.SHA256 = digest.Sum()
+	manifest.Size = digest.Size()
+	manifest.FileCount = archiveStats.Files
+	manifest.UncompressedSize = archiveStats.UncompressedSize
+	manifest.Fingerprint = fingerprint
+	writeManifest(ctx, storageClient, manifest)
+	saveState(cfg, manifest)
+
+	applyRetention(ctx, storageClient, cfg)
+	return manifest, nil
+}
+
+// Builds the manifest of a backup with the server and world metadata that is available. The server version
+// is read by pinging the server and the world format version from the level.dat of the main world
+func newManifest(cfg config.BackupConfig, name string, worlds []backup.World, created time.Time) *backup.Manifest {
+	manifest := &backup.Manifest{
+		Name:            name,
+		Edition:         string(cfg.GetEdition()),
+		Server:          cfg.GetPodName(),
+		Fleet:           cfg.GetFleetName(),
+		AgonesMcVersion: version.Version,
+		Created:         created.UTC(),
+	}
+
+	pinger := ping.NewPinger(cfg.GetHost(), uint16(cfg.GetPort()), ping.DefaultTimeout, cfg.GetEdition())
+	if info, err := pinger.PingWithTimeout(); err != nil {
+		logger.Warn("error pinging server. server version is not recorded in manifest", zap.Error(err))
+	} else {
+		manifest.ServerVersion = info.Version
+		manifest.Protocol = info.Protocol
+	}
+
+	if level, err := world.ReadLevel(worlds[0].Path, cfg.GetEdition()); err != nil {
+		logger.Warn("error reading level.dat. world version is not recorded in manifest", zap.Error(err))
+	} else {
+		manifest.LevelName = level.Name
+		manifest.DataVersion = level.DataVersion
+		manifest.StorageVersion = level.StorageVersion
+	}
+
+	return manifest
+}
+
+// Returns the server's world directories, starting with its main world. See world.Worlds
+func serverWorlds(cfg config.ServerConfig) ([]backup.World, error) {
+	names, err := world.Worlds(cfg.GetVolume(), cfg.GetEdition(), levelName(cfg))
+	if err != nil {
+		return nil, err
 	}
 
-	file, err := os.Open(backupName)
+	dir := world.Dir(cfg.GetVolume(), cfg.GetEdition())
+
+	worlds := make([]backup.World, len(names))
+	for i, name := range names {
+		worlds[i] = backup.World{Name: name, Path: path.Join(dir, name)}
+	}
+
+	return worlds, nil
+}
+
+// Files of the server selected for backup
+type backupSet struct {
+	layout   string
+	contents *backup.Contents
+	// directories to archive. In the volume layout the last one is the server's data directory
+	// without the worlds archived before it
+	worlds []backup.World
+	// directories of the archived worlds in the archive
+	names []string
+}
+
+// Records the files selected for backup in the manifest
+func (s *backupSet) describe(manifest *backup.Manifest) {
+	manifest.Layout = s.layout
+	manifest.Contents = s.contents
+	manifest.Worlds = s.names
+}
+
+// Returns the files to back up selected by BACKUP_PRESET, BACKUP_INCLUDE and BACKUP_EXCLUDE
+func backupContents(cfg config.BackupConfig, worlds []backup.World) (*backup.Contents, error) {
+	dirs := make([]string, len(worlds))
+	for i, w := range worlds {
+		dirs[i] = worldDir(cfg, w)
+	}
+
+	include, exclude, err := world.Preset(cfg.GetBackupPreset(), cfg.GetEdition(), levelName(cfg), dirs)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := &backup.Contents{
+		Preset:  cfg.GetBackupPreset(),
+		Include: append(include, cfg.GetBackupInclude()...),
+		Exclude: append(exclude, cfg.GetBackupExclude()...),
+	}
+
+	if len(contents.Include) == 0 {
+		return nil, fmt.Errorf("nothing to back up. BACKUP_PRESET is %q and BACKUP_INCLUDE is empty", contents.Preset)
+	}
+
+	return contents, contents.Validate()
+}
+
+// Selects the directories to archive. Backups of only the server's worlds keep the layout of the worlds
+// directory. Other backups are archived relative to the server's data directory. Worlds selected as a whole
+// are archived as their own directories so they replace the server's worlds when the backup is loaded
+func selectFiles(cfg config.BackupConfig, contents *backup.Contents, worlds []backup.World) *backupSet {
+	if contents.Preset == world.WorldOnly && len(cfg.GetBackupInclude()) == 0 {
+		set := &backupSet{layout: backup.WorldsLayout, contents: contents}
+
+		for _, w := range worlds {
+			dir := worldDir(cfg, w)
+			w.Select = func(name string, isDir bool) backup.Selection {
+				return contents.Select(path.Join(path.Dir(dir), name), isDir)
+			}
+
+			set.worlds = append(set.worlds, w)
+			set.names = append(set.names, w.Name)
+		}
+
+		return set
+	}
+
+	set := &backupSet{layout: backup.VolumeLayout, contents: contents}
+
+	for _, w := range worlds {
+		dir := worldDir(cfg, w)
+		if contents.Select(dir, true) != backup.Include {
+			continue
+		}
+
+		set.worlds = append(set.worlds, backup.World{Name: dir, Path: w.Path, Select: contents.Select})
+		set.names = append(set.names, dir)
+	}
+
+	archived := set.names
+	set.worlds = append(set.worlds, backup.World{
+		Path: cfg.GetVolume(),
+		Select: func(name string, isDir bool) backup.Selection {
+			for _, dir := range archived {
+				if name == dir {
+					return backup.Exclude
+				}
+			}
+			return contents.Select(name, isDir)
+		},
+	})
+
+	return set
+}
+
+// Returns the path of the world's directory relative to the server's data directory
+func worldDir(cfg config.ServerConfig, w backup.World) string {
+	if cfg.GetEdition() == config.BedrockEdition {
+		return path.Join("worlds", w.Name)
+	}
+	return w.Name
+}
+
+// Returns LEVEL_NAME, else the level-name in the server's server.properties, else the edition's default world name
+func levelName(cfg config.ServerConfig) string {
+	if name := cfg.GetLevelName(); name != "" {
+		return name
+	}
+
+	name, err := world.LevelName(cfg.GetVolume(), cfg.GetEdition())
+	if err != nil {
+		logger.Warn("error reading server.properties. using the default level name", zap.String("levelName", name), zap.Error(err))
+	}
+
+	return name
+}
+
+// Replaces the world of the same name, or adds w as the main world
+func withWorld(worlds []backup.World, w backup.World) []backup.World {
+	for i := range worlds {
+		if worlds[i].Name == w.Name {
+			worlds[i] = w
+			return worlds
+		}
+	}
+
+	return append([]backup.World{w}, worlds...)
+}
+
+// Uploads the manifest. The backup itself already succeeded so errors are only logged
+func writeManifest(ctx context.Context, client backup.BackupClient, manifest *backup.Manifest) {
+	if keyID := crypt.KeyID(client); keyID != "" {
+		manifest.Encryption = crypt.Algorithm
+		manifest.KeyID = keyID
+	}
+
+	if err := backup.WriteManifest(ctx, client, manifest); err != nil {
+		logger.Warn("error uploading backup manifest", zap.String("backupName", manifest.Name), zap.Error(err))
+		return
+	}
+
+	logger.Info("backup manifest uploaded", zap.String("manifestName", backup.ManifestName(manifest.Name)), zap.String("sha256", manifest.SHA256))
+}
+
+// Prunes the server's backups after a successful backup. Pruning errors do not fail the backup
+func applyRetention(ctx context.Context, client backup.BackupClient, cfg config.BackupConfig) {
+	policy := retentionPolicy(cfg)
+	if policy.Empty() {
+		return
+	}
+
+	// an empty server name would apply the policy to every server's backups
+	if cfg.GetPodName() == "" {
+		logger.Warn("POD_NAME is empty. skipping retention policy")
+		return
+	}
+
+	// chunks are left to gc and prune, so the servers of a fleet do not each scan the whole destination
+	removed, err := pruneBackups(ctx, client, policy, cfg.GetPodName(), cfg.GetGCGracePeriod(), false, false)
+	if err != nil {
+		logger.Warn("error applying retention policy", zap.String("serverName", cfg.GetPodName()), zap.Error(err))
+	}
+
+	notifyPruned(cfg, cfg.GetPodName(), cfg.GetFleetName(), removed)
+}
+
+// Writes the archive into a temp file in the scratch dir before uploading it.
+// The temp file is removed whether or not the upload succeeds
+func spoolBackup(ctx context.Context, client backup.BackupClient, name, dir string, archive func(w io.Writer) error) error {
+	file, err := ioutil.TempFile(dir, name+".tmp-")
 	if err != nil {
-		logger.Error("error creating zip backup", zap.Error(err))
 		return err
 	}
 
-	defer file.Close()
+	defer func() {
+		file.Close()
+		if err := os.Remove(file.Name()); err != nil {
+			logger.Warn("error removing spooled backup", zap.String("path", file.Name()), zap.Error(err))
+		}
+	}()
 
-	// Backup to Google Cloud Storage
-	if err := cloudStorageClient.Backup(file); err != nil {
-		logger.Error("error backup up to bucket", zap.Error(err))
+	if err := archive(file); err != nil {
 		return err
 	}
 
-	os.Remove(backupName)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
 
-	return nil
+	return client.Backup(ctx, name, file)
 }
 
-func saveAll(host string, port int, password string) error {
-	if password == "" {
-		return fmt.Errorf("password env var is empty")
+// Runs fn over the worlds with world saving paused. With BACKUP_STAGE, Java Edition worlds are staged into a
+// temp directory while saving is paused instead, and fn runs over the staged copy after saving is resumed.
+// An error is returned after fn if hard linked staged files changed while fn read them, so fn must not
+// store anything that is kept if it fails. onPaused is called while saving is paused, before the worlds are read.
+// If it returns an error, the worlds are not read and its error is returned
+func withWorldsPaused(cfg config.BackupConfig, worlds []backup.World, onPaused func() error, fn func(worlds []backup.World) error) error {
+	if cfg.GetBackupStage() && cfg.GetEdition() == config.JavaEdition {
+		var aborted error
+		staged, check, cleanup, err := stageWorlds(cfg, worlds, func() error {
+			aborted = onPaused()
+			return aborted
+		})
+
+		if aborted != nil {
+			return aborted
+		}
+
+		if err == nil {
+			defer cleanup()
+
+			if err := fn(staged); err != nil {
+				return err
+			}
+
+			return check()
+		}
+
+		logger.Warn("error staging worlds. backing up with world saving paused", zap.Error(err))
 	}
 
-	hostport := net.JoinHostPort(host, strconv.Itoa(port))
+	return withSavesPaused(cfg, func() error {
+		if err := onPaused(); err != nil {
+			return err
+		}
+		return fn(worlds)
+	})
+}
 
-	rc, err := rcon.Dial(hostport, password)
+// Stages the worlds into a temp directory in BACKUP_SCRATCH_DIR, or else the server's volume, while saving is paused.
+// Returns the staged worlds, a function that returns an error if hard linked files changed since they were staged,
+// and a function that removes the staged worlds
+func stageWorlds(cfg config.BackupConfig, worlds []backup.World, onPaused func() error) ([]backup.World, func() error, func(), error) {
+	mode, err := backup.ParseStageMode(cfg.GetBackupStageLinks())
 	if err != nil {
-		return err
+		return nil, nil, nil, err
 	}
 
-	defer rc.Close()
+	// without a scratch dir the worlds are staged in the volume, where they can be linked to
+	dir := cfg.GetScratchDir()
+	if dir == "" {
+		dir = cfg.GetVolume()
+	}
 
-	reqId, err := rc.Write("save-all")
+	staging, err := ioutil.TempDir(dir, ".stage-")
 	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	cleanup := func() {
+		if err := os.RemoveAll(staging); err != nil {
+			logger.Warn("error removing staged worlds", zap.String("path", staging), zap.Error(err))
+		}
+	}
+
+	var staged []backup.World
+	var stats *backup.StageStats
+	// fingerprint of the hard linked files when they were staged
+	var linked string
+
+	start := time.Now()
+	err = withSavesPaused(cfg, func() error {
+		if err := onPaused(); err != nil {
+			return err
+		}
+
+		var err error
+		if staged, stats, err = backup.Stage(worlds, staging, mode); err != nil {
+			return err
+		}
+
+		if stats.Linked > 0 {
+			linked, err = backup.Fingerprint(staged)
+		}
 		return err
+	})
+
+	if err != nil {
+		cleanup()
+		return nil, nil, nil, err
 	}
 
-	res, resId, err := rc.Read()
+	logger.Info("worlds staged",
+		zap.String("path", staging),
+		zap.Int("files", stats.Files),
+		zap.Int("cloned", stats.Cloned),
+		zap.Int("linked", stats.Linked),
+		zap.Int("copied", stats.Copied),
+		zap.Int64("size", stats.Size),
+		zap.Duration("duration", time.Since(start)),
+	)
+
+	// the server writes some files in place, which changes hard links to them
+	check := func() error {
+		if linked == "" {
+			return nil
+		}
+
+		fingerprint, err := backup.Fingerprint(staged)
+		if err != nil {
+			return err
+		}
+
+		if fingerprint != linked {
+			return errors.New("hard linked world files were modified while they were backed up. set BACKUP_STAGE_LINKS to reflink or copy")
+		}
+
+		return nil
+	}
+
+	return staged, check, cleanup, nil
+}
+
+// Runs fn with world saving paused so the world files do not change while they are copied. Saving is
+// resumed when fn returns, even if it fails. Bedrock worlds are copied while saving is held by stageBedrockWorld instead
+func withSavesPaused(cfg config.BackupConfig, fn func() error) error {
+	if cfg.GetEdition() != config.JavaEdition {
+		return fn()
+	}
+
+	saver := save.NewJava(cfg.GetHost(), cfg.GetRCONPort(), cfg.GetRCONPassword(), cfg.GetSaveTimeout(), cfg.GetSaveMessage())
+
+	resume, err := pauseSaves(saver)
+	defer resume()
+
 	if err != nil {
-		return err
+		logger.Warn("error pausing world saves. backing up while the server may be writing to the world", zap.Error(err))
+	}
+
+	return fn()
+}
+
+// Copies the files of the Bedrock world listed by save query into a temp directory while saving is held.
+// Returns the path of the copied world and a function that removes the copy. Holding saves is bounded by ctx's deadline
+func stageBedrockWorld(ctx context.Context, cfg config.BackupConfig) (string, func(), error) {
+	if cfg.GetConsoleInput() == "" || cfg.GetConsoleOutput() == "" {
+		return "", nil, fmt.Errorf("CONSOLE_INPUT and CONSOLE_OUTPUT are not set")
+	}
+
+	openCtx, cancel := context.WithTimeout(ctx, saveTimeout(ctx, cfg))
+	defer cancel()
+
+	console, err := save.OpenFileConsole(openCtx, cfg.GetConsoleInput(), cfg.GetConsoleOutput())
+	if err != nil {
+		return "", nil, err
 	}
 
-	if reqId != resId {
-		logger.Warn("mismatch RCON request and response id", zap.Int("reqId", reqId), zap.Int("resId", resId))
+	defer console.Close()
+
+	timeout := saveTimeout(ctx, cfg)
+	if ctx.Err() != nil {
+		return "", nil, ctx.Err()
 	}
 
-	logger.Info(res)
+	// without a scratch dir the copy is made in the volume next to the server's worlds
+	dir := cfg.GetScratchDir()
+	if dir == "" {
+		dir = cfg.GetVolume()
+	}
+
+	staging, err := ioutil.TempDir(dir, ".bedrock-")
+	if err != nil {
+		return "", nil, err
+	}
+
+	cleanup := func() {
+		if err := os.RemoveAll(staging); err != nil {
+			logger.Warn("error removing copied world", zap.String("path", staging), zap.Error(err))
+		}
+	}
+
+	saver := save.NewBedrock(console, timeout)
+
+	resume, err := pauseSaves(saver)
+	if err == nil {
+		err = save.CopyFiles(world.Dir(cfg.GetVolume(), cfg.GetEdition()), saver.Files(), staging)
+	}
+	resume()
+
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	files := saver.Files()
+	if len(files) == 0 {
+		cleanup()
+		return "", nil, fmt.Errorf("save query listed no files")
+	}
+
+	logger.Info("held world copied", zap.Int("files", len(files)))
+
+	// listed paths start with the world's directory in worlds
+	world := strings.SplitN(files[0].Path, "/", 2)[0]
+	return path.Join(staging, world), cleanup, nil
+}
+
+// SAVE_TIMEOUT, or less if ctx's deadline is sooner
+func saveTimeout(ctx context.Context, cfg config.BackupConfig) time.Duration {
+	timeout := cfg.GetSaveTimeout()
+	if timeout <= 0 {
+		timeout = save.DefaultTimeout
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+
+	return timeout
+}
+
+// Pauses world saving and returns a function that resumes it. Saving is also resumed as soon as the
+// process is asked to terminate. The returned function must be called even if pausing fails
+func pauseSaves(saver save.Saver) (func(), error) {
+	start := time.Now()
+
+	var once sync.Once
+	resume := func() {
+		once.Do(func() {
+			if err := saver.Resume(); err != nil {
+				logger.Error("error resuming world saves", zap.Duration("savesPaused", time.Since(start)), zap.Error(err))
+				return
+			}
+			logger.Info("world saving resumed", zap.Duration("savesPaused", time.Since(start)))
+		})
+	}
+
+	stop := signal.OnTerminate(func() {
+		logger.Warn("terminating during backup. resuming world saves")
+		resume()
+	})
+
+	done := func() {
+		stop()
+		resume()
+	}
+
+	if err := saver.Pause(); err != nil {
+		return done, err
+	}
 
-	return nil
+	logger.Info("world saved and saving paused")
+	return done, nil
 }
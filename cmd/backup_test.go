@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/saulmaldonado/agones-mc/internal/config"
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+)
+
+func readFile(t *testing.T, name string) string {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRunBackup(t *testing.T) {
+	tests := []struct {
+		mode   config.BackupMode
+		format string
+		ext    string
+	}{
+		{config.FullBackup, "zip", ".zip"},
+		{config.FullBackup, "tar.gz", ".tar.gz"},
+		{config.FullBackup, "tar.zst", ".tar.zst"},
+		{config.IncrementalBackup, "zip", ".snapshot.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode)+"/"+tt.format, func(t *testing.T) {
+			_, backups := testServer(t)
+			setConfig(t, map[string]interface{}{config.BACKUP_MODE: string(tt.mode), config.BACKUP_FORMAT: tt.format})
+
+			name, err := RunBackup(context.Background(), config.NewBackupConfig(), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.HasPrefix(name, "mc-test-") || !strings.HasSuffix(name, tt.ext) {
+				t.Fatalf("backup named %s", name)
+			}
+
+			var manifest backup.Manifest
+			if err := json.Unmarshal([]byte(readFile(t, filepath.Join(backups, name+backup.ManifestSuffix))), &manifest); err != nil {
+				t.Fatal(err)
+			}
+
+			stored := readFile(t, filepath.Join(backups, name))
+			sum := sha256.Sum256([]byte(stored))
+
+			if manifest.Name != name || manifest.Server != "mc-test" || manifest.SHA256 != hex.EncodeToString(sum[:]) || manifest.Size != int64(len(stored)) {
+				t.Fatalf("manifest %+v does not describe the stored backup", manifest)
+			}
+
+			if len(manifest.Worlds) != 1 || manifest.Worlds[0] != "world" {
+				t.Fatalf("manifest lists worlds %v", manifest.Worlds)
+			}
+
+			// the backup loads into a new server
+			loadInto(t, name)
+		})
+	}
+}
+
+// Loads the backup into a new volume and checks that it has the world of testServer
+func loadInto(t *testing.T, name string) {
+	volume := t.TempDir()
+	setConfig(t, map[string]interface{}{config.VOLUME: volume, config.BACKUP_NAME: name})
+
+	if err := RunLoad(config.NewLoadConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readFile(t, filepath.Join(volume, "world", "level.dat")); got != "level" {
+		t.Errorf("loaded level.dat = %q", got)
+	}
+
+	if got := readFile(t, filepath.Join(volume, "world", "region", "r.0.0.mca")); got != "region" {
+		t.Errorf("loaded region file = %q", got)
+	}
+
+	if got := readFile(t, filepath.Join(volume, loadedBackupFile)); got != name+"\n" {
+		t.Errorf("loaded backup marker = %q", got)
+	}
+}
+
+func TestStagedBackup(t *testing.T) {
+	tests := []struct {
+		links string
+		ok    bool
+	}{
+		{"reflink", true},
+		{"copy", true},
+		// the server writes level.dat in place, which changes the hard linked staged file
+		{"hardlink", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.links, func(t *testing.T) {
+			volume, backups := testServer(t)
+
+			// the server saves the world once saving is resumed, while the staged world is archived
+			port := fakeRCON(t, func(cmd string) {
+				if cmd == "save-on" {
+					writeFile(t, filepath.Join(volume, "world", "level.dat"), "saved after staging")
+				}
+			})
+
+			setConfig(t, map[string]interface{}{
+				config.RCON_PORT:          port,
+				config.BACKUP_STAGE:       true,
+				config.BACKUP_STAGE_LINKS: tt.links,
+			})
+
+			name, err := RunBackup(context.Background(), config.NewBackupConfig(), false)
+
+			// the staged worlds are removed from the volume
+			if staged, _ := filepath.Glob(filepath.Join(volume, ".stage-*")); len(staged) != 0 {
+				t.Errorf("staged worlds left in the volume: %v", staged)
+			}
+
+			if !tt.ok {
+				if err == nil || !strings.Contains(err.Error(), "hard linked") {
+					t.Fatalf("RunBackup of modified hard linked files = %v", err)
+				}
+
+				if stored, _ := ioutil.ReadDir(backups); len(stored) != 0 {
+					t.Fatalf("%d objects stored by a failed backup", len(stored))
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the backup has the world as it was staged
+			loadInto(t, name)
+		})
+	}
+}
+
+func TestRunBackupResumesSaves(t *testing.T) {
+	_, backups := testServer(t)
+
+	var mu sync.Mutex
+	var commands []string
+
+	port := fakeRCON(t, func(cmd string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		commands = append(commands, cmd)
+
+		// the destination fails while the world is archived
+		if cmd == "save-all flush" {
+			if err := os.RemoveAll(backups); err != nil {
+				t.Error(err)
+			}
+			if err := ioutil.WriteFile(backups, []byte("not a directory"), 0644); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+
+	setConfig(t, map[string]interface{}{config.RCON_PORT: port})
+
+	if _, err := RunBackup(context.Background(), config.NewBackupConfig(), false); err == nil {
+		t.Fatal("RunBackup to a missing destination succeeded")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if got := strings.Join(commands, ","); got != "save-off,save-all flush,save-on" {
+		t.Fatalf("commands %s, want saving resumed after the failed backup", got)
+	}
+}
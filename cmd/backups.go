@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/saulmaldonado/agones-mc/internal/config"
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+)
+
+// backups list output formats
+const (
+	tableOutput = "table"
+	jsonOutput  = "json"
+)
+
+var backupsCmd = cobra.Command{
+	Use:   "backups",
+	Short: "Manages backups in the backup destination",
+}
+
+var backupsListCmd = cobra.Command{
+	Use:   "list",
+	Short: "Lists backups in the backup destination",
+	Long:  "list prints the backups in the backup destination, newest first, with their size, creation time and manifest fields",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := config.NewListConfig()
+
+		filter, err := listFilter(cmd)
+		if err != nil {
+			logger.Fatal("invalid flag", zap.Error(err))
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			logger.Fatal("invalid output flag", zap.Error(err))
+		}
+
+		manifests, err := cmd.Flags().GetBool("manifests")
+		if err != nil {
+			logger.Fatal("invalid manifests flag", zap.Error(err))
+		}
+
+		if err := RunList(cfg, filter, manifests, output, cmd.OutOrStdout()); err != nil {
+			logger.Fatal("listing backups failed", zap.Error(err))
+		}
+	},
+}
+
+func init() {
+	backupsListCmd.Flags().String("prefix", "", "only list backups whose name starts with this pod or fleet name prefix")
+	backupsListCmd.Flags().String("since", "", "only list backups taken at or after this RFC3339 time")
+	backupsListCmd.Flags().String("until", "", "only list backups taken before this RFC3339 time")
+	backupsListCmd.Flags().StringP("output", "o", tableOutput, "output format. table or json")
+	backupsListCmd.Flags().Bool("manifests", true, "load each backup's manifest")
+
+	backupsCmd.AddCommand(&backupsListCmd)
+	RootCmd.AddCommand(&backupsCmd)
+}
+
+func listFilter(cmd *cobra.Command) (backup.Filter, error) {
+	var filter backup.Filter
+	var err error
+
+	if filter.Prefix, err = cmd.Flags().GetString("prefix"); err != nil {
+		return filter, err
+	}
+
+	if filter.Since, err = timeFlag(cmd, "since"); err != nil {
+		return filter, err
+	}
+
+	filter.Until, err = timeFlag(cmd, "until")
+	return filter, err
+}
+
+func timeFlag(cmd *cobra.Command, name string) (time.Time, error) {
+	v, err := cmd.Flags().GetString(name)
+	if err != nil || v == "" {
+		return time.Time{}, err
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s time %q: %w", name, v, err)
+	}
+
+	return t, nil
+}
+
+func RunList(cfg config.ListConfig, filter backup.Filter, manifests bool, output string, w io.Writer) error {
+	if output != tableOutput && output != jsonOutput {
+		return fmt.Errorf("unsupported output format %q. expected table or json", output)
+	}
+
+	ctx := context.Background()
+
+	client, err := newBackupClient(ctx, cfg)
+	if err != nil {
+		logger.Error("error connecting to bucket", zap.Error(err))
+		return err
+	}
+
+	defer client.Close()
+
+	entries, err := backup.List(ctx, client, filter)
+	if err != nil {
+		return err
+	}
+
+	if manifests {
+		if err := backup.LoadManifests(ctx, client, entries); err != nil {
+			return err
+		}
+	}
+
+	if output == jsonOutput {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		// an empty listing is printed as [] rather than null
+		if entries == nil {
+			entries = []backup.Entry{}
+		}
+
+		return enc.Encode(entries)
+	}
+
+	return printTable(w, entries)
+}
+
+func printTable(w io.Writer, entries []backup.Entry) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "NAME\tSIZE\tCREATED\tEDITION\tVERSION\tFLEET\tSHA256")
+
+	for _, e := range entries {
+		edition, version, fleet, sum := "-", "-", "-", "-"
+
+		if m := e.Manifest; m != nil {
+			edition, fleet = orDash(m.Edition), orDash(m.Fleet)
+			version = orDash(m.ServerVersion)
+			if len(m.SHA256) >= 12 {
+				sum = m.SHA256[:12]
+			}
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Name, formatSize(e.Size), e.Created.UTC().Format(time.RFC3339), edition, version, fleet, sum)
+	}
+
+	return tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// Formats a byte count with a binary unit, e.g. 1.5 GiB
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
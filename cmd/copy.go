@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/saulmaldonado/agones-mc/internal/config"
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+	"github.com/saulmaldonado/agones-mc/pkg/backup/crypt"
+	"github.com/saulmaldonado/agones-mc/pkg/backup/incremental"
+)
+
+var backupsCopyCmd = cobra.Command{
+	Use:   "copy",
+	Short: "Copies backups to another destination",
+	Long: "copy copies backups with their manifests, and the chunks of snapshots, from the backup destination to another destination, " +
+		"e.g. to migrate to a new bucket. Objects are copied as stored, so encrypted backups stay encrypted. " +
+		"Objects the target already has with the same size are skipped",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := config.NewCopyConfig()
+
+		filter, err := listFilter(cmd)
+		if err != nil {
+			logger.Fatal("invalid flag", zap.Error(err))
+		}
+
+		from, err := cmd.Flags().GetString("from")
+		if err != nil {
+			logger.Fatal("invalid from flag", zap.Error(err))
+		}
+
+		to, err := cmd.Flags().GetString("to")
+		if err != nil {
+			logger.Fatal("invalid to flag", zap.Error(err))
+		}
+
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			logger.Fatal("invalid dry-run flag", zap.Error(err))
+		}
+
+		if err := RunCopy(cfg, from, to, filter, dryRun); err != nil {
+			logger.Fatal("copying backups failed", zap.Error(err))
+		}
+	},
+}
+
+func init() {
+	backupsCopyCmd.Flags().String("from", "", "destination URL to copy from. defaults to BACKUP_DESTINATION")
+	backupsCopyCmd.Flags().String("to", "", "destination URL to copy to")
+	backupsCopyCmd.Flags().String("prefix", "", "only copy backups whose name starts with this pod or fleet name prefix")
+	backupsCopyCmd.Flags().String("since", "", "only copy backups taken at or after this RFC3339 time")
+	backupsCopyCmd.Flags().String("until", "", "only copy backups taken before this RFC3339 time")
+	backupsCopyCmd.Flags().Bool("dry-run", false, "list the objects that would be copied without copying them")
+	backupsCopyCmd.MarkFlagRequired("to")
+
+	backupsCmd.AddCommand(&backupsCopyCmd)
+}
+
+func RunCopy(cfg config.CopyConfig, from, to string, filter backup.Filter, dryRun bool) error {
+	ctx := context.Background()
+
+	if from == "" {
+		var err error
+		if from, err = backupDestination(cfg); err != nil {
+			return err
+		}
+	}
+
+	if from == to {
+		return fmt.Errorf("source and target destination are the same")
+	}
+
+	src, err := newDestinationClient(ctx, from, cfg)
+	if err != nil {
+		logger.Error("error connecting to source destination", zap.String("destination", destinationName(from)), zap.Error(err))
+		return err
+	}
+
+	defer src.Close()
+
+	dst, err := newDestinationClient(ctx, to, cfg)
+	if err != nil {
+		logger.Error("error connecting to target destination", zap.String("destination", destinationName(to)), zap.Error(err))
+		return err
+	}
+
+	defer dst.Close()
+
+	// snapshots are read with the keys, if any, to find their chunks. Everything else is copied undecrypted
+	snapshots := src
+	if keyFile := cfg.GetEncryptionKeyFile(); keyFile != "" {
+		keys, err := crypt.ReadKeyFile(keyFile)
+		if err != nil {
+			return err
+		}
+
+		if snapshots, err = crypt.NewClient(src, keys); err != nil {
+			return err
+		}
+	}
+
+	entries, err := backup.List(ctx, src, filter)
+	if err != nil {
+		return err
+	}
+
+	sizes, err := objectSizes(ctx, src)
+	if err != nil {
+		return err
+	}
+
+	existing, err := objectSizes(ctx, dst)
+	if err != nil {
+		return err
+	}
+
+	var copied, skipped int
+	var total int64
+
+	for _, entry := range entries {
+		var names []string
+
+		// chunks are copied before their snapshot and manifests after their backup, so an interrupted copy
+		// never leaves a backup in the target that can not be loaded
+		if incremental.IsSnapshot(entry.Name) {
+			snapshot, err := incremental.LoadSnapshot(ctx, snapshots, entry.Name)
+			if err != nil {
+				return err
+			}
+
+			for _, f := range snapshot.Files {
+				for _, hash := range f.Chunks {
+					names = append(names, incremental.ChunkName(hash))
+				}
+			}
+		}
+
+		names = append(names, entry.Name)
+		if _, ok := sizes[backup.ManifestName(entry.Name)]; ok {
+			names = append(names, backup.ManifestName(entry.Name))
+		}
+
+		for _, name := range names {
+			if size, ok := existing[name]; ok && size == sizes[name] {
+				skipped++
+				continue
+			}
+
+			if dryRun {
+				logger.Info("object would be copied", zap.String("name", name), zap.Int64("size", sizes[name]))
+				existing[name] = sizes[name]
+				copied++
+				continue
+			}
+
+			n, err := backup.Copy(ctx, src, dst, name)
+			if err != nil {
+				logger.Error("error copying object", zap.String("name", name), zap.Error(err))
+				return err
+			}
+
+			logger.Info("object copied", zap.String("name", name), zap.Int64("size", n))
+
+			existing[name] = n
+			total += n
+			copied++
+		}
+	}
+
+	logger.Info("copy complete",
+		zap.String("from", destinationName(from)),
+		zap.String("to", destinationName(to)),
+		zap.Int("backups", len(entries)),
+		zap.Int("copied", copied),
+		zap.Int("skipped", skipped),
+		zap.Int64("bytes", total),
+		zap.Bool("dryRun", dryRun))
+
+	return nil
+}
+
+// Sizes of all objects in the destination by name
+func objectSizes(ctx context.Context, client backup.BackupClient) (map[string]int64, error) {
+	objects, err := client.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[string]int64, len(objects))
+	for _, obj := range objects {
+		sizes[obj.Name] = obj.Size
+	}
+
+	return sizes, nil
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/saulmaldonado/agones-mc/internal/config"
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+	"github.com/saulmaldonado/agones-mc/pkg/fleet"
+)
+
+// Fleet the leases of servers without FLEET_NAME are shared by
+const defaultFleet = "default"
+
+// Backs up the server once it holds one of the fleet's BACKUP_MAX_CONCURRENT backup leases. If no lease
+// can be acquired the server backs up without one, so coordination problems never prevent a backup
+func runLeasedBackup(ctx context.Context, cfg config.BackupConfig, force bool) (string, error) {
+	release := acquireBackupLease(ctx, cfg)
+	defer release()
+
+	return RunBackup(ctx, cfg, force)
+}
+
+// Waits up to BACKUP_LEASE_WAIT for a backup lease and returns a function that releases it
+func acquireBackupLease(ctx context.Context, cfg config.BackupConfig) func() {
+	none := func() {}
+
+	slots := cfg.GetBackupMaxConcurrent()
+	if slots <= 0 {
+		return none
+	}
+
+	if cfg.GetPodName() == "" {
+		logger.Warn("POD_NAME is empty. backing up without a backup lease")
+		return none
+	}
+
+	client, err := newBackupClient(ctx, cfg)
+	if err != nil {
+		logger.Warn("error connecting to bucket. backing up without a backup lease", zap.Error(err))
+		return none
+	}
+
+	store, ok := backup.ConditionalWriterOf(client)
+	if !ok {
+		client.Close()
+		logger.Warn("backup destination does not support conditional writes. backing up without a backup lease")
+		return none
+	}
+
+	fleetName := cfg.GetFleetName()
+	if fleetName == "" {
+		fleetName = defaultFleet
+	}
+
+	sem := fleet.NewSemaphore(store, fleetName, slots, cfg.GetPodName(), cfg.GetBackupLeaseTTL())
+
+	if wait := cfg.GetBackupLeaseWait(); wait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, wait)
+		defer cancel()
+	}
+
+	logger.Info("waiting for backup lease", zap.String("fleet", fleetName), zap.Int("maxConcurrent", slots))
+
+	start := time.Now()
+	lease, err := sem.Acquire(ctx)
+	if err != nil {
+		client.Close()
+		logger.Warn("error acquiring backup lease. backing up without a backup lease", zap.Duration("waited", time.Since(start)), zap.Error(err))
+		return none
+	}
+
+	logger.Info("backup lease acquired", zap.String("lease", lease.Name()), zap.Duration("waited", time.Since(start)))
+
+	return func() {
+		defer client.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := lease.Release(ctx); err != nil {
+			logger.Warn("error releasing backup lease", zap.String("lease", lease.Name()), zap.Error(err))
+		}
+	}
+}
+
+// Waits for the server's BACKUP_JITTER delay before a scheduled backup. Returns false if done is closed first
+func waitJitter(cfg config.BackupConfig, done <-chan struct{}) bool {
+	delay := fleet.Jitter(cfg.GetPodName(), cfg.GetBackupJitter())
+	if delay <= 0 {
+		return true
+	}
+
+	logger.Info("delaying scheduled backup", zap.Duration("jitter", delay))
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/saulmaldonado/agones-mc/internal/config"
+	"github.com/saulmaldonado/agones-mc/pkg/backup/incremental"
+)
+
+var gcCmd = cobra.Command{
+	Use:   "gc",
+	Short: "Deletes unreferenced incremental backup chunks",
+	Long:  "gc removes content-addressed chunks from the backup destination that are not referenced by any snapshot manifest",
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := config.NewGCConfig()
+
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			logger.Fatal("invalid dry-run flag", zap.Error(err))
+		}
+
+		if err := RunGC(cfg, dryRun); err != nil {
+			logger.Fatal("garbage collection failed", zap.Error(err))
+		}
+	},
+}
+
+func init() {
+	gcCmd.Flags().Bool("dry-run", false, "list unreferenced chunks without deleting them")
+	RootCmd.AddCommand(&gcCmd)
+}
+
+func RunGC(cfg config.GCConfig, dryRun bool) error {
+	ctx := context.Background()
+
+	client, err := newBackupClient(ctx, cfg)
+	if err != nil {
+		logger.Error("error connecting to bucket", zap.Error(err))
+		return err
+	}
+
+	defer client.Close()
+
+	deleted, err := incremental.GC(ctx, client, cfg.GetGCGracePeriod(), dryRun)
+	for _, name := range deleted {
+		logger.Info("unreferenced chunk", zap.String("chunk", name), zap.Bool("deleted", !dryRun))
+	}
+
+	if err != nil {
+		logger.Error("error deleting chunks", zap.Error(err))
+		return err
+	}
+
+	logger.Info("garbage collection complete", zap.Int("chunks", len(deleted)), zap.Bool("dryRun", dryRun))
+
+	return nil
+}
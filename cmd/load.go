@@ -2,18 +2,28 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
 
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 
 	"github.com/saulmaldonado/agones-mc/internal/config"
-	"github.com/saulmaldonado/agones-mc/pkg/backup/google"
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+	"github.com/saulmaldonado/agones-mc/pkg/backup/incremental"
+	"github.com/saulmaldonado/agones-mc/pkg/notify"
+	"github.com/saulmaldonado/agones-mc/pkg/world"
 )
 
 var loadCmd = cobra.Command{
 	Use:   "load",
-	Short: "Loads minecraft world from Google Cloud Storage",
-	Long:  "Load is an init container process that will load a minecraft world save/backup from Google Cloud Storage and load it into a volume",
+	Short: "Loads minecraft world from cloud storage",
+	Long:  "Load is an init container process that will download a minecraft world save/backup from storage and extract it into the world directory of a volume",
 	Run: func(cmd *cobra.Command, args []string) {
 		cfg := config.NewLoadConfig()
 
@@ -31,21 +41,193 @@ var loadCmd = cobra.Command{
 	},
 }
 
+// File in the volume that load writes the name of the loaded backup to
+const loadedBackupFile = ".agones-mc-backup"
+
 func init() {
 	RootCmd.AddCommand(&loadCmd)
 }
 
+// Loads the backup named by BACKUP_NAME into the volume. The outcome is sent to the configured webhooks
 func RunLoad(cfg config.LoadConfig) error {
-	client, err := google.New(context.Background(), cfg.GetBucketName())
+	start := time.Now()
+	name, err := runLoad(context.Background(), cfg)
+
+	event := notify.Event{Type: notify.LoadSucceeded, Server: cfg.GetPodName(), Backup: name, Duration: time.Since(start)}
+	if err != nil {
+		if name == "" {
+			event.Backup = cfg.GetBackupName()
+		}
+		event.Type = notify.LoadFailed
+		event.Error = err.Error()
+	}
+
+	// no backup matched and the server starts with a new world
+	if name != "" || err != nil {
+		notifyEvent(cfg, event)
+	}
+
+	return err
+}
+
+// Returns the name of the loaded backup, or an empty name if no backup matched and the server starts with a new world
+func runLoad(ctx context.Context, cfg config.LoadConfig) (string, error) {
+	client, err := newBackupClient(ctx, cfg)
 	if err != nil {
 		logger.Error("error connecting to bucket", zap.Error(err))
+		return "", err
+	}
+
+	defer client.Close()
+	defer logRetryStats(client)
+
+	name, err := backup.Resolve(ctx, client, cfg.GetBackupName())
+	if errors.Is(err, backup.ErrNotExist) && backup.IsSpec(cfg.GetBackupName()) {
+		// a new fleet has no backups yet
+		logger.Warn("no backups match. creating a new world", zap.String("backupName", cfg.GetBackupName()))
+		return "", nil
+	} else if err != nil {
+		logger.Error("error resolving backup name", zap.String("backupName", cfg.GetBackupName()), zap.Error(err))
+		return "", err
+	}
+
+	logger.Info("loading backup", zap.String("backupName", name), zap.String("spec", cfg.GetBackupName()))
+
+	if err := loadBackup(ctx, cfg, client, name); err != nil {
+		return name, err
+	}
+
+	// records which backup the world was loaded from
+	marker := path.Join(cfg.GetVolume(), loadedBackupFile)
+	if err := ioutil.WriteFile(marker, []byte(name+"\n"), 0644); err != nil {
+		logger.Error("error writing loaded backup marker", zap.String("path", marker), zap.Error(err))
+		return name, err
+	}
+
+	return name, nil
+}
+
+// Downloads the backup and replaces the server's main world with it. Each world of a backup of
+// several worlds replaces the world directory of the same name
+func loadBackup(ctx context.Context, cfg config.LoadConfig, client backup.BackupClient, name string) error {
+	root := world.Dir(cfg.GetVolume(), cfg.GetEdition())
+	worldPath := path.Join(root, levelName(cfg))
+
+	manifest, err := backup.LoadManifest(ctx, client, name)
+	if errors.Is(err, backup.ErrNotExist) {
+		logger.Warn("backup has no manifest. skipping checksum verification", zap.String("backupName", name))
+	} else if err != nil {
+		logger.Error("error loading backup manifest", zap.Error(err))
 		return err
 	}
 
-	if err := client.Load(cfg.GetBackupName(), cfg.GetVolume()); err != nil {
+	if client, err = checkEncryption(client, manifest); err != nil {
+		logger.Error("missing encryption key", zap.Error(err))
+		return err
+	}
+
+	if manifest != nil && manifest.Edition != string(cfg.GetEdition()) {
+		err := fmt.Errorf("backup %q is a %s world, server edition is %s", name, manifest.Edition, cfg.GetEdition())
+		logger.Error("backup edition mismatch", zap.Error(err))
+		return err
+	}
+
+	// Snapshots are rebuilt from their chunks without an intermediate archive
+	if incremental.IsSnapshot(name) {
+		paths, err := incremental.RestoreWorlds(ctx, client, name, root, worldPath)
+		if err != nil {
+			logger.Error("error restoring snapshot", zap.String("worldPath", worldPath), zap.Error(err))
+			return err
+		}
+
+		logger.Info("snapshot restored", zap.Strings("worldPaths", paths))
+		return nil
+	}
+
+	format, err := backupFormat(name, manifest)
+	if err != nil {
+		logger.Error("invalid backup format", zap.Error(err))
+		return err
+	}
+
+	// Download into a temp file in the volume. It is removed once the world is extracted
+	archive, err := ioutil.TempFile(cfg.GetVolume(), ".world-*"+format.Ext())
+	if err != nil {
+		logger.Error("error creating archive file", zap.Error(err))
+		return err
+	}
+
+	defer func() {
+		archive.Close()
+		if err := os.Remove(archive.Name()); err != nil {
+			logger.Warn("error removing downloaded archive", zap.String("path", archive.Name()), zap.Error(err))
+		}
+	}()
+
+	digest := backup.NewDigestWriter()
+
+	if err := client.Load(ctx, name, io.MultiWriter(archive, digest)); err != nil {
 		logger.Error("error loading world", zap.Error(err))
 		return err
 	}
 
+	if manifest != nil && (manifest.SHA256 != digest.Sum() || manifest.Size != digest.Size()) {
+		err := fmt.Errorf("backup %q is corrupt: sha256 %s (%d bytes), manifest sha256 %s (%d bytes)",
+			name, digest.Sum(), digest.Size(), manifest.SHA256, manifest.Size)
+		logger.Error("backup checksum mismatch", zap.Error(err))
+		return err
+	}
+
+	// backups of more than the server's worlds are extracted into the server's data directory
+	if volumeLayout(archive.Name(), format, manifest) {
+		// without a manifest the archive's worlds are unknown and every file is extracted in place
+		var worlds []string
+		if manifest != nil {
+			worlds = manifest.Worlds
+		}
+
+		if err := backup.ExtractVolume(archive.Name(), format, cfg.GetVolume(), worlds); err != nil {
+			logger.Error("error extracting backup", zap.String("volume", cfg.GetVolume()), zap.Error(err))
+			return err
+		}
+
+		logger.Info("backup extracted", zap.String("volume", cfg.GetVolume()), zap.Strings("worlds", worlds), zap.String("format", string(format)))
+		return nil
+	}
+
+	paths, err := backup.ExtractWorlds(archive.Name(), format, root, worldPath)
+	if err != nil {
+		logger.Error("error extracting world", zap.String("worldPath", worldPath), zap.Error(err))
+		return err
+	}
+
+	logger.Info("world extracted", zap.Strings("worldPaths", paths), zap.String("format", string(format)))
+
 	return nil
 }
+
+// Reports whether the archive has the volume layout. Archives without a manifest have it if they have a
+// server.properties at their root
+func volumeLayout(source string, format backup.Format, manifest *backup.Manifest) bool {
+	if manifest != nil {
+		return manifest.Layout == backup.VolumeLayout
+	}
+
+	layout, err := backup.Layout(source, format)
+	if err != nil {
+		logger.Warn("error reading archive layout. extracting as a world", zap.Error(err))
+		return false
+	}
+
+	return layout == backup.VolumeLayout
+}
+
+// Returns the archive format recorded in the backup's manifest, or the format of the backup's name
+// extension for backups without a manifest. Backups without a known extension are zips
+func backupFormat(name string, manifest *backup.Manifest) (backup.Format, error) {
+	if manifest != nil && manifest.Format != "" {
+		return backup.ParseFormat(manifest.Format)
+	}
+
+	return backup.FormatOf(name), nil
+}
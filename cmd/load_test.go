@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/saulmaldonado/agones-mc/internal/config"
+)
+
+func TestRunLoad(t *testing.T) {
+	volume, backups := testServer(t)
+
+	name, err := RunBackup(context.Background(), config.NewBackupConfig(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the loaded world replaces the server's world
+	writeFile(t, filepath.Join(volume, "world", "level.dat"), "changed")
+	writeFile(t, filepath.Join(volume, "world", "region", "r.1.0.mca"), "new region")
+
+	setConfig(t, map[string]interface{}{config.BACKUP_NAME: "latest"})
+
+	if err := RunLoad(config.NewLoadConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readFile(t, filepath.Join(volume, "world", "level.dat")); got != "level" {
+		t.Errorf("level.dat = %q after loading the backup", got)
+	}
+
+	if _, err := os.Stat(filepath.Join(volume, "world", "region", "r.1.0.mca")); !os.IsNotExist(err) {
+		t.Errorf("file created after the backup was kept: %v", err)
+	}
+
+	if got := readFile(t, filepath.Join(volume, loadedBackupFile)); got != name+"\n" {
+		t.Errorf("latest loaded %q, want %s", got, name)
+	}
+
+	// the world is not replaced by a backup that does not match its manifest
+	if err := ioutil.WriteFile(filepath.Join(backups, name), []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, filepath.Join(volume, "world", "level.dat"), "changed")
+
+	if err := RunLoad(config.NewLoadConfig()); err == nil {
+		t.Fatal("RunLoad of a corrupt backup succeeded")
+	}
+
+	if got := readFile(t, filepath.Join(volume, "world", "level.dat")); got != "changed" {
+		t.Errorf("level.dat = %q after loading a corrupt backup", got)
+	}
+}
+
+func TestRunLoadMissing(t *testing.T) {
+	volume, _ := testServer(t)
+
+	// a new server of a fleet without backups starts with a new world
+	setConfig(t, map[string]interface{}{config.BACKUP_NAME: "latest"})
+
+	if err := RunLoad(config.NewLoadConfig()); err != nil {
+		t.Fatalf("RunLoad without backups = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(volume, loadedBackupFile)); !os.IsNotExist(err) {
+		t.Fatal("loaded backup marker written without a backup")
+	}
+
+	// a backup that is named explicitly must exist
+	setConfig(t, map[string]interface{}{config.BACKUP_NAME: "mc-test-2021-07-01T00:00:00.000Z.zip"})
+
+	if err := RunLoad(config.NewLoadConfig()); err == nil {
+		t.Fatal("RunLoad of a missing backup succeeded")
+	}
+
+	if got := readFile(t, filepath.Join(volume, "world", "level.dat")); got != "level" {
+		t.Errorf("level.dat = %q after a failed load", got)
+	}
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/saulmaldonado/agones-mc/internal/config"
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+	"github.com/saulmaldonado/agones-mc/pkg/backup/retention"
+	"github.com/saulmaldonado/agones-mc/pkg/notify"
+)
+
+// Sends the event to each webhook in WEBHOOK_URLS. Failed notifications are logged and never fail the command
+func notifyEvent(cfg config.NotifyConfig, e notify.Event) {
+	urls := cfg.GetWebhookURLs()
+	if len(urls) == 0 {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	policy := backup.RetryPolicy{Attempts: cfg.GetWebhookRetries() + 1, Backoff: time.Second, MaxBackoff: 30 * time.Second}
+
+	opts := notify.WebhookOptions{
+		Format:   notify.Format(cfg.GetWebhookFormat()),
+		Template: cfg.GetWebhookTemplate(),
+		Events:   cfg.GetWebhookEvents(),
+		Timeout:  cfg.GetWebhookTimeout(),
+		Retry:    &policy,
+	}
+
+	for _, url := range urls {
+		webhook, err := notify.NewWebhook(url, opts)
+		if err != nil {
+			logger.Warn("invalid webhook", zap.String("webhook", notify.Redact(url)), zap.Error(err))
+			continue
+		}
+
+		if err := webhook.Notify(context.Background(), e); err != nil {
+			logger.Warn("error sending webhook notification", zap.String("webhook", webhook.String()), zap.String("event", string(e.Type)), zap.Error(err))
+		}
+	}
+}
+
+// Sends a BackupPruned event if any backups were pruned
+func notifyPruned(cfg config.NotifyConfig, server, fleet string, removed []retention.Backup) {
+	if len(removed) == 0 {
+		return
+	}
+
+	names := make([]string, len(removed))
+	for i, b := range removed {
+		names[i] = b.Name
+	}
+
+	notifyEvent(cfg, notify.Event{Type: notify.BackupPruned, Server: server, Fleet: fleet, Pruned: names})
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/saulmaldonado/agones-mc/internal/config"
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+	"github.com/saulmaldonado/agones-mc/pkg/backup/incremental"
+	"github.com/saulmaldonado/agones-mc/pkg/backup/retention"
+)
+
+var pruneCmd = cobra.Command{
+	Use:   "prune",
+	Short: "Deletes backups according to the retention policy",
+	Long:  "prune applies the configured retention policy to each server's backups in the backup destination and deletes the backups it does not keep",
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := config.NewPruneConfig()
+
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			logger.Fatal("invalid dry-run flag", zap.Error(err))
+		}
+
+		server, err := cmd.Flags().GetString("server")
+		if err != nil {
+			logger.Fatal("invalid server flag", zap.Error(err))
+		}
+
+		if err := RunPrune(cfg, server, dryRun); err != nil {
+			logger.Fatal("prune failed", zap.Error(err))
+		}
+	},
+}
+
+func init() {
+	pruneCmd.Flags().Bool("dry-run", false, "list backups that would be deleted without deleting them")
+	pruneCmd.Flags().String("server", "", "only prune backups of this server (default all servers)")
+	RootCmd.AddCommand(&pruneCmd)
+}
+
+func RunPrune(cfg config.PruneConfig, server string, dryRun bool) error {
+	policy := retentionPolicy(cfg)
+	if policy.Empty() {
+		logger.Info("no retention policy configured. nothing to prune")
+		return nil
+	}
+
+	ctx := context.Background()
+
+	client, err := newBackupClient(ctx, cfg)
+	if err != nil {
+		logger.Error("error connecting to bucket", zap.Error(err))
+		return err
+	}
+
+	defer client.Close()
+
+	removed, err := pruneBackups(ctx, client, policy, server, cfg.GetGCGracePeriod(), true, dryRun)
+	if !dryRun {
+		notifyPruned(cfg, server, "", removed)
+	}
+
+	return err
+}
+
+func retentionPolicy(cfg config.RetentionConfig) retention.Policy {
+	return retention.Policy{
+		KeepLast:    cfg.GetKeepLast(),
+		KeepDaily:   cfg.GetKeepDaily(),
+		KeepWeekly:  cfg.GetKeepWeekly(),
+		KeepMonthly: cfg.GetKeepMonthly(),
+		MaxAge:      cfg.GetMaxAge(),
+	}
+}
+
+// Deletes the backups the policy does not keep and returns them, including when pruning fails partway.
+// With gc, chunks only referenced by deleted snapshots are garbage collected
+func pruneBackups(ctx context.Context, client backup.BackupClient, policy retention.Policy, server string, gracePeriod time.Duration, gc, dryRun bool) ([]retention.Backup, error) {
+	removed, err := retention.Prune(ctx, client, policy, server, time.Now(), dryRun)
+
+	var snapshots int
+	for _, b := range removed {
+		logger.Info("pruned backup", zap.String("backupName", b.Name), zap.String("serverName", b.Server), zap.Time("created", b.Time), zap.Bool("dryRun", dryRun))
+
+		if incremental.IsSnapshot(b.Name) {
+			snapshots++
+		}
+	}
+
+	if err != nil {
+		logger.Error("error pruning backups", zap.Error(err))
+		return removed, err
+	}
+
+	logger.Info("prune complete", zap.Int("pruned", len(removed)), zap.Stringer("policy", policy), zap.Bool("dryRun", dryRun))
+
+	if gc && snapshots > 0 && !dryRun {
+		deleted, err := incremental.GC(ctx, client, gracePeriod, false)
+		if err != nil {
+			logger.Error("error deleting unreferenced chunks", zap.Error(err))
+			return removed, err
+		}
+
+		logger.Info("deleted unreferenced chunks", zap.Int("chunks", len(deleted)))
+	}
+
+	return removed, nil
+}
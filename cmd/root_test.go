@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/saulmaldonado/agones-mc/internal/config"
+	_ "github.com/saulmaldonado/agones-mc/pkg/backup/local"
+)
+
+func TestMain(m *testing.M) {
+	logger = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+// Sets config values for the test and restores them when it ends
+func setConfig(t *testing.T, values map[string]interface{}) {
+	for key, value := range values {
+		key, old := key, viper.Get(key)
+		viper.Set(key, value)
+		t.Cleanup(func() { viper.Set(key, old) })
+	}
+}
+
+// Port on localhost that nothing listens on
+func closedPort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	return port
+}
+
+// Configures a Java server named mc-test with a world in a temp volume and backups in a temp dir. Nothing
+// listens on the server's ports, so pings and RCON commands fail. Returns the volume and the backup dir
+func testServer(t *testing.T) (string, string) {
+	volume, backups := t.TempDir(), t.TempDir()
+
+	writeFile(t, filepath.Join(volume, "world", "level.dat"), "level")
+	writeFile(t, filepath.Join(volume, "world", "region", "r.0.0.mca"), "region")
+	writeFile(t, filepath.Join(volume, "server.properties"), "level-name=world\n")
+
+	setConfig(t, map[string]interface{}{
+		config.EDITION:               string(config.JavaEdition),
+		config.HOST:                  "127.0.0.1",
+		config.PORT:                  closedPort(t),
+		config.RCON_PORT:             closedPort(t),
+		config.VOLUME:                volume,
+		config.POD_NAME:              "mc-test",
+		config.BACKUP_DESTINATION:    "file://" + filepath.ToSlash(backups),
+		config.BACKUP_STATE_FILE:     "",
+		config.STORAGE_RETRIES:       0,
+		config.SAVE_TIMEOUT:          2 * time.Second,
+		config.BACKUP_SKIP_UNCHANGED: false,
+	})
+
+	return volume, backups
+}
+
+func writeFile(t *testing.T, name, content string) {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
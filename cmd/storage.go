@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/saulmaldonado/agones-mc/internal/config"
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+	"github.com/saulmaldonado/agones-mc/pkg/backup/crypt"
+)
+
+// Creates a backup client for the configured destination and replicas. Backups are encrypted with the
+// keys in ENCRYPTION_KEY_FILE if it is set
+func newBackupClient(ctx context.Context, cfg config.StorageConfig) (backup.BackupClient, error) {
+	// retries are made below encryption so interrupted downloads resume in the encrypted stream.
+	// Backups are encrypted once for all replicas
+	client, err := newStorageClient(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	keyFile := cfg.GetEncryptionKeyFile()
+	if keyFile == "" {
+		return client, nil
+	}
+
+	keys, err := crypt.ReadKeyFile(keyFile)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return crypt.NewClient(client, keys)
+}
+
+// Creates an unencrypted client for BACKUP_DESTINATION that also stores every object in BACKUP_REPLICAS
+func newStorageClient(ctx context.Context, cfg config.StorageConfig) (backup.BackupClient, error) {
+	destination, err := backupDestination(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	primary, err := newDestinationClient(ctx, destination, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	replicas := cfg.GetBackupReplicas()
+	if len(replicas) == 0 {
+		return primary, nil
+	}
+
+	policy, err := backup.ParseReplicationPolicy(cfg.GetReplicationPolicy())
+	if err != nil {
+		primary.Close()
+		return nil, err
+	}
+
+	var destinations []backup.Destination
+	for _, replica := range replicas {
+		c, err := newDestinationClient(ctx, replica, cfg)
+		if err != nil {
+			primary.Close()
+			for _, d := range destinations {
+				d.Client.Close()
+			}
+			return nil, fmt.Errorf("replica %s: %w", destinationName(replica), err)
+		}
+
+		destinations = append(destinations, backup.Destination{Name: destinationName(replica), Client: c})
+	}
+
+	client := backup.NewReplicatedClient(policy, backup.Destination{Name: destinationName(destination), Client: primary}, destinations...)
+
+	client.OnResult = func(name string, result backup.ReplicaResult) {
+		if result.Err != nil {
+			logger.Warn("error storing object in destination", zap.String("destination", result.Destination), zap.String("name", name), zap.Error(result.Err))
+			return
+		}
+
+		logger.Info("object stored in destination", zap.String("destination", result.Destination), zap.String("name", name))
+	}
+
+	return client, nil
+}
+
+// Returns an error if BACKUP_REPLICAS is set for incremental backups. Listings of replicated destinations
+// merge their objects, so chunks stored in one destination would not be uploaded to the others
+func checkReplicas(cfg config.BackupConfig) error {
+	if cfg.GetBackupMode() == config.IncrementalBackup && len(cfg.GetBackupReplicas()) > 0 {
+		return errors.New("incremental backups can not be replicated. copy snapshots with backups copy instead")
+	}
+
+	return nil
+}
+
+// Creates a client for the destination URL that retries failed operations
+func newDestinationClient(ctx context.Context, destination string, cfg config.StorageConfig) (backup.BackupClient, error) {
+	backend, err := backup.New(ctx, destination)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRetryClient(backend, cfg), nil
+}
+
+// Destination URL without user info, for logging
+func destinationName(destination string) string {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return "invalid URL"
+	}
+
+	u.User = nil
+	return u.String()
+}
+
+// Wraps the backend in a client that retries failed operations with exponential backoff
+// and cancels operations that make no progress for STORAGE_TIMEOUT
+func newRetryClient(client backup.BackupClient, cfg config.StorageConfig) backup.BackupClient {
+	policy := backup.DefaultRetryPolicy
+	policy.Attempts = cfg.GetStorageRetries() + 1
+	policy.Backoff = cfg.GetStorageRetryBackoff()
+
+	retryClient := backup.NewRetryClient(client, policy, cfg.GetStorageTimeout())
+	retryClient.OnRetry = func(op, name string, err error, delay time.Duration) {
+		logger.Warn("storage operation failed. retrying", zap.String("op", op), zap.String("name", name), zap.Duration("delay", delay), zap.Error(err))
+	}
+
+	return retryClient
+}
+
+// Logs the counts of retried storage operations, if any
+func logRetryStats(client backup.BackupClient) {
+	stats, ok := backup.RetryStatsOf(client)
+	if !ok || stats == (backup.RetryStats{}) {
+		return
+	}
+
+	logger.Info("storage operations retried", zap.Int64("retries", stats.Retries), zap.Int64("resumes", stats.Resumes), zap.Int64("stalls", stats.Stalls))
+}
+
+// Returns an error if the backup described by manifest is encrypted and client has no key to decrypt it.
+// Otherwise returns the client to load the backup with, which fails if an encrypted backup is not encrypted
+func checkEncryption(client backup.BackupClient, manifest *backup.Manifest) (backup.BackupClient, error) {
+	if manifest == nil || manifest.KeyID == "" {
+		return client, nil
+	}
+
+	c, ok := client.(*crypt.Client)
+	if !ok {
+		return nil, fmt.Errorf("backup %q is encrypted with key %s. set ENCRYPTION_KEY_FILE to load it", manifest.Name, manifest.KeyID)
+	}
+
+	if !c.HasKey(manifest.KeyID) {
+		return nil, fmt.Errorf("backup %q is encrypted with key %s, which is not in ENCRYPTION_KEY_FILE", manifest.Name, manifest.KeyID)
+	}
+
+	return c.RequireEncrypted(manifest.Name), nil
+}
+
+// Returns BACKUP_DESTINATION or builds an equivalent destination URL from the legacy
+// STORAGE_PROVIDER, BUCKET_NAME, S3_* and BACKUP_DIR settings
+func backupDestination(cfg config.StorageConfig) (string, error) {
+	if destination := cfg.GetBackupDestination(); destination != "" {
+		return destination, nil
+	}
+
+	switch provider := cfg.GetStorageProvider(); provider {
+	case config.GoogleStorage:
+		u := url.URL{Scheme: "gs", Host: cfg.GetBucketName()}
+		return u.String(), nil
+	case config.S3Storage:
+		q := url.Values{}
+		if endpoint := cfg.GetS3Endpoint(); endpoint != "" {
+			q.Set("endpoint", endpoint)
+		}
+		// without a region the client falls back to AWS_REGION, like destination URLs
+		if region := cfg.GetS3Region(); region != "" {
+			q.Set("region", region)
+		}
+		q.Set("path_style", strconv.FormatBool(cfg.GetS3PathStyle()))
+
+		u := url.URL{Scheme: "s3", Host: cfg.GetBucketName(), RawQuery: q.Encode()}
+		return u.String(), nil
+	case config.LocalStorage:
+		dir := cfg.GetBackupDir()
+		if dir != "" {
+			var err error
+			if dir, err = filepath.Abs(dir); err != nil {
+				return "", err
+			}
+		}
+
+		u := url.URL{Scheme: "file", Path: filepath.ToSlash(dir)}
+		return u.String(), nil
+	default:
+		return "", fmt.Errorf("unsupported storage provider %q", provider)
+	}
+}
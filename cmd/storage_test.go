@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/saulmaldonado/agones-mc/internal/config"
+)
+
+func TestCheckReplicas(t *testing.T) {
+	tests := []struct {
+		mode     config.BackupMode
+		replicas string
+		wantErr  bool
+	}{
+		{config.FullBackup, "", false},
+		{config.FullBackup, "file:///replica", false},
+		{config.IncrementalBackup, "", false},
+		{config.IncrementalBackup, "file:///replica", true},
+	}
+
+	for _, tt := range tests {
+		setConfig(t, map[string]interface{}{config.BACKUP_MODE: string(tt.mode), config.BACKUP_REPLICAS: tt.replicas})
+
+		if err := checkReplicas(config.NewBackupConfig()); (err != nil) != tt.wantErr {
+			t.Errorf("%s backups replicated to %q: checkReplicas = %v, want error %v", tt.mode, tt.replicas, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+
+	sdk "agones.dev/agones/sdks/go"
+	"go.uber.org/zap"
+
+	"github.com/saulmaldonado/agones-mc/internal/config"
+	"github.com/saulmaldonado/agones-mc/pkg/trigger"
+)
+
+// Watches the GameServer through the local Agones SDK server. If BACKUP_ON_REQUEST is set the server
+// is backed up whenever BACKUP_REQUEST_ANNOTATION is set to a new value, until done is closed. The result
+// of each requested backup is written back to the GameServer's annotations
+func watchGameServer(cfg config.BackupConfig, done <-chan struct{}) (*trigger.Watcher, error) {
+	s, err := sdk.NewSDK()
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := trigger.Watch(s, cfg.GetBackupRequestAnnotation())
+	if err != nil {
+		return nil, err
+	}
+
+	if !cfg.GetBackupOnRequest() {
+		return watcher, nil
+	}
+
+	logger.Info("watching GameServer for backup requests", zap.String("annotation", cfg.GetBackupRequestAnnotation()))
+
+	go func() {
+		for {
+			select {
+			case id := <-watcher.Requests():
+				runRequestedBackup(cfg, watcher, id)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return watcher, nil
+}
+
+func runRequestedBackup(cfg config.BackupConfig, watcher *trigger.Watcher, id string) {
+	logger.Info("backup requested", zap.String("serverName", cfg.GetPodName()), zap.String("request", id))
+
+	if err := watcher.Started(id); err != nil {
+		logger.Warn("error annotating GameServer with backup status", zap.Error(err))
+	}
+
+	// requested backups are taken even if the world has not changed
+	name, err := runLeasedBackup(context.Background(), cfg, true)
+	if err != nil {
+		logger.Error("requested backup failed", zap.String("serverName", cfg.GetPodName()), zap.String("request", id), zap.Error(err))
+	} else {
+		logger.Info("requested backup successful", zap.String("serverName", cfg.GetPodName()), zap.String("request", id), zap.String("backupName", name))
+	}
+
+	if err := watcher.Finished(name, err); err != nil {
+		logger.Warn("error annotating GameServer with backup status", zap.Error(err))
+	}
+}
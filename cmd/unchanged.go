@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"go.uber.org/zap"
+
+	"github.com/saulmaldonado/agones-mc/internal/config"
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+	"github.com/saulmaldonado/agones-mc/pkg/ping"
+)
+
+// Returned by RunBackup when a backup is skipped because nothing changed since the last backup
+var errUnchanged = errors.New("world has not changed since the last backup")
+
+// Returns the fingerprint and name of the server's last backup if the backup can be skipped when the world still has
+// the same fingerprint, or else empty strings. Backups are not skipped while players are online or if anything
+// prevents the comparison. The world is only fingerprinted once it is saved, so that is left to unchanged
+func previousFingerprint(ctx context.Context, cfg config.BackupConfig, client backup.BackupClient) (string, string) {
+	// backups of other servers would be compared against
+	if cfg.GetPodName() == "" {
+		logger.Warn("POD_NAME is empty. backing up without checking for changes")
+		return "", ""
+	}
+
+	last, lastBackup := lastFingerprint(ctx, cfg, client)
+	if last == "" {
+		return "", ""
+	}
+
+	// changes of online players may not be saved to the world files yet
+	pinger := ping.NewPinger(cfg.GetHost(), uint16(cfg.GetPort()), ping.DefaultTimeout, cfg.GetEdition())
+	if info, err := pinger.PingWithTimeout(); err != nil {
+		logger.Warn("error pinging server. checking for changes without player activity", zap.Error(err))
+	} else if info.OnlinePlayers > 0 {
+		logger.Info("players are online. backing up", zap.Int32("onlinePlayers", info.OnlinePlayers))
+		return "", ""
+	}
+
+	return last, lastBackup
+}
+
+// Reports whether the backup can be skipped because the world's fingerprint is the previous fingerprint. Must be
+// called while saving is paused, after the world is saved, so changes that are not flushed yet are not missed
+func unchanged(previous, fingerprint string) bool {
+	return previous != "" && fingerprint == previous
+}
+
+// Fingerprint of the files selected for backup without the files matched by BACKUP_UNCHANGED_IGNORE. worlds must be
+// the server's worlds rather than copies of them, since copies have different modification times
+func worldFingerprint(cfg config.BackupConfig, contents *backup.Contents, worlds []backup.World) (string, error) {
+	ignored := *contents
+	ignored.Exclude = append(append([]string{}, contents.Exclude...), cfg.GetBackupUnchangedIgnore()...)
+
+	return backup.Fingerprint(selectFiles(cfg, &ignored, worlds).worlds)
+}
+
+// Returns the fingerprint and name of the server's last backup from BACKUP_STATE_FILE, or else from the manifest
+// of its newest backup in the destination. Returns an empty fingerprint if there is none
+func lastFingerprint(ctx context.Context, cfg config.BackupConfig, client backup.BackupClient) (string, string) {
+	if path := cfg.GetBackupStateFile(); path != "" {
+		state, err := backup.ReadState(path)
+		if err == nil && state.Server == cfg.GetPodName() {
+			return state.Fingerprint, state.Backup
+		}
+
+		if err != nil && !os.IsNotExist(err) {
+			logger.Warn("error reading backup state file", zap.String("path", path), zap.Error(err))
+		}
+	}
+
+	entries, err := backup.List(ctx, client, backup.Filter{Prefix: cfg.GetPodName()})
+	if err != nil {
+		logger.Warn("error listing backups. backing up without checking for changes", zap.Error(err))
+		return "", ""
+	}
+
+	for _, entry := range entries {
+		// the prefix also matches servers whose names start with this server's name
+		if entry.Server != cfg.GetPodName() {
+			continue
+		}
+
+		manifest, err := backup.LoadManifest(ctx, client, entry.Name)
+		if err != nil {
+			if !errors.Is(err, backup.ErrNotExist) {
+				logger.Warn("error loading backup manifest. backing up without checking for changes", zap.String("backupName", entry.Name), zap.Error(err))
+			}
+			return "", ""
+		}
+
+		return manifest.Fingerprint, entry.Name
+	}
+
+	return "", ""
+}
+
+// Fingerprint recorded with a backup. Errors are only logged since they only cost a backup the next time
+func recordFingerprint(cfg config.BackupConfig, contents *backup.Contents, worlds []backup.World) string {
+	fingerprint, err := worldFingerprint(cfg, contents, worlds)
+	if err != nil {
+		logger.Warn("error fingerprinting world. the next backup will not be skipped", zap.Error(err))
+		return ""
+	}
+
+	return fingerprint
+}
+
+// Records the backup's fingerprint in BACKUP_STATE_FILE so the next backup is compared against it
+func saveState(cfg config.BackupConfig, manifest *backup.Manifest) {
+	path := cfg.GetBackupStateFile()
+	if path == "" || manifest.Fingerprint == "" {
+		return
+	}
+
+	state := &backup.State{Server: cfg.GetPodName(), Backup: manifest.Name, Fingerprint: manifest.Fingerprint, Created: manifest.Created}
+	if err := backup.WriteState(path, state); err != nil {
+		logger.Warn("error writing backup state file", zap.String("path", path), zap.Error(err))
+	}
+}
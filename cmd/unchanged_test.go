@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/saulmaldonado/agones-mc/internal/config"
+)
+
+// RCON server that accepts any password and answers save-all flush like a Java server. Commands are
+// passed to handle before they are answered. Returns the server's port
+func fakeRCON(t *testing.T, handle func(cmd string)) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveRCON(conn, handle)
+		}
+	}()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func serveRCON(conn net.Conn, handle func(cmd string)) {
+	defer conn.Close()
+
+	for {
+		var header struct{ Size, ID, Type int32 }
+		if err := binary.Read(conn, binary.LittleEndian, &header); err != nil {
+			return
+		}
+
+		body := make([]byte, header.Size-8)
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+
+		// auth requests are answered with an auth response, commands with a response value
+		var resType int32 = 2
+		var res string
+		if header.Type != 3 {
+			cmd := strings.TrimRight(string(body), "\x00")
+			handle(cmd)
+
+			resType = 0
+			if cmd == "save-all flush" {
+				res = "Saved the game"
+			}
+		}
+
+		var packet bytes.Buffer
+		binary.Write(&packet, binary.LittleEndian, []int32{int32(10 + len(res)), header.ID, resType})
+		packet.WriteString(res + "\x00\x00")
+
+		if _, err := conn.Write(packet.Bytes()); err != nil {
+			return
+		}
+	}
+}
+
+func TestUnchanged(t *testing.T) {
+	tests := []struct {
+		name        string
+		previous    string
+		fingerprint string
+		want        bool
+	}{
+		{"unchanged", "abc", "abc", true},
+		{"changed", "abc", "def", false},
+		{"no previous backup", "", "abc", false},
+		{"world not fingerprinted", "abc", "", false},
+	}
+
+	for _, tt := range tests {
+		if got := unchanged(tt.previous, tt.fingerprint); got != tt.want {
+			t.Errorf("%s: unchanged(%q, %q) = %v, want %v", tt.name, tt.previous, tt.fingerprint, got, tt.want)
+		}
+	}
+}
+
+func TestSkipUnchanged(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.NewBackupConfig()
+
+	volume, backups := testServer(t)
+	state := filepath.Join(t.TempDir(), "state.json")
+
+	// changes the server has not written yet are written by save-all flush
+	var mu sync.Mutex
+	var pending func()
+	var commands []string
+
+	port := fakeRCON(t, func(cmd string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		commands = append(commands, cmd)
+		if cmd == "save-all flush" && pending != nil {
+			pending()
+			pending = nil
+		}
+	})
+
+	setConfig(t, map[string]interface{}{
+		config.RCON_PORT:             port,
+		config.BACKUP_SKIP_UNCHANGED: true,
+		config.BACKUP_STATE_FILE:     state,
+	})
+
+	stored := func() int {
+		files, err := filepath.Glob(filepath.Join(backups, "mc-test-*.zip"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(files)
+	}
+
+	backUp := func(force bool, wantSkip bool) {
+		t.Helper()
+
+		before := stored()
+		_, err := RunBackup(ctx, cfg, force)
+
+		if wantSkip {
+			if !errors.Is(err, errUnchanged) {
+				t.Fatalf("RunBackup = %v, want errUnchanged", err)
+			}
+			if stored() != before {
+				t.Fatal("skipped backup was stored")
+			}
+			return
+		}
+
+		if err != nil {
+			t.Fatalf("RunBackup = %v, want a backup", err)
+		}
+		if stored() != before+1 {
+			t.Fatal("backup was not stored")
+		}
+	}
+
+	// without a previous backup there is nothing to compare against
+	backUp(false, false)
+	backUp(false, true)
+
+	// the change is only written to the world when it is saved
+	mu.Lock()
+	pending = func() { writeFile(t, filepath.Join(volume, "world", "region", "r.0.0.mca"), "region with a new chunk") }
+	mu.Unlock()
+	backUp(false, false)
+	backUp(false, true)
+
+	// forced backups are taken anyway
+	backUp(true, false)
+
+	// without the state file the manifest of the newest backup is compared against
+	if err := os.Remove(state); err != nil {
+		t.Fatal(err)
+	}
+	backUp(false, true)
+
+	// saving is resumed after a skipped backup
+	mu.Lock()
+	last := commands[len(commands)-1]
+	mu.Unlock()
+	if last != "save-on" {
+		t.Fatalf("last command was %q, want save-on", last)
+	}
+
+	// final backups are always taken
+	before := stored()
+	if _, err := runFinalBackup(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if stored() != before+1 {
+		t.Fatal("final backup was not stored")
+	}
+}
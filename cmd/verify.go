@@ -0,0 +1,376 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/saulmaldonado/agones-mc/internal/config"
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+	"github.com/saulmaldonado/agones-mc/pkg/backup/crypt"
+	"github.com/saulmaldonado/agones-mc/pkg/backup/incremental"
+	"github.com/saulmaldonado/agones-mc/pkg/world"
+)
+
+// verify exit codes
+const (
+	// configuration, connection or other errors that say nothing about the backup
+	verifyExitError = 1
+	// the backup does not exist
+	verifyExitNotFound = 2
+	// the backup does not match the checksum in its manifest
+	verifyExitChecksum = 3
+	// the archive or one of its entries cannot be decompressed, a snapshot chunk is missing or corrupt,
+	// or an encrypted backup fails authentication
+	verifyExitCorrupt = 4
+	// the world fails sanity checks
+	verifyExitInvalidWorld = 5
+)
+
+// Error failing verification with the given exit code
+type verifyError struct {
+	code int
+	err  error
+}
+
+func (e *verifyError) Error() string {
+	return e.err.Error()
+}
+
+func (e *verifyError) Unwrap() error {
+	return e.err
+}
+
+var verifyCmd = cobra.Command{
+	Use:   "verify [backup name | latest[:prefix] | before:time]",
+	Short: "Verifies the integrity of a backup",
+	Long: `verify downloads a backup, checks it against the checksum in its manifest, test-decompresses every file
+and runs sanity checks on the world. The backup name defaults to BACKUP_NAME. Exit codes:
+  1  configuration or connection error
+  2  backup not found
+  3  checksum mismatch
+  4  corrupt archive or snapshot chunks
+  5  invalid world`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := config.NewVerifyConfig()
+
+		name := cfg.GetBackupName()
+		if len(args) > 0 {
+			name = args[0]
+		}
+
+		server, err := cmd.Flags().GetString("server")
+		if err != nil {
+			logger.Fatal("invalid server flag", zap.Error(err))
+		}
+
+		if err := RunVerify(cfg, name, server); err != nil {
+			code := verifyExitError
+			var verr *verifyError
+			if errors.As(err, &verr) {
+				code = verr.code
+			}
+
+			logger.Error("backup verification failed", zap.String("backupName", name), zap.Int("exitCode", code), zap.Error(err))
+			logger.Sync()
+			os.Exit(code)
+		}
+	},
+}
+
+func init() {
+	verifyCmd.Flags().String("server", "", "pod or fleet name prefix of the backup latest resolves to. defaults to every server")
+	RootCmd.AddCommand(&verifyCmd)
+}
+
+func RunVerify(cfg config.VerifyConfig, name, server string) error {
+	if name == "" {
+		return fmt.Errorf("no backup name. pass a backup name or set BACKUP_NAME")
+	}
+
+	ctx := context.Background()
+
+	client, err := newBackupClient(ctx, cfg)
+	if err != nil {
+		logger.Error("error connecting to bucket", zap.Error(err))
+		return err
+	}
+
+	defer client.Close()
+	defer logRetryStats(client)
+
+	if name == backup.Latest && server != "" {
+		name += ":" + server
+	}
+
+	if backup.IsSpec(name) {
+		spec := name
+		if name, err = backup.Resolve(ctx, client, spec); err != nil {
+			return loadError(err)
+		}
+
+		logger.Info("resolved backup", zap.String("spec", spec), zap.String("backupName", name))
+	}
+
+	edition := cfg.GetEdition()
+
+	manifest, err := backup.LoadManifest(ctx, client, name)
+	if errors.Is(err, backup.ErrNotExist) {
+		logger.Warn("backup has no manifest. skipping checksum verification", zap.String("backupName", name))
+	} else if err != nil {
+		return err
+	} else {
+		edition = config.Edition(manifest.Edition)
+	}
+
+	loader, err := checkEncryption(client, manifest)
+	if err != nil {
+		return err
+	}
+
+	verifiers := &worldVerifiers{edition: edition, worlds: make(map[string]*world.Verifier)}
+
+	if incremental.IsSnapshot(name) {
+		err = verifySnapshot(ctx, loader, name, manifest, verifiers, cfg.GetScratchDir())
+	} else {
+		err = verifyArchive(ctx, loader, name, manifest, verifiers, cfg.GetScratchDir())
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, w := range verifiers.names() {
+		verifier := verifiers.worlds[w]
+
+		level, err := verifier.Done()
+		if err != nil {
+			if w != "" {
+				err = fmt.Errorf("world %q: %w", w, err)
+			}
+			return &verifyError{verifyExitInvalidWorld, err}
+		}
+
+		logger.Info("world verified",
+			zap.String("world", w),
+			zap.String("levelName", level.Name),
+			zap.Int32("dataVersion", level.DataVersion),
+			zap.Int("regions", verifier.Regions()),
+		)
+	}
+
+	logger.Info("backup verified",
+		zap.String("backupName", name),
+		zap.String("edition", string(edition)),
+		zap.Int("worlds", len(verifiers.worlds)),
+	)
+
+	return nil
+}
+
+// Verifiers of the worlds in a backup by world directory name. A backup of a single world has one world named ""
+type worldVerifiers struct {
+	edition config.Edition
+	worlds  map[string]*world.Verifier
+}
+
+// Returns the verifier of the named world
+func (v *worldVerifiers) world(name string) *world.Verifier {
+	if _, ok := v.worlds[name]; !ok {
+		v.worlds[name] = world.NewVerifier(v.edition)
+	}
+	return v.worlds[name]
+}
+
+func (v *worldVerifiers) names() []string {
+	names := make([]string, 0, len(v.worlds))
+	for name := range v.worlds {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Downloads the archive into a temp file, checks its digest and reads every entry
+func verifyArchive(ctx context.Context, client backup.BackupClient, name string, manifest *backup.Manifest, verifiers *worldVerifiers, dir string) error {
+	format, err := backupFormat(name, manifest)
+	if err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(dir, ".verify-*"+format.Ext())
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		file.Close()
+		if err := os.Remove(file.Name()); err != nil {
+			logger.Warn("error removing downloaded archive", zap.String("path", file.Name()), zap.Error(err))
+		}
+	}()
+
+	digest := backup.NewDigestWriter()
+
+	if err := client.Load(ctx, name, io.MultiWriter(file, digest)); err != nil {
+		return loadError(err)
+	}
+
+	if err := checkDigest(manifest, digest); err != nil {
+		return err
+	}
+
+	if manifest != nil && manifest.Layout == backup.VolumeLayout {
+		err = walkVolume(file.Name(), format, manifest.Worlds, verifiers)
+	} else {
+		err = walkWorlds(file.Name(), format, verifiers)
+	}
+
+	var corrupt *backup.CorruptArchiveError
+	var invalid *world.InvalidWorldError
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &corrupt):
+		return &verifyError{verifyExitCorrupt, err}
+	case errors.As(err, &invalid):
+		return &verifyError{verifyExitInvalidWorld, err}
+	default:
+		return err
+	}
+}
+
+// Reads every entry of the archive with the verifier of its world. Entries of an archive of several
+// worlds are prefixed with their world's directory name
+func walkWorlds(source string, format backup.Format, verifiers *worldVerifiers) error {
+	worlds, err := backup.Worlds(source, format)
+	if err != nil {
+		return err
+	}
+
+	if len(worlds) == 0 {
+		return backup.Walk(source, format, verifiers.world("").File)
+	}
+
+	for _, w := range worlds {
+		verifiers.world(w)
+	}
+
+	return backup.Walk(source, format, func(name string, r io.Reader) error {
+		parts := strings.SplitN(name, "/", 2)
+		if len(parts) < 2 {
+			return nil
+		}
+
+		return verifiers.world(parts[0]).File(parts[1], r)
+	})
+}
+
+// Reads every entry of an archive with the volume layout. Entries of the listed worlds are read with
+// their world's verifier and other files are only decompressed
+func walkVolume(source string, format backup.Format, worlds []string, verifiers *worldVerifiers) error {
+	for _, w := range worlds {
+		verifiers.world(w)
+	}
+
+	return backup.Walk(source, format, func(name string, r io.Reader) error {
+		for _, w := range worlds {
+			if strings.HasPrefix(name, w+"/") {
+				return verifiers.world(w).File(strings.TrimPrefix(name, w+"/"), r)
+			}
+		}
+
+		_, err := io.Copy(ioutil.Discard, r)
+		return err
+	})
+}
+
+// Checks the snapshot manifest's digest and restores the snapshot into a temp directory,
+// which verifies the hash of every chunk
+func verifySnapshot(ctx context.Context, client backup.BackupClient, name string, manifest *backup.Manifest, verifiers *worldVerifiers, dir string) error {
+	digest := backup.NewDigestWriter()
+
+	if err := client.Load(ctx, name, digest); err != nil {
+		return loadError(err)
+	}
+
+	if err := checkDigest(manifest, digest); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempDir(dir, ".verify-")
+	if err != nil {
+		return err
+	}
+
+	defer os.RemoveAll(tmp)
+
+	// worlds of a snapshot of several worlds are restored into their own directory so their paths never equal worldPath
+	worldPath := filepath.Join(tmp, "world")
+	worldsDir := filepath.Join(tmp, "worlds")
+
+	// missing chunks mean the snapshot can not be restored
+	paths, err := incremental.RestoreWorlds(ctx, client, name, worldsDir, worldPath)
+	if errors.Is(err, incremental.ErrCorruptChunk) || errors.Is(err, backup.ErrNotExist) || errors.Is(err, crypt.ErrAuth) {
+		return &verifyError{verifyExitCorrupt, err}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, p := range paths {
+		// the world of a snapshot of a single world is restored into worldPath
+		var w string
+		if p != worldPath {
+			w = filepath.Base(p)
+		}
+
+		if err := verifiers.world(w).Dir(p); err != nil {
+			var invalid *world.InvalidWorldError
+			if errors.As(err, &invalid) {
+				return &verifyError{verifyExitInvalidWorld, err}
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func loadError(err error) error {
+	switch {
+	case errors.Is(err, backup.ErrNotExist):
+		return &verifyError{verifyExitNotFound, err}
+	case errors.Is(err, crypt.ErrAuth), errors.Is(err, crypt.ErrNotEncrypted):
+		// the backup was modified or truncated after it was encrypted
+		return &verifyError{verifyExitCorrupt, err}
+	default:
+		return err
+	}
+}
+
+func checkDigest(manifest *backup.Manifest, digest *backup.DigestWriter) error {
+	if manifest == nil {
+		return nil
+	}
+
+	if manifest.SHA256 != digest.Sum() || manifest.Size != digest.Size() {
+		return &verifyError{verifyExitChecksum, fmt.Errorf("sha256 %s (%d bytes), manifest sha256 %s (%d bytes)",
+			digest.Sum(), digest.Size(), manifest.SHA256, manifest.Size)}
+	}
+
+	return nil
+}
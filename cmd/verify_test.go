@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/saulmaldonado/agones-mc/internal/config"
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+)
+
+// Gzipped NBT of a Java Edition level.dat with a Data compound
+func levelDat(t *testing.T) string {
+	var nbt bytes.Buffer
+
+	tag := func(typ byte, name string) {
+		nbt.WriteByte(typ)
+		binary.Write(&nbt, binary.BigEndian, uint16(len(name)))
+		nbt.WriteString(name)
+	}
+
+	tag(10, "")
+	tag(10, "Data")
+	tag(8, "LevelName")
+	binary.Write(&nbt, binary.BigEndian, uint16(len("world")))
+	nbt.WriteString("world")
+	tag(3, "DataVersion")
+	binary.Write(&nbt, binary.BigEndian, int32(2730))
+	nbt.WriteByte(0)
+	nbt.WriteByte(0)
+
+	var level bytes.Buffer
+	w := gzip.NewWriter(&level)
+	if _, err := w.Write(nbt.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return level.String()
+}
+
+// Exit code of verify for an error returned by RunVerify
+func verifyCode(err error) int {
+	var verr *verifyError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &verr):
+		return verr.code
+	default:
+		return verifyExitError
+	}
+}
+
+func TestRunVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		mode config.BackupMode
+		// encrypts backups if set
+		encrypt bool
+		// breaks the server's world before it is backed up
+		before func(t *testing.T, volume string)
+		// breaks the stored backup
+		after func(t *testing.T, backups, name string) string
+		want  int
+	}{
+		{name: "valid", mode: config.FullBackup, want: 0},
+		{name: "valid snapshot", mode: config.IncrementalBackup, want: 0},
+		{name: "valid encrypted", mode: config.FullBackup, encrypt: true, want: 0},
+		{
+			name: "latest", mode: config.FullBackup, want: 0,
+			after: func(t *testing.T, backups, name string) string { return "latest:mc-test" },
+		},
+		{
+			name: "invalid destination", mode: config.FullBackup, want: verifyExitError,
+			after: func(t *testing.T, backups, name string) string {
+				setConfig(t, map[string]interface{}{config.BACKUP_DESTINATION: "ftp://backups"})
+				return name
+			},
+		},
+		{
+			name: "missing backup", mode: config.FullBackup, want: verifyExitNotFound,
+			after: func(t *testing.T, backups, name string) string { return "mc-test-2021-07-01T00:00:00.000Z.zip" },
+		},
+		{
+			name: "no match", mode: config.FullBackup, want: verifyExitNotFound,
+			after: func(t *testing.T, backups, name string) string { return "latest:mc-other" },
+		},
+		{
+			name: "deleted backup with a manifest", mode: config.FullBackup, want: verifyExitNotFound,
+			after: func(t *testing.T, backups, name string) string {
+				removeFile(t, filepath.Join(backups, name))
+				return name
+			},
+		},
+		{
+			name: "checksum mismatch", mode: config.FullBackup, want: verifyExitChecksum,
+			after: func(t *testing.T, backups, name string) string {
+				flipByte(t, filepath.Join(backups, name))
+				return name
+			},
+		},
+		{
+			name: "snapshot checksum mismatch", mode: config.IncrementalBackup, want: verifyExitChecksum,
+			after: func(t *testing.T, backups, name string) string {
+				writeFile(t, filepath.Join(backups, name), "{}")
+				return name
+			},
+		},
+		{
+			name: "corrupt archive", mode: config.FullBackup, want: verifyExitCorrupt,
+			after: func(t *testing.T, backups, name string) string {
+				// without the manifest nothing is known about the archive's contents
+				removeFile(t, filepath.Join(backups, name+backup.ManifestSuffix))
+				truncateFile(t, filepath.Join(backups, name))
+				return name
+			},
+		},
+		{
+			name: "missing chunk", mode: config.IncrementalBackup, want: verifyExitCorrupt,
+			after: func(t *testing.T, backups, name string) string {
+				chunks, err := filepath.Glob(filepath.Join(backups, "chunks", "*", "*"))
+				if err != nil || len(chunks) == 0 {
+					t.Fatalf("no chunks stored: %v", err)
+				}
+
+				removeFile(t, chunks[0])
+				return name
+			},
+		},
+		{
+			name: "decryption failure", mode: config.FullBackup, encrypt: true, want: verifyExitCorrupt,
+			after: func(t *testing.T, backups, name string) string {
+				flipByte(t, filepath.Join(backups, name))
+				return name
+			},
+		},
+		{
+			name: "invalid level.dat", mode: config.FullBackup, want: verifyExitInvalidWorld,
+			before: func(t *testing.T, volume string) {
+				writeFile(t, filepath.Join(volume, "world", "level.dat"), "level")
+			},
+		},
+		{
+			name: "invalid region", mode: config.IncrementalBackup, want: verifyExitInvalidWorld,
+			before: func(t *testing.T, volume string) {
+				writeFile(t, filepath.Join(volume, "world", "region", "r.0.0.mca"), "region")
+			},
+		},
+		{
+			name: "missing level.dat", mode: config.FullBackup, want: verifyExitInvalidWorld,
+			before: func(t *testing.T, volume string) {
+				removeFile(t, filepath.Join(volume, "world", "level.dat"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			volume, backups := testServer(t)
+
+			// a valid world with an empty region file
+			writeFile(t, filepath.Join(volume, "world", "level.dat"), levelDat(t))
+			writeFile(t, filepath.Join(volume, "world", "region", "r.0.0.mca"), "")
+
+			setConfig(t, map[string]interface{}{config.BACKUP_MODE: string(tt.mode)})
+
+			if tt.encrypt {
+				key := make([]byte, 32)
+				if _, err := rand.Read(key); err != nil {
+					t.Fatal(err)
+				}
+
+				keyFile := filepath.Join(t.TempDir(), "keys")
+				writeFile(t, keyFile, base64.StdEncoding.EncodeToString(key)+"\n")
+				setConfig(t, map[string]interface{}{config.ENCRYPTION_KEY_FILE: keyFile})
+			}
+
+			if tt.before != nil {
+				tt.before(t, volume)
+			}
+
+			name, err := RunBackup(context.Background(), config.NewBackupConfig(), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.after != nil {
+				name = tt.after(t, backups, name)
+			}
+
+			err = RunVerify(config.NewVerifyConfig(), name, "")
+			if got := verifyCode(err); got != tt.want {
+				t.Fatalf("RunVerify = %v with exit code %d, want %d", err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunVerifyNoName(t *testing.T) {
+	testServer(t)
+
+	if got := verifyCode(RunVerify(config.NewVerifyConfig(), "", "")); got != verifyExitError {
+		t.Fatalf("RunVerify without a name exited with %d", got)
+	}
+}
+
+func removeFile(t *testing.T, name string) {
+	if err := os.Remove(name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Changes a byte in the middle of the file
+func flipByte(t *testing.T, name string) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data[len(data)/2] ^= 0xff
+
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func truncateFile(t *testing.T, name string) {
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Truncate(name, info.Size()*2/3); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -9,9 +9,11 @@ require (
 	github.com/ZeroErrors/go-bedrockping v1.0.0
 	github.com/go-co-op/gocron v1.5.0
 	github.com/james4k/rcon v0.0.0-20210222224819-34a67ca2b2d6
+	github.com/klauspost/compress v1.15.9
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/spf13/cobra v1.1.3
 	github.com/spf13/viper v1.8.1
 	go.uber.org/zap v1.17.0
 	golang.org/x/net v0.0.0-20210410081132-afb366fc7cd1 // indirect
+	google.golang.org/api v0.45.0
 )
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
@@ -9,6 +10,8 @@ import (
 type Edition string
 type Environment string
 type Subcommand string
+type StorageProvider string
+type BackupMode string
 
 const (
 	// subcommands
@@ -16,6 +19,11 @@ const (
 	Monitor Subcommand = "monitor"
 	Backup  Subcommand = "backup"
 	Load    Subcommand = "load"
+	GC      Subcommand = "gc"
+	Prune   Subcommand = "prune"
+	Verify  Subcommand = "verify"
+	List    Subcommand = "list"
+	Copy    Subcommand = "copy"
 )
 
 const (
@@ -28,6 +36,17 @@ const (
 
 	Development Environment = "development"
 	Production  Environment = "production"
+
+	// storage provider
+
+	GoogleStorage StorageProvider = "google"
+	S3Storage     StorageProvider = "s3"
+	LocalStorage  StorageProvider = "local"
+
+	// backup mode
+
+	FullBackup        BackupMode = "full"
+	IncrementalBackup BackupMode = "incremental"
 )
 
 const (
@@ -45,6 +64,7 @@ const (
 	RCON_PASSWORD string = "RCON_PASSWORD"
 	VOLUME        string = "VOLUME"
 	POD_NAME      string = "POD_NAME"
+	LEVEL_NAME    string = "LEVEL_NAME"
 
 	// monitor config
 
@@ -54,9 +74,74 @@ const (
 
 	// backup config
 
-	BUCKET_NAME string = "BUCKET_NAME"
-	BACKUP_CRON string = "BACKUP_CRON"
-	BACKUP_NAME string = "BACKUP_NAME"
+	BUCKET_NAME               string = "BUCKET_NAME"
+	BACKUP_CRON               string = "BACKUP_CRON"
+	BACKUP_NAME               string = "BACKUP_NAME"
+	BACKUP_SCRATCH_DIR        string = "BACKUP_SCRATCH_DIR"
+	BACKUP_MODE               string = "BACKUP_MODE"
+	FLEET_NAME                string = "FLEET_NAME"
+	BACKUP_FORMAT             string = "BACKUP_FORMAT"
+	COMPRESSION_LEVEL         string = "COMPRESSION_LEVEL"
+	SAVE_TIMEOUT              string = "SAVE_TIMEOUT"
+	SAVE_MESSAGE              string = "SAVE_MESSAGE"
+	CONSOLE_INPUT             string = "CONSOLE_INPUT"
+	CONSOLE_OUTPUT            string = "CONSOLE_OUTPUT"
+	BACKUP_PRESET             string = "BACKUP_PRESET"
+	BACKUP_INCLUDE            string = "BACKUP_INCLUDE"
+	BACKUP_EXCLUDE            string = "BACKUP_EXCLUDE"
+	BACKUP_ON_REQUEST         string = "BACKUP_ON_REQUEST"
+	BACKUP_REQUEST_ANNOTATION string = "BACKUP_REQUEST_ANNOTATION"
+	BACKUP_ON_SHUTDOWN        string = "BACKUP_ON_SHUTDOWN"
+	FINAL_BACKUP_TIMEOUT      string = "FINAL_BACKUP_TIMEOUT"
+	BACKUP_MAX_CONCURRENT     string = "BACKUP_MAX_CONCURRENT"
+	BACKUP_LEASE_TTL          string = "BACKUP_LEASE_TTL"
+	BACKUP_LEASE_WAIT         string = "BACKUP_LEASE_WAIT"
+	BACKUP_JITTER             string = "BACKUP_JITTER"
+	BACKUP_SKIP_UNCHANGED     string = "BACKUP_SKIP_UNCHANGED"
+	BACKUP_UNCHANGED_IGNORE   string = "BACKUP_UNCHANGED_IGNORE"
+	BACKUP_FORCE_CRON         string = "BACKUP_FORCE_CRON"
+	BACKUP_STATE_FILE         string = "BACKUP_STATE_FILE"
+	BACKUP_STAGE              string = "BACKUP_STAGE"
+	BACKUP_STAGE_LINKS        string = "BACKUP_STAGE_LINKS"
+
+	// gc config
+
+	GC_GRACE_PERIOD string = "GC_GRACE_PERIOD"
+
+	// retention config
+
+	RETENTION_KEEP_LAST    string = "RETENTION_KEEP_LAST"
+	RETENTION_KEEP_DAILY   string = "RETENTION_KEEP_DAILY"
+	RETENTION_KEEP_WEEKLY  string = "RETENTION_KEEP_WEEKLY"
+	RETENTION_KEEP_MONTHLY string = "RETENTION_KEEP_MONTHLY"
+	RETENTION_MAX_AGE      string = "RETENTION_MAX_AGE"
+
+	// storage config
+
+	BACKUP_DESTINATION    string = "BACKUP_DESTINATION"
+	ENCRYPTION_KEY_FILE   string = "ENCRYPTION_KEY_FILE"
+	STORAGE_TIMEOUT       string = "STORAGE_TIMEOUT"
+	STORAGE_RETRIES       string = "STORAGE_RETRIES"
+	STORAGE_RETRY_BACKOFF string = "STORAGE_RETRY_BACKOFF"
+	BACKUP_REPLICAS       string = "BACKUP_REPLICAS"
+	REPLICATION_POLICY    string = "REPLICATION_POLICY"
+
+	// legacy storage config. used to build a destination when BACKUP_DESTINATION is not set
+
+	STORAGE_PROVIDER string = "STORAGE_PROVIDER"
+	S3_ENDPOINT      string = "S3_ENDPOINT"
+	S3_REGION        string = "S3_REGION"
+	S3_PATH_STYLE    string = "S3_PATH_STYLE"
+	BACKUP_DIR       string = "BACKUP_DIR"
+
+	// notify config
+
+	WEBHOOK_URLS     string = "WEBHOOK_URLS"
+	WEBHOOK_FORMAT   string = "WEBHOOK_FORMAT"
+	WEBHOOK_TEMPLATE string = "WEBHOOK_TEMPLATE"
+	WEBHOOK_EVENTS   string = "WEBHOOK_EVENTS"
+	WEBHOOK_TIMEOUT  string = "WEBHOOK_TIMEOUT"
+	WEBHOOK_RETRIES  string = "WEBHOOK_RETRIES"
 )
 
 var (
@@ -76,6 +161,7 @@ var (
 	RCON_PASSWORD_DEFAULT string = "minecraft"
 	VOLUME_DEFAULT        string = "/data"
 	POD_NAME_DEFAULT      string = ""
+	LEVEL_NAME_DEFAULT    string = ""
 
 	// monitor config
 
@@ -85,9 +171,71 @@ var (
 
 	// backup config
 
-	BUCKET_NAME_DEFAULT string = ""
-	BACKUP_CRON_DEFAULT string = ""
-	BACKUP_NAME_DEFAULT string = ""
+	BUCKET_NAME_DEFAULT               string        = ""
+	BACKUP_CRON_DEFAULT               string        = ""
+	BACKUP_NAME_DEFAULT               string        = ""
+	BACKUP_SCRATCH_DIR_DEFAULT        string        = ""
+	BACKUP_MODE_DEFAULT               BackupMode    = FullBackup
+	FLEET_NAME_DEFAULT                string        = ""
+	BACKUP_FORMAT_DEFAULT             string        = "zip"
+	COMPRESSION_LEVEL_DEFAULT         int           = 0
+	SAVE_TIMEOUT_DEFAULT              time.Duration = time.Minute
+	SAVE_MESSAGE_DEFAULT              string        = ""
+	CONSOLE_INPUT_DEFAULT             string        = ""
+	CONSOLE_OUTPUT_DEFAULT            string        = ""
+	BACKUP_PRESET_DEFAULT             string        = "world-only"
+	BACKUP_INCLUDE_DEFAULT            string        = ""
+	BACKUP_EXCLUDE_DEFAULT            string        = ""
+	BACKUP_ON_REQUEST_DEFAULT         bool          = false
+	BACKUP_REQUEST_ANNOTATION_DEFAULT string        = "agones-mc/backup-requested"
+	BACKUP_ON_SHUTDOWN_DEFAULT        bool          = false
+	FINAL_BACKUP_TIMEOUT_DEFAULT      time.Duration = 25 * time.Second
+	BACKUP_MAX_CONCURRENT_DEFAULT     int           = 0
+	BACKUP_LEASE_TTL_DEFAULT          time.Duration = time.Minute
+	BACKUP_LEASE_WAIT_DEFAULT         time.Duration = 30 * time.Minute
+	BACKUP_JITTER_DEFAULT             time.Duration = 0
+	BACKUP_SKIP_UNCHANGED_DEFAULT     bool          = false
+	BACKUP_UNCHANGED_IGNORE_DEFAULT   string        = ""
+	BACKUP_FORCE_CRON_DEFAULT         string        = ""
+	BACKUP_STATE_FILE_DEFAULT         string        = "/tmp/agones-mc-backup-state.json"
+	BACKUP_STAGE_DEFAULT              bool          = false
+	BACKUP_STAGE_LINKS_DEFAULT        string        = "reflink"
+
+	// gc config
+
+	GC_GRACE_PERIOD_DEFAULT time.Duration = time.Hour
+
+	// retention config
+
+	RETENTION_KEEP_LAST_DEFAULT    int           = 0
+	RETENTION_KEEP_DAILY_DEFAULT   int           = 0
+	RETENTION_KEEP_WEEKLY_DEFAULT  int           = 0
+	RETENTION_KEEP_MONTHLY_DEFAULT int           = 0
+	RETENTION_MAX_AGE_DEFAULT      time.Duration = 0
+
+	// storage config
+
+	BACKUP_DESTINATION_DEFAULT    string          = ""
+	ENCRYPTION_KEY_FILE_DEFAULT   string          = ""
+	STORAGE_TIMEOUT_DEFAULT       time.Duration   = 5 * time.Minute
+	STORAGE_RETRIES_DEFAULT       int             = 3
+	STORAGE_RETRY_BACKOFF_DEFAULT time.Duration   = time.Second
+	BACKUP_REPLICAS_DEFAULT       string          = ""
+	REPLICATION_POLICY_DEFAULT    string          = "all"
+	STORAGE_PROVIDER_DEFAULT      StorageProvider = GoogleStorage
+	S3_ENDPOINT_DEFAULT           string          = ""
+	S3_REGION_DEFAULT             string          = ""
+	S3_PATH_STYLE_DEFAULT         bool            = false
+	BACKUP_DIR_DEFAULT            string          = ""
+
+	// notify config
+
+	WEBHOOK_URLS_DEFAULT     string        = ""
+	WEBHOOK_FORMAT_DEFAULT   string        = ""
+	WEBHOOK_TEMPLATE_DEFAULT string        = ""
+	WEBHOOK_EVENTS_DEFAULT   string        = ""
+	WEBHOOK_TIMEOUT_DEFAULT  time.Duration = 10 * time.Second
+	WEBHOOK_RETRIES_DEFAULT  int           = 3
 )
 
 type SharedConfig interface {
@@ -103,6 +251,7 @@ type ServerConfig interface {
 	GetRCONPassword() string
 	GetVolume() string
 	GetPodName() string
+	GetLevelName() string
 }
 
 type MonitorConfig interface {
@@ -113,18 +262,112 @@ type MonitorConfig interface {
 	GetAttempts() int
 }
 
+type StorageConfig interface {
+	GetBackupDestination() string
+	GetEncryptionKeyFile() string
+	GetStorageTimeout() time.Duration
+	GetStorageRetries() int
+	GetStorageRetryBackoff() time.Duration
+	GetBackupReplicas() []string
+	GetReplicationPolicy() string
+	GetStorageProvider() StorageProvider
+	GetBucketName() string
+	GetS3Endpoint() string
+	GetS3Region() string
+	GetS3PathStyle() bool
+	GetBackupDir() string
+}
+
+type NotifyConfig interface {
+	GetWebhookURLs() []string
+	GetWebhookFormat() string
+	GetWebhookTemplate() string
+	GetWebhookEvents() []string
+	GetWebhookTimeout() time.Duration
+	GetWebhookRetries() int
+}
+
+type RetentionConfig interface {
+	GetKeepLast() int
+	GetKeepDaily() int
+	GetKeepWeekly() int
+	GetKeepMonthly() int
+	GetMaxAge() time.Duration
+}
+
 type BackupConfig interface {
 	SharedConfig
 	ServerConfig
-	GetBucketName() string
+	StorageConfig
+	RetentionConfig
+	NotifyConfig
+	GetGCGracePeriod() time.Duration
 	GetBackupCron() string
+	GetScratchDir() string
+	GetBackupMode() BackupMode
+	GetFleetName() string
+	GetBackupFormat() string
+	GetCompressionLevel() int
+	GetSaveTimeout() time.Duration
+	GetSaveMessage() string
+	GetConsoleInput() string
+	GetConsoleOutput() string
+	GetBackupPreset() string
+	GetBackupInclude() []string
+	GetBackupExclude() []string
+	GetBackupOnRequest() bool
+	GetBackupRequestAnnotation() string
+	GetBackupOnShutdown() bool
+	GetFinalBackupTimeout() time.Duration
+	GetBackupMaxConcurrent() int
+	GetBackupLeaseTTL() time.Duration
+	GetBackupLeaseWait() time.Duration
+	GetBackupJitter() time.Duration
+	GetBackupSkipUnchanged() bool
+	GetBackupUnchangedIgnore() []string
+	GetBackupForceCron() string
+	GetBackupStateFile() string
+	GetBackupStage() bool
+	GetBackupStageLinks() string
 }
 
 type LoadConfig interface {
 	ServerConfig
+	StorageConfig
+	NotifyConfig
+	GetBackupName() string
+}
+
+type GCConfig interface {
+	SharedConfig
+	StorageConfig
+	GetGCGracePeriod() time.Duration
+}
+
+type PruneConfig interface {
+	SharedConfig
+	StorageConfig
+	RetentionConfig
+	NotifyConfig
+	GetGCGracePeriod() time.Duration
+}
+
+type VerifyConfig interface {
+	SharedConfig
 	ServerConfig
-	GetBucketName() string
+	StorageConfig
 	GetBackupName() string
+	GetScratchDir() string
+}
+
+type ListConfig interface {
+	SharedConfig
+	StorageConfig
+}
+
+type CopyConfig interface {
+	SharedConfig
+	StorageConfig
 }
 
 type FileserverConfig interface {
@@ -175,6 +418,112 @@ func (serverConfig) GetPodName() string {
 	return viper.GetString(POD_NAME)
 }
 
+func (serverConfig) GetLevelName() string {
+	return viper.GetString(LEVEL_NAME)
+}
+
+type storageConfig struct{}
+
+func (storageConfig) GetBackupDestination() string {
+	return viper.GetString(BACKUP_DESTINATION)
+}
+
+func (storageConfig) GetEncryptionKeyFile() string {
+	return viper.GetString(ENCRYPTION_KEY_FILE)
+}
+
+func (storageConfig) GetStorageTimeout() time.Duration {
+	return viper.GetDuration(STORAGE_TIMEOUT)
+}
+
+func (storageConfig) GetStorageRetries() int {
+	return viper.GetInt(STORAGE_RETRIES)
+}
+
+func (storageConfig) GetStorageRetryBackoff() time.Duration {
+	return viper.GetDuration(STORAGE_RETRY_BACKOFF)
+}
+
+func (storageConfig) GetBackupReplicas() []string {
+	return splitList(viper.GetString(BACKUP_REPLICAS))
+}
+
+func (storageConfig) GetReplicationPolicy() string {
+	return viper.GetString(REPLICATION_POLICY)
+}
+
+func (storageConfig) GetStorageProvider() StorageProvider {
+	return StorageProvider(viper.GetString(STORAGE_PROVIDER))
+}
+
+func (storageConfig) GetBucketName() string {
+	return viper.GetString(BUCKET_NAME)
+}
+
+func (storageConfig) GetS3Endpoint() string {
+	return viper.GetString(S3_ENDPOINT)
+}
+
+func (storageConfig) GetS3Region() string {
+	return viper.GetString(S3_REGION)
+}
+
+func (storageConfig) GetS3PathStyle() bool {
+	return viper.GetBool(S3_PATH_STYLE)
+}
+
+func (storageConfig) GetBackupDir() string {
+	return viper.GetString(BACKUP_DIR)
+}
+
+type notifyConfig struct{}
+
+func (notifyConfig) GetWebhookURLs() []string {
+	return splitList(viper.GetString(WEBHOOK_URLS))
+}
+
+func (notifyConfig) GetWebhookFormat() string {
+	return viper.GetString(WEBHOOK_FORMAT)
+}
+
+func (notifyConfig) GetWebhookTemplate() string {
+	return viper.GetString(WEBHOOK_TEMPLATE)
+}
+
+func (notifyConfig) GetWebhookEvents() []string {
+	return splitList(viper.GetString(WEBHOOK_EVENTS))
+}
+
+func (notifyConfig) GetWebhookTimeout() time.Duration {
+	return viper.GetDuration(WEBHOOK_TIMEOUT)
+}
+
+func (notifyConfig) GetWebhookRetries() int {
+	return viper.GetInt(WEBHOOK_RETRIES)
+}
+
+type retentionConfig struct{}
+
+func (retentionConfig) GetKeepLast() int {
+	return viper.GetInt(RETENTION_KEEP_LAST)
+}
+
+func (retentionConfig) GetKeepDaily() int {
+	return viper.GetInt(RETENTION_KEEP_DAILY)
+}
+
+func (retentionConfig) GetKeepWeekly() int {
+	return viper.GetInt(RETENTION_KEEP_WEEKLY)
+}
+
+func (retentionConfig) GetKeepMonthly() int {
+	return viper.GetInt(RETENTION_KEEP_MONTHLY)
+}
+
+func (retentionConfig) GetMaxAge() time.Duration {
+	return viper.GetDuration(RETENTION_MAX_AGE)
+}
+
 type monitorConfig struct {
 	sharedConfig
 	serverConfig
@@ -199,37 +548,217 @@ func (monitorConfig) GetAttempts() int {
 type backupConfig struct {
 	sharedConfig
 	serverConfig
+	storageConfig
+	retentionConfig
+	notifyConfig
 }
 
 func NewBackupConfig() backupConfig {
 	return backupConfig{}
 }
 
-func (backupConfig) GetBucketName() string {
-	return viper.GetString(BUCKET_NAME)
-}
-
 func (backupConfig) GetBackupCron() string {
 	return viper.GetString(BACKUP_CRON)
 }
 
+func (backupConfig) GetScratchDir() string {
+	return viper.GetString(BACKUP_SCRATCH_DIR)
+}
+
+func (backupConfig) GetBackupMode() BackupMode {
+	return BackupMode(viper.GetString(BACKUP_MODE))
+}
+
+func (backupConfig) GetFleetName() string {
+	return viper.GetString(FLEET_NAME)
+}
+
+func (backupConfig) GetBackupFormat() string {
+	return viper.GetString(BACKUP_FORMAT)
+}
+
+func (backupConfig) GetCompressionLevel() int {
+	return viper.GetInt(COMPRESSION_LEVEL)
+}
+
+func (backupConfig) GetSaveTimeout() time.Duration {
+	return viper.GetDuration(SAVE_TIMEOUT)
+}
+
+func (backupConfig) GetSaveMessage() string {
+	return viper.GetString(SAVE_MESSAGE)
+}
+
+func (backupConfig) GetConsoleInput() string {
+	return viper.GetString(CONSOLE_INPUT)
+}
+
+func (backupConfig) GetConsoleOutput() string {
+	return viper.GetString(CONSOLE_OUTPUT)
+}
+
+func (backupConfig) GetBackupPreset() string {
+	return viper.GetString(BACKUP_PRESET)
+}
+
+func (backupConfig) GetBackupInclude() []string {
+	return splitList(viper.GetString(BACKUP_INCLUDE))
+}
+
+func (backupConfig) GetBackupExclude() []string {
+	return splitList(viper.GetString(BACKUP_EXCLUDE))
+}
+
+func (backupConfig) GetBackupOnRequest() bool {
+	return viper.GetBool(BACKUP_ON_REQUEST)
+}
+
+func (backupConfig) GetBackupRequestAnnotation() string {
+	return viper.GetString(BACKUP_REQUEST_ANNOTATION)
+}
+
+func (backupConfig) GetBackupOnShutdown() bool {
+	return viper.GetBool(BACKUP_ON_SHUTDOWN)
+}
+
+func (backupConfig) GetFinalBackupTimeout() time.Duration {
+	return viper.GetDuration(FINAL_BACKUP_TIMEOUT)
+}
+
+func (backupConfig) GetBackupMaxConcurrent() int {
+	return viper.GetInt(BACKUP_MAX_CONCURRENT)
+}
+
+func (backupConfig) GetBackupLeaseTTL() time.Duration {
+	return viper.GetDuration(BACKUP_LEASE_TTL)
+}
+
+func (backupConfig) GetBackupLeaseWait() time.Duration {
+	return viper.GetDuration(BACKUP_LEASE_WAIT)
+}
+
+func (backupConfig) GetBackupJitter() time.Duration {
+	return viper.GetDuration(BACKUP_JITTER)
+}
+
+func (backupConfig) GetBackupSkipUnchanged() bool {
+	return viper.GetBool(BACKUP_SKIP_UNCHANGED)
+}
+
+func (backupConfig) GetBackupUnchangedIgnore() []string {
+	return splitList(viper.GetString(BACKUP_UNCHANGED_IGNORE))
+}
+
+func (backupConfig) GetBackupForceCron() string {
+	return viper.GetString(BACKUP_FORCE_CRON)
+}
+
+func (backupConfig) GetBackupStateFile() string {
+	return viper.GetString(BACKUP_STATE_FILE)
+}
+
+func (backupConfig) GetBackupStage() bool {
+	return viper.GetBool(BACKUP_STAGE)
+}
+
+func (backupConfig) GetBackupStageLinks() string {
+	return viper.GetString(BACKUP_STAGE_LINKS)
+}
+
+func (backupConfig) GetGCGracePeriod() time.Duration {
+	return viper.GetDuration(GC_GRACE_PERIOD)
+}
+
+// Splits a comma separated list. Globs may contain spaces, e.g. Bedrock world names
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 type loadConfig struct {
 	sharedConfig
 	serverConfig
+	storageConfig
+	notifyConfig
 }
 
 func NewLoadConfig() loadConfig {
 	return loadConfig{}
 }
 
-func (loadConfig) GetBucketName() string {
-	return viper.GetString(BUCKET_NAME)
+func (loadConfig) GetBackupName() string {
+	return viper.GetString(BACKUP_NAME)
 }
 
-func (loadConfig) GetBackupName() string {
+type gcConfig struct {
+	sharedConfig
+	storageConfig
+}
+
+func NewGCConfig() gcConfig {
+	return gcConfig{}
+}
+
+func (gcConfig) GetGCGracePeriod() time.Duration {
+	return viper.GetDuration(GC_GRACE_PERIOD)
+}
+
+type pruneConfig struct {
+	sharedConfig
+	storageConfig
+	retentionConfig
+	notifyConfig
+}
+
+func NewPruneConfig() pruneConfig {
+	return pruneConfig{}
+}
+
+func (pruneConfig) GetGCGracePeriod() time.Duration {
+	return viper.GetDuration(GC_GRACE_PERIOD)
+}
+
+type verifyConfig struct {
+	sharedConfig
+	serverConfig
+	storageConfig
+}
+
+func NewVerifyConfig() verifyConfig {
+	return verifyConfig{}
+}
+
+func (verifyConfig) GetBackupName() string {
 	return viper.GetString(BACKUP_NAME)
 }
 
+func (verifyConfig) GetScratchDir() string {
+	return viper.GetString(BACKUP_SCRATCH_DIR)
+}
+
+type listConfig struct {
+	sharedConfig
+	storageConfig
+}
+
+func NewListConfig() listConfig {
+	return listConfig{}
+}
+
+type copyConfig struct {
+	sharedConfig
+	storageConfig
+}
+
+func NewCopyConfig() copyConfig {
+	return copyConfig{}
+}
+
 type fileServerConfig struct{}
 
 func NewFileServerConfig() fileServerConfig {
@@ -249,12 +778,63 @@ func init() {
 	viper.SetDefault(RCON_PASSWORD, RCON_PASSWORD_DEFAULT)
 	viper.SetDefault(VOLUME, VOLUME_DEFAULT)
 	viper.SetDefault(POD_NAME, POD_NAME_DEFAULT)
+	viper.SetDefault(LEVEL_NAME, LEVEL_NAME_DEFAULT)
 	viper.SetDefault(INTERVAL, INTERVAL_DEFAULT)
 	viper.SetDefault(TIMEOUT, TIMEOUT_DEFAULT)
 	viper.SetDefault(MAX_ATTEMPTS, MAX_ATTEMPTS_DEFAULT)
 	viper.SetDefault(BUCKET_NAME, BUCKET_NAME_DEFAULT)
 	viper.SetDefault(BACKUP_CRON, BACKUP_CRON_DEFAULT)
 	viper.SetDefault(BACKUP_NAME, BACKUP_NAME_DEFAULT)
+	viper.SetDefault(BACKUP_SCRATCH_DIR, BACKUP_SCRATCH_DIR_DEFAULT)
+	viper.SetDefault(BACKUP_MODE, string(BACKUP_MODE_DEFAULT))
+	viper.SetDefault(FLEET_NAME, FLEET_NAME_DEFAULT)
+	viper.SetDefault(BACKUP_FORMAT, BACKUP_FORMAT_DEFAULT)
+	viper.SetDefault(COMPRESSION_LEVEL, COMPRESSION_LEVEL_DEFAULT)
+	viper.SetDefault(SAVE_TIMEOUT, SAVE_TIMEOUT_DEFAULT)
+	viper.SetDefault(SAVE_MESSAGE, SAVE_MESSAGE_DEFAULT)
+	viper.SetDefault(CONSOLE_INPUT, CONSOLE_INPUT_DEFAULT)
+	viper.SetDefault(CONSOLE_OUTPUT, CONSOLE_OUTPUT_DEFAULT)
+	viper.SetDefault(BACKUP_PRESET, BACKUP_PRESET_DEFAULT)
+	viper.SetDefault(BACKUP_INCLUDE, BACKUP_INCLUDE_DEFAULT)
+	viper.SetDefault(BACKUP_EXCLUDE, BACKUP_EXCLUDE_DEFAULT)
+	viper.SetDefault(BACKUP_ON_REQUEST, BACKUP_ON_REQUEST_DEFAULT)
+	viper.SetDefault(BACKUP_REQUEST_ANNOTATION, BACKUP_REQUEST_ANNOTATION_DEFAULT)
+	viper.SetDefault(BACKUP_ON_SHUTDOWN, BACKUP_ON_SHUTDOWN_DEFAULT)
+	viper.SetDefault(FINAL_BACKUP_TIMEOUT, FINAL_BACKUP_TIMEOUT_DEFAULT)
+	viper.SetDefault(BACKUP_MAX_CONCURRENT, BACKUP_MAX_CONCURRENT_DEFAULT)
+	viper.SetDefault(BACKUP_LEASE_TTL, BACKUP_LEASE_TTL_DEFAULT)
+	viper.SetDefault(BACKUP_LEASE_WAIT, BACKUP_LEASE_WAIT_DEFAULT)
+	viper.SetDefault(BACKUP_JITTER, BACKUP_JITTER_DEFAULT)
+	viper.SetDefault(BACKUP_SKIP_UNCHANGED, BACKUP_SKIP_UNCHANGED_DEFAULT)
+	viper.SetDefault(BACKUP_UNCHANGED_IGNORE, BACKUP_UNCHANGED_IGNORE_DEFAULT)
+	viper.SetDefault(BACKUP_FORCE_CRON, BACKUP_FORCE_CRON_DEFAULT)
+	viper.SetDefault(BACKUP_STATE_FILE, BACKUP_STATE_FILE_DEFAULT)
+	viper.SetDefault(BACKUP_STAGE, BACKUP_STAGE_DEFAULT)
+	viper.SetDefault(BACKUP_STAGE_LINKS, BACKUP_STAGE_LINKS_DEFAULT)
+	viper.SetDefault(GC_GRACE_PERIOD, GC_GRACE_PERIOD_DEFAULT)
+	viper.SetDefault(RETENTION_KEEP_LAST, RETENTION_KEEP_LAST_DEFAULT)
+	viper.SetDefault(RETENTION_KEEP_DAILY, RETENTION_KEEP_DAILY_DEFAULT)
+	viper.SetDefault(RETENTION_KEEP_WEEKLY, RETENTION_KEEP_WEEKLY_DEFAULT)
+	viper.SetDefault(RETENTION_KEEP_MONTHLY, RETENTION_KEEP_MONTHLY_DEFAULT)
+	viper.SetDefault(RETENTION_MAX_AGE, RETENTION_MAX_AGE_DEFAULT)
+	viper.SetDefault(BACKUP_DESTINATION, BACKUP_DESTINATION_DEFAULT)
+	viper.SetDefault(ENCRYPTION_KEY_FILE, ENCRYPTION_KEY_FILE_DEFAULT)
+	viper.SetDefault(STORAGE_TIMEOUT, STORAGE_TIMEOUT_DEFAULT)
+	viper.SetDefault(STORAGE_RETRIES, STORAGE_RETRIES_DEFAULT)
+	viper.SetDefault(STORAGE_RETRY_BACKOFF, STORAGE_RETRY_BACKOFF_DEFAULT)
+	viper.SetDefault(BACKUP_REPLICAS, BACKUP_REPLICAS_DEFAULT)
+	viper.SetDefault(REPLICATION_POLICY, REPLICATION_POLICY_DEFAULT)
+	viper.SetDefault(STORAGE_PROVIDER, string(STORAGE_PROVIDER_DEFAULT))
+	viper.SetDefault(S3_ENDPOINT, S3_ENDPOINT_DEFAULT)
+	viper.SetDefault(S3_REGION, S3_REGION_DEFAULT)
+	viper.SetDefault(S3_PATH_STYLE, S3_PATH_STYLE_DEFAULT)
+	viper.SetDefault(BACKUP_DIR, BACKUP_DIR_DEFAULT)
+	viper.SetDefault(WEBHOOK_URLS, WEBHOOK_URLS_DEFAULT)
+	viper.SetDefault(WEBHOOK_FORMAT, WEBHOOK_FORMAT_DEFAULT)
+	viper.SetDefault(WEBHOOK_TEMPLATE, WEBHOOK_TEMPLATE_DEFAULT)
+	viper.SetDefault(WEBHOOK_EVENTS, WEBHOOK_EVENTS_DEFAULT)
+	viper.SetDefault(WEBHOOK_TIMEOUT, WEBHOOK_TIMEOUT_DEFAULT)
+	viper.SetDefault(WEBHOOK_RETRIES, WEBHOOK_RETRIES_DEFAULT)
 
 	viper.AutomaticEnv()
 }
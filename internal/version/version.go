@@ -0,0 +1,5 @@
+package version
+
+// agones-mc version. Set at build time with
+// -ldflags "-X github.com/saulmaldonado/agones-mc/internal/version.Version=<version>"
+var Version = "dev"
@@ -1,6 +1,13 @@
 package main
 
-import "github.com/saulmaldonado/agones-mc/cmd"
+import (
+	"github.com/saulmaldonado/agones-mc/cmd"
+
+	// storage backends register themselves for their destination URL scheme
+	_ "github.com/saulmaldonado/agones-mc/pkg/backup/google"
+	_ "github.com/saulmaldonado/agones-mc/pkg/backup/local"
+	_ "github.com/saulmaldonado/agones-mc/pkg/backup/s3"
+)
 
 func main() {
 	cmd.Execute()
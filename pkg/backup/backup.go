@@ -2,55 +2,175 @@ package backup
 
 import (
 	"archive/zip"
+	"compress/flate"
+	"context"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
+	"time"
 )
 
 const ZipContentType string = "application/zip"
 
 type BackupClient interface {
-	Load(name, targetVol string) error
-	Backup(file *os.File) error
+	// Downloads the named backup into w
+	Load(ctx context.Context, name string, w io.Writer) error
+	// Uploads the backup read from r until EOF under the given name
+	Backup(ctx context.Context, name string, r io.Reader) error
+	// Lists stored objects whose names start with prefix
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// Deletes the named object
+	Delete(ctx context.Context, name string) error
 	Close() error
 }
 
-func Zipit(source, target string) error {
-	zipfile, err := os.Create(target)
-	if err != nil {
-		return err
+// Implemented by clients that can download an object from an offset, so interrupted downloads are resumed
+// where they stopped instead of starting over
+type RangeLoader interface {
+	// Downloads the named backup from offset into w
+	LoadRange(ctx context.Context, name string, offset int64, w io.Writer) error
+}
+
+// Returned by conditional writes when the object was created or changed since it was read
+var ErrPreconditionFailed = errors.New("object was modified concurrently")
+
+// Implemented by clients that can replace a small object only if it did not change since it was read, e.g. with
+// generation or ETag preconditions. Servers sharing a destination coordinate through such objects
+type ConditionalWriter interface {
+	// Reads the named object and its generation. Returns ErrNotExist if the object does not exist
+	ReadObject(ctx context.Context, name string) (data []byte, generation string, err error)
+	// Writes the named object if its generation is still generation, or if it does not exist when generation
+	// is empty. Returns the object's new generation, or ErrPreconditionFailed if the object changed
+	WriteObject(ctx context.Context, name string, data []byte, generation string) (string, error)
+}
+
+// Returns client, or the client it wraps, as a ConditionalWriter
+func ConditionalWriterOf(client BackupClient) (ConditionalWriter, bool) {
+	for client != nil {
+		if c, ok := client.(ConditionalWriter); ok {
+			return c, true
+		}
+
+		u, ok := client.(interface{ Unwrap() BackupClient })
+		if !ok {
+			break
+		}
+
+		client = u.Unwrap()
+	}
+
+	return nil, false
+}
+
+// Stored backup object. Names are relative to the client's destination prefix
+type Object struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+}
+
+// Totals for the files written into an archive
+type ArchiveStats struct {
+	Files            int
+	UncompressedSize int64
+}
+
+// World directory to archive
+type World struct {
+	// Directory name of the world in the archive and in the worlds directory it is restored into.
+	// The files of a world with an empty name are archived at the root of the archive
+	Name string
+	// Path of the world directory to archive
+	Path string
+	// Selects the files to archive by their archive entry name. nil archives every file
+	Select func(name string, dir bool) Selection
+}
+
+// Reports whether the file with the given entry name is archived. Returns filepath.SkipDir for excluded directories
+func (w World) selects(name string, info os.FileInfo) (bool, error) {
+	// root of a world archived without a directory
+	if name == "." {
+		return false, nil
 	}
 
-	defer zipfile.Close()
+	if w.Select == nil {
+		return true, nil
+	}
+
+	switch w.Select(name, info.IsDir()) {
+	case Include:
+		return true, nil
+	case Exclude:
+		if info.IsDir() {
+			return false, filepath.SkipDir
+		}
+	}
 
-	archive := zip.NewWriter(zipfile)
-	defer archive.Close()
+	return false, nil
+}
 
-	info, err := os.Stat(source)
+// Returns the world of a single directory, archived under its base name
+func worldOf(source string) []World {
+	return []World{{Name: filepath.Base(source), Path: source}}
+}
+
+// Writes a zip archive of source into target
+func Zipit(source string, target io.Writer) (*ArchiveStats, error) {
+	return zipit(worldOf(source), target, DefaultCompressionLevel)
+}
+
+func zipit(worlds []World, target io.Writer, level int) (*ArchiveStats, error) {
+	level, err := deflateLevel(level)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
-	var baseDir string
-	if info.IsDir() {
-		baseDir = filepath.Base(source)
+	stats := &ArchiveStats{}
+
+	archive := zip.NewWriter(target)
+	archive.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, level)
+	})
+
+	for _, world := range worlds {
+		if err := zipWorld(archive, world, stats); err != nil {
+			return nil, err
+		}
 	}
 
-	err = filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+	// Close writes the zip central directory
+	return stats, archive.Close()
+}
+
+// Adds the files of world to the archive under the world's name
+func zipWorld(archive *zip.Writer, world World, stats *ArchiveStats) error {
+	return filepath.Walk(world.Path, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		header, err := zip.FileInfoHeader(info)
+		// sockets, symlinks and other special files are not part of a world
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+
+		name, err := entryName(world, path)
 		if err != nil {
 			return err
 		}
 
-		if baseDir != "" {
-			header.Name = filepath.Join(baseDir, strings.TrimPrefix(path, source))
+		if ok, err := world.selects(name, info); !ok {
+			return err
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
 		}
 
+		header.Name = name
+
 		if info.IsDir() {
 			header.Name += "/"
 		} else {
@@ -73,9 +193,19 @@ func Zipit(source, target string) error {
 
 		defer file.Close()
 
-		_, err = io.Copy(writer, file)
+		n, err := io.Copy(writer, file)
+		stats.Files++
+		stats.UncompressedSize += n
 		return err
 	})
+}
+
+// Returns the slash separated archive entry name of the file at path in world
+func entryName(world World, path string) (string, error) {
+	rel, err := filepath.Rel(world.Path, path)
+	if err != nil {
+		return "", err
+	}
 
-	return err
+	return filepath.ToSlash(filepath.Join(world.Name, rel)), nil
 }
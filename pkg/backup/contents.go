@@ -0,0 +1,108 @@
+package backup
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Archive layouts
+const (
+	// Entries are relative to the directory the server's worlds are stored in and each world is
+	// under a top level directory. Backups of only the server's worlds use this layout
+	WorldsLayout = "worlds"
+	// Entries are relative to the server's data directory
+	VolumeLayout = "volume"
+)
+
+// Selection of a file or directory by Contents
+type Selection int
+
+const (
+	// Archive the file, or the directory and everything in it that is not excluded
+	Include Selection = iota
+	// Skip the file, or the directory and everything in it
+	Exclude
+	// Skip the directory itself but archive the files in it that are included
+	Descend
+)
+
+// Files to back up, selected by include and exclude globs matched against slash separated paths relative
+// to the server's data directory. A glob selects the path it matches and everything under it. Globs are
+// matched segment by segment like path.Match, and a ** segment matches any number of segments. Slashes around
+// a glob are ignored, so logs/ selects the logs directory. Excludes take precedence over includes
+type Contents struct {
+	// Preset the globs were taken from, if any
+	Preset  string   `json:"preset,omitempty"`
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// Returns an error for the first malformed glob
+func (c *Contents) Validate() error {
+	for _, glob := range append(append([]string{}, c.Include...), c.Exclude...) {
+		for _, segment := range strings.Split(glob, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return fmt.Errorf("invalid glob %q: %w", glob, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Selects the file or directory at the slash separated path p
+func (c *Contents) Select(p string, dir bool) Selection {
+	switch {
+	case matchAny(c.Exclude, p):
+		return Exclude
+	case matchAny(c.Include, p):
+		return Include
+	case dir:
+		// files further down may be included
+		return Descend
+	default:
+		return Exclude
+	}
+}
+
+// Reports whether any glob matches p or one of its parent directories
+func matchAny(globs []string, p string) bool {
+	name := strings.Split(path.Clean(p), "/")
+
+	for _, glob := range globs {
+		pattern := strings.Split(strings.Trim(glob, "/"), "/")
+		for i := 1; i <= len(name); i++ {
+			if matchSegments(pattern, name[:i]) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
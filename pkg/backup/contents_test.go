@@ -0,0 +1,151 @@
+package backup
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchAny(t *testing.T) {
+	tests := []struct {
+		glob string
+		path string
+		want bool
+	}{
+		{"world", "world", true},
+		{"world", "world/region/r.0.0.mca", true},
+		{"world", "world_nether", false},
+		{"world", "worlds/world", false},
+		{"*.json", "ops.json", true},
+		{"*.json", "config/mod.json", false},
+		{"w?rld", "world", true},
+		{"[a-c]*", "banned-ips.json", true},
+
+		// ** at the start
+		{"**/session.lock", "session.lock", true},
+		{"**/session.lock", "world/session.lock", true},
+		{"**/session.lock", "worlds/survival/session.lock", true},
+		{"**/session.lock", "world/session.lock.bak", false},
+		{"**/.tmp-*", "world/region/.tmp-r.0.0.mca", true},
+
+		// ** in the middle
+		{"plugins/**/*.yml", "plugins/config.yml", true},
+		{"plugins/**/*.yml", "plugins/dynmap/config.yml", true},
+		{"plugins/**/*.yml", "plugins/dynmap/web/config.yml", true},
+		{"plugins/**/*.yml", "plugins/dynmap.jar", false},
+		{"plugins/**/*.yml", "config.yml", false},
+		{"plugins/**/*.yml", "mods/plugins/config.yml", false},
+
+		// ** at the end
+		{"plugins/**", "plugins", true},
+		{"plugins/**", "plugins/dynmap/config.yml", true},
+		{"plugins/**", "plugins2/config.yml", false},
+		{"**", "world/level.dat", true},
+		{"**", "server.properties", true},
+
+		// trailing and leading slashes
+		{"logs/", "logs", true},
+		{"logs/", "logs/latest.log", true},
+		{"logs/", "logs2/latest.log", false},
+		{"plugins/dynmap/web/", "plugins/dynmap/web/tiles/0.png", true},
+		{"/world", "world/level.dat", true},
+
+		// paths are cleaned
+		{"world", "world/", true},
+		{"world", "./world/level.dat", true},
+
+		// malformed globs match nothing
+		{"[a", "a", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchAny([]string{tt.glob}, tt.path); got != tt.want {
+			t.Errorf("matchAny(%q, %q) = %v, want %v", tt.glob, tt.path, got, tt.want)
+		}
+	}
+
+	if matchAny(nil, "world") {
+		t.Error("matchAny without globs matched")
+	}
+
+	if !matchAny([]string{"logs", "world"}, "world/level.dat") {
+		t.Error("matchAny did not match the second glob")
+	}
+}
+
+func TestMatchSegments(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/b", "a", false},
+		{"a", "a/b", false},
+		{"**", "", true},
+		{"**/**", "a/b/c", true},
+		{"a/**/b/**/c", "a/x/b/y/z/c", true},
+		{"a/**/b/**/c", "a/x/c", false},
+		{"a/**", "a", true},
+		{"**/c", "a/b", false},
+	}
+
+	for _, tt := range tests {
+		var name []string
+		if tt.name != "" {
+			name = strings.Split(tt.name, "/")
+		}
+
+		if got := matchSegments(strings.Split(tt.pattern, "/"), name); got != tt.want {
+			t.Errorf("matchSegments(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestContentsSelect(t *testing.T) {
+	c := &Contents{
+		Include: []string{"world", "plugins/**/*.yml", "logs/latest.log"},
+		Exclude: []string{"**/session.lock", "plugins/dynmap", "logs"},
+	}
+
+	tests := []struct {
+		path string
+		dir  bool
+		want Selection
+	}{
+		{"world", true, Include},
+		{"world/region/r.0.0.mca", false, Include},
+		{"plugins/config.yml", false, Include},
+		{"plugins/essentials/config.yml", false, Include},
+		// directories that may have included files in them are descended into
+		{"plugins", true, Descend},
+		{"plugins/essentials", true, Descend},
+		{"plugins/essentials.jar", false, Exclude},
+		{"server.jar", false, Exclude},
+
+		// excludes override includes
+		{"world/session.lock", false, Exclude},
+		{"plugins/dynmap", true, Exclude},
+		{"plugins/dynmap/config.yml", false, Exclude},
+		{"logs", true, Exclude},
+		{"logs/latest.log", false, Exclude},
+	}
+
+	for _, tt := range tests {
+		if got := c.Select(tt.path, tt.dir); got != tt.want {
+			t.Errorf("Select(%q, %v) = %v, want %v", tt.path, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestContentsValidate(t *testing.T) {
+	valid := &Contents{Include: []string{"world", "**/*.yml", "logs/", "[a-z]*"}, Exclude: []string{"**/session.lock"}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate = %v", err)
+	}
+
+	for _, contents := range []*Contents{{Include: []string{"world", "[a"}}, {Exclude: []string{`plugins/\`}}} {
+		if err := contents.Validate(); err == nil {
+			t.Errorf("Validate of %+v succeeded", *contents)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Copies the named object from src to dst as it is stored, e.g. still encrypted, and returns its size
+func Copy(ctx context.Context, src, dst BackupClient, name string) (int64, error) {
+	pr, pw := io.Pipe()
+
+	go func() {
+		pw.CloseWithError(src.Load(ctx, name, pw))
+	}()
+
+	cr := &countReader{r: pr}
+	err := dst.Backup(ctx, name, cr)
+
+	// unblocks the download if the upload stopped early
+	pr.CloseWithError(errCopyStopped)
+
+	return cr.n, err
+}
+
+var errCopyStopped = errors.New("copy stopped")
+
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,220 @@
+// Package crypt provides client-side authenticated encryption of backups
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+)
+
+// Algorithm recorded in backup manifests
+const Algorithm = "aes-256-gcm-stream"
+
+// Size of master keys in bytes
+const KeySize = 32
+
+// Master encryption key
+type Key struct {
+	key []byte
+	id  [keyIDSize]byte
+}
+
+// Creates a key from 32 bytes of key material
+func NewKey(key []byte) (*Key, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("crypt: key is %d bytes, expected %d", len(key), KeySize)
+	}
+
+	k := &Key{key: key}
+	sum := sha256.Sum256(key)
+	copy(k.id[:], sum[:])
+
+	return k, nil
+}
+
+// Hex ID of the key. The ID is a truncated SHA-256 of the key so it identifies the key without revealing it
+func (k *Key) ID() string {
+	return hex.EncodeToString(k.id[:])
+}
+
+// Reads the keys in a key file. Each non-empty line that is not a # comment is a base64 encoded 32 byte key.
+// The first key encrypts new backups and every key can decrypt, so keys are rotated by adding a new
+// key at the top of the file and keeping old keys below it for as long as their backups are kept
+func ReadKeyFile(path string) ([]*Key, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*Key
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		raw, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, fmt.Errorf("crypt: invalid key on line %d of %s: %w", i+1, path, err)
+		}
+
+		key, err := NewKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("crypt: invalid key on line %d of %s: %w", i+1, path, err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("crypt: no keys in %s", path)
+	}
+
+	return keys, nil
+}
+
+// Backup client that encrypts backups before they are uploaded and decrypts them when loaded.
+// Manifests are stored unencrypted so backups can be listed and identified without keys.
+// Objects that are not encrypted are loaded as they are so backups made before encryption
+// was enabled stay loadable, unless they are required to be encrypted with RequireEncrypted
+type Client struct {
+	backup.BackupClient
+	keys []*Key
+	// Object that fails to load if it is not encrypted
+	required string
+}
+
+// Wraps client. keys[0] encrypts new backups
+func NewClient(client backup.BackupClient, keys []*Key) (*Client, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("crypt: no keys")
+	}
+
+	return &Client{BackupClient: client, keys: keys}, nil
+}
+
+// Returns a client that fails to load the named object with ErrNotEncrypted if it is not encrypted, e.g. a backup
+// whose manifest records a key, so a backup replaced with plaintext is not loaded as it is. Other objects, e.g.
+// snapshot chunks stored before encryption was enabled and checked against their hash, still load unencrypted
+func (c *Client) RequireEncrypted(name string) *Client {
+	return &Client{BackupClient: c.BackupClient, keys: c.keys, required: name}
+}
+
+// Reports whether the client has the key with the given ID
+func (c *Client) HasKey(id string) bool {
+	for _, key := range c.keys {
+		if key.ID() == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ID of the key new backups are encrypted with
+func (c *Client) KeyID() string {
+	return c.keys[0].ID()
+}
+
+// The wrapped client
+func (c *Client) Unwrap() backup.BackupClient {
+	return c.BackupClient
+}
+
+// Encrypts the backup read from r and uploads it. The encrypted backup can be read again for
+// retries if r is an io.Seeker
+func (c *Client) Backup(ctx context.Context, name string, r io.Reader) error {
+	if backup.IsManifest(name) {
+		return c.BackupClient.Backup(ctx, name, r)
+	}
+
+	er, err := newSeekableEncryptReader(r, c.keys[0])
+	if err != nil {
+		return err
+	}
+
+	return c.BackupClient.Backup(ctx, name, er)
+}
+
+// Downloads the backup and writes its plaintext into w
+func (c *Client) Load(ctx context.Context, name string, w io.Writer) error {
+	pr, pw := io.Pipe()
+
+	go func() {
+		pw.CloseWithError(c.BackupClient.Load(ctx, name, pw))
+	}()
+
+	err := c.decrypt(pr, w, name == c.required)
+
+	// unblocks the download if decryption stopped early
+	pr.CloseWithError(err)
+
+	return err
+}
+
+func (c *Client) decrypt(r io.Reader, w io.Writer, required bool) error {
+	br := bufio.NewReaderSize(r, SegmentSize+tagSize)
+
+	header, err := br.Peek(headerSize)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	if !bytes.HasPrefix(header, magic) {
+		if required {
+			return ErrNotEncrypted
+		}
+
+		_, err := io.Copy(w, br)
+		return err
+	}
+
+	if len(header) < headerSize {
+		return fmt.Errorf("%w: truncated header", ErrAuth)
+	}
+
+	if version := header[len(magic)]; version != formatVersion {
+		return fmt.Errorf("crypt: unsupported format version %d", version)
+	}
+
+	header = append([]byte(nil), header...)
+	br.Discard(headerSize)
+
+	key := c.key(header[len(magic)+1 : len(magic)+1+keyIDSize])
+	if key == nil {
+		return fmt.Errorf("crypt: no key with ID %x", header[len(magic)+1:len(magic)+1+keyIDSize])
+	}
+
+	dr, err := newDecryptReader(br, header, key)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, dr)
+	return err
+}
+
+func (c *Client) key(id []byte) *Key {
+	for _, key := range c.keys {
+		if bytes.Equal(key.id[:], id) {
+			return key
+		}
+	}
+	return nil
+}
+
+// Returns the ID of the key new backups are encrypted with, or "" if client does not encrypt
+func KeyID(client backup.BackupClient) string {
+	if c, ok := client.(*Client); ok {
+		return c.KeyID()
+	}
+	return ""
+}
@@ -0,0 +1,255 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+	"github.com/saulmaldonado/agones-mc/pkg/backup/local"
+)
+
+func newTestKey(t *testing.T) *Key {
+	raw := make([]byte, KeySize)
+	if _, err := rand.Read(raw); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := NewKey(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func encrypt(t *testing.T, plain []byte, key *Key) []byte {
+	er, err := newEncryptReader(bytes.NewReader(plain), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := ioutil.ReadAll(er)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sealed
+}
+
+func decrypt(c *Client, sealed []byte) ([]byte, error) {
+	var out bytes.Buffer
+	err := c.decrypt(bytes.NewReader(sealed), &out, false)
+	return out.Bytes(), err
+}
+
+func TestRoundTrip(t *testing.T) {
+	key := newTestKey(t)
+	c, err := NewClient(nil, []*Key{key})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sizes := []int{0, 1, SegmentSize - 1, SegmentSize, SegmentSize + 1, 3 * SegmentSize}
+
+	for _, size := range sizes {
+		plain := make([]byte, size)
+		rand.Read(plain)
+
+		sealed := encrypt(t, plain, key)
+
+		segments := (size + SegmentSize - 1) / SegmentSize
+		if segments == 0 {
+			segments = 1
+		}
+
+		if want := headerSize + size + segments*tagSize; len(sealed) != want {
+			t.Errorf("%d bytes: encrypted to %d bytes, want %d", size, len(sealed), want)
+		}
+
+		got, err := decrypt(c, sealed)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+
+		if !bytes.Equal(got, plain) {
+			t.Fatalf("%d bytes: decrypted plaintext differs", size)
+		}
+	}
+}
+
+func TestDecryptTruncated(t *testing.T) {
+	key := newTestKey(t)
+	c, _ := NewClient(nil, []*Key{key})
+
+	plain := make([]byte, 2*SegmentSize+100)
+	sealed := encrypt(t, plain, key)
+
+	lengths := map[string]int{
+		"header":           headerSize - 1,
+		"first segment":    headerSize + 10,
+		"segment boundary": headerSize + SegmentSize + tagSize,
+		"last segment":     len(sealed) - 1,
+	}
+
+	for name, n := range lengths {
+		if _, err := decrypt(c, sealed[:n]); !errors.Is(err, ErrAuth) {
+			t.Errorf("truncated in %s: err = %v, want ErrAuth", name, err)
+		}
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+	key := newTestKey(t)
+	c, _ := NewClient(nil, []*Key{key})
+
+	plain := make([]byte, 2*SegmentSize)
+	sealed := encrypt(t, plain, key)
+
+	offsets := map[string]int{
+		"salt":       headerSize - 1,
+		"ciphertext": headerSize + 1,
+		"tag":        headerSize + SegmentSize + tagSize - 1,
+		"last":       len(sealed) - 1,
+	}
+
+	for name, i := range offsets {
+		tampered := append([]byte(nil), sealed...)
+		tampered[i] ^= 1
+
+		if _, err := decrypt(c, tampered); !errors.Is(err, ErrAuth) {
+			t.Errorf("tampered %s: err = %v, want ErrAuth", name, err)
+		}
+	}
+
+	// swapped segments fail since the counter is part of the nonce
+	swapped := append([]byte(nil), sealed[:headerSize]...)
+	swapped = append(swapped, sealed[headerSize+SegmentSize+tagSize:]...)
+	swapped = append(swapped, sealed[headerSize:headerSize+SegmentSize+tagSize]...)
+
+	if _, err := decrypt(c, swapped); !errors.Is(err, ErrAuth) {
+		t.Errorf("swapped segments: err = %v, want ErrAuth", err)
+	}
+
+	other, _ := NewClient(nil, []*Key{newTestKey(t)})
+	if _, err := decrypt(other, sealed); err == nil {
+		t.Error("decrypted with an unknown key")
+	}
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := local.New(filepath.Join(t.TempDir(), "backups"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, rotated := newTestKey(t), newTestKey(t)
+
+	c, err := NewClient(store, []*Key{old})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := bytes.Repeat([]byte("world"), SegmentSize)
+	if err := c.Backup(ctx, "a.zip", bytes.NewReader(plain)); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored bytes.Buffer
+	if err := store.Load(ctx, "a.zip", &stored); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(stored.Bytes(), magic) || bytes.Contains(stored.Bytes(), []byte("worldworld")) {
+		t.Fatal("backup was stored unencrypted")
+	}
+
+	// backups encrypted with an old key stay loadable after rotation
+	c, _ = NewClient(store, []*Key{rotated, old})
+
+	var out bytes.Buffer
+	if err := c.Load(ctx, "a.zip", &out); err != nil || !bytes.Equal(out.Bytes(), plain) {
+		t.Fatalf("Load = %d bytes, %v", out.Len(), err)
+	}
+
+	if !c.HasKey(old.ID()) || c.HasKey(newTestKey(t).ID()) {
+		t.Fatal("HasKey does not match the client's keys")
+	}
+
+	// plaintext objects load as they are unless they are required to be encrypted
+	if err := store.Backup(ctx, "b.zip", bytes.NewReader([]byte("plain"))); err != nil {
+		t.Fatal(err)
+	}
+
+	out.Reset()
+	if err := c.Load(ctx, "b.zip", &out); err != nil || out.String() != "plain" {
+		t.Fatalf("Load of a plaintext object = %q, %v", out.Bytes(), err)
+	}
+
+	if err := c.RequireEncrypted("b.zip").Load(ctx, "b.zip", ioutil.Discard); !errors.Is(err, ErrNotEncrypted) {
+		t.Fatalf("Load of a required plaintext object = %v, want ErrNotEncrypted", err)
+	}
+
+	if err := c.RequireEncrypted("a.zip").Load(ctx, "a.zip", ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Load(ctx, "missing.zip", ioutil.Discard); !errors.Is(err, backup.ErrNotExist) {
+		t.Fatalf("Load of a missing object = %v, want ErrNotExist", err)
+	}
+}
+
+func TestSeekableEncryptReader(t *testing.T) {
+	key := newTestKey(t)
+	c, _ := NewClient(nil, []*Key{key})
+
+	plain := bytes.Repeat([]byte("x"), SegmentSize+1)
+
+	r, err := newSeekableEncryptReader(bytes.NewReader(plain), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		t.Fatal("encrypting reader of a seeker is not a seeker")
+	}
+
+	// a retried upload reads the whole object again
+	if _, err := io.CopyN(ioutil.Discard, r, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := decrypt(c, sealed)
+	if err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("decrypted %d bytes, %v", len(got), err)
+	}
+
+	if _, ok := mustEncryptReader(t, io.MultiReader(bytes.NewReader(plain)), key).(io.Seeker); ok {
+		t.Fatal("encrypting reader of a stream is a seeker")
+	}
+}
+
+func mustEncryptReader(t *testing.T, r io.Reader, key *Key) io.Reader {
+	er, err := newSeekableEncryptReader(r, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return er
+}
@@ -0,0 +1,253 @@
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Encrypted objects are a header followed by segments of up to SegmentSize bytes of plaintext sealed with
+// AES-256-GCM. Each object is encrypted with a key derived from the master key and a random salt so the
+// segment counter can be used as nonce. The last segment is marked in its nonce so truncated objects fail
+// to decrypt, and the header is authenticated as additional data of every segment
+//
+//   header:  magic (4) | version (1) | key ID (8) | salt (32)
+//   segment: ciphertext (<= SegmentSize) | GCM tag (16)
+//   nonce:   segment counter, big endian (11) | 1 for the last segment else 0 (1)
+
+const (
+	// Plaintext bytes per encrypted segment
+	SegmentSize = 64 << 10
+
+	formatVersion = 1
+	magicSize     = 4
+	keyIDSize     = 8
+	saltSize      = 32
+	headerSize    = magicSize + 1 + keyIDSize + saltSize
+	tagSize       = 16
+)
+
+// Prefix of every encrypted object
+var magic = []byte("AMCE")
+
+// Returned when an encrypted object fails authentication
+var ErrAuth = errors.New("crypt: message authentication failed")
+
+// Returned when an object required to be encrypted is not
+var ErrNotEncrypted = errors.New("crypt: object is not encrypted")
+
+// Reader encrypting the plaintext read from r
+type encryptReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	header  []byte
+	counter uint64
+	buf     bytes.Buffer
+	plain   []byte
+	done    bool
+}
+
+// Returns a reader of the encrypted form of r
+func newEncryptReader(r io.Reader, key *Key) (io.Reader, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	header = append(header, formatVersion)
+	header = append(header, key.id[:]...)
+	header = append(header, salt...)
+
+	aead, err := newAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &encryptReader{r: bufio.NewReaderSize(r, SegmentSize), aead: aead, header: header, plain: make([]byte, SegmentSize)}
+	e.buf.Write(header)
+
+	return e, nil
+}
+
+func (e *encryptReader) Read(p []byte) (int, error) {
+	for e.buf.Len() == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+
+		if err := e.sealSegment(); err != nil {
+			return 0, err
+		}
+	}
+
+	return e.buf.Read(p)
+}
+
+func (e *encryptReader) sealSegment() error {
+	n, err := io.ReadFull(e.r, e.plain)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	// a full segment is the last one if nothing follows it
+	last := err != nil
+	if !last {
+		if _, err := e.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	e.buf.Write(e.aead.Seal(nil, nonce(e.counter, last), e.plain[:n], e.header))
+	e.counter++
+	e.done = last
+
+	return nil
+}
+
+// Encrypting reader of a plaintext that can be read again. Seeking to the start encrypts the plaintext
+// again from its start with a new salt, so uploads of encrypted backups can be retried
+type seekableEncryptReader struct {
+	io.Reader
+	source io.Seeker
+	start  int64
+	key    *Key
+}
+
+// Returns an encrypting reader of r that is an io.Seeker if r is one
+func newSeekableEncryptReader(r io.Reader, key *Key) (io.Reader, error) {
+	er, err := newEncryptReader(r, key)
+	if err != nil {
+		return nil, err
+	}
+
+	source, ok := r.(io.Seeker)
+	if !ok {
+		return er, nil
+	}
+
+	start, err := source.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return er, nil
+	}
+
+	return &seekableEncryptReader{er, source, start, key}, nil
+}
+
+// Only seeking to the start, or reporting the start as the current offset, is supported
+func (s *seekableEncryptReader) Seek(offset int64, whence int) (int64, error) {
+	if offset != 0 || whence == io.SeekEnd {
+		return 0, fmt.Errorf("crypt: encrypted stream can only be read again from its start")
+	}
+
+	if whence == io.SeekCurrent {
+		return 0, nil
+	}
+
+	if _, err := s.source.Seek(s.start, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	er, err := newEncryptReader(s.source.(io.Reader), s.key)
+	if err != nil {
+		return 0, err
+	}
+
+	s.Reader = er
+	return 0, nil
+}
+
+// Reader decrypting the encrypted object read from r
+type decryptReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	header  []byte
+	counter uint64
+	buf     bytes.Buffer
+	sealed  []byte
+	done    bool
+}
+
+// Returns a reader of the plaintext of the encrypted object read from r, whose header has already been read
+func newDecryptReader(r *bufio.Reader, header []byte, key *Key) (io.Reader, error) {
+	aead, err := newAEAD(key, header[headerSize-saltSize:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptReader{r: r, aead: aead, header: header, sealed: make([]byte, SegmentSize+tagSize)}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for d.buf.Len() == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+
+		if err := d.openSegment(); err != nil {
+			return 0, err
+		}
+	}
+
+	return d.buf.Read(p)
+}
+
+func (d *decryptReader) openSegment() error {
+	n, err := io.ReadFull(d.r, d.sealed)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	last := err != nil
+	if !last {
+		if _, err := d.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	plain, err := d.aead.Open(nil, nonce(d.counter, last), d.sealed[:n], d.header)
+	if err != nil {
+		return fmt.Errorf("%w in segment %d", ErrAuth, d.counter)
+	}
+
+	d.buf.Write(plain)
+	d.counter++
+	d.done = last
+
+	return nil
+}
+
+// Derives the object key from the master key and the object's salt
+func newAEAD(key *Key, salt []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, key.key)
+	mac.Write(salt)
+
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func nonce(counter uint64, last bool) []byte {
+	n := make([]byte, 12)
+	binary.BigEndian.PutUint64(n[3:11], counter)
+	if last {
+		n[11] = 1
+	}
+	return n
+}
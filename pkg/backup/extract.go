@@ -0,0 +1,517 @@
+package backup
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// World data file present at the root of both Java and Bedrock worlds
+const levelDat = "level.dat"
+
+// Extracts a zip archive of a world into the target world directory.
+//
+// Archives created by Zipit contain the world under a single top level directory (e.g. world/level.dat)
+// while others may have the world files at the root of the archive (level.dat). In both cases the world
+// root is extracted into target. The world is extracted into a temp directory next to target first and
+// then replaces any existing world so a failed extraction never leaves a partial world behind
+func Unzip(source, target string) error {
+	r, err := zip.OpenReader(source)
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	return unzipDir(r, worldRoot(r.File), target)
+}
+
+// Extracts the entries under the archive path prefix root into target
+func unzipDir(r *zip.ReadCloser, root, target string) error {
+	parent := filepath.Dir(target)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempDir(parent, ".tmp-"+filepath.Base(target))
+	if err != nil {
+		return err
+	}
+
+	defer os.RemoveAll(tmp)
+
+	type dirAttrs struct {
+		path    string
+		perm    os.FileMode
+		modTime time.Time
+	}
+	var dirs []dirAttrs
+
+	for _, f := range r.File {
+		if !strings.HasPrefix(f.Name, root) {
+			continue
+		}
+
+		name := strings.TrimPrefix(f.Name, root)
+		if name == "" {
+			continue
+		}
+
+		dest, err := securePath(tmp, name)
+		if err != nil {
+			return err
+		}
+
+		mode := f.Mode()
+
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirAttrs{dest, mode.Perm(), f.Modified})
+			continue
+		case !mode.IsRegular():
+			return fmt.Errorf("unsupported file type %v for %q in archive", mode.Type(), f.Name)
+		}
+
+		if err := extractFile(f, dest); err != nil {
+			return err
+		}
+	}
+
+	// directory permissions and mtimes are applied last since extracting files into them changes their mtime
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(dirs[i].path, dirs[i].perm); err != nil {
+			return err
+		}
+
+		if err := os.Chtimes(dirs[i].path, dirs[i].modTime, dirs[i].modTime); err != nil {
+			return err
+		}
+	}
+
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, target)
+}
+
+// Reads every file in a zip archive of a world to EOF, which verifies its CRC-32, and passes its contents
+// to fn. Names are slash separated and relative to the world root
+func WalkZip(source string, fn func(name string, r io.Reader) error) error {
+	r, err := zip.OpenReader(source)
+	if err != nil {
+		return &CorruptArchiveError{Err: err}
+	}
+
+	defer r.Close()
+
+	root := worldRoot(r.File)
+
+	for _, f := range r.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+
+		if err := walkZipFile(f, strings.TrimPrefix(f.Name, root), fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func walkZipFile(f *zip.File, name string, fn func(name string, r io.Reader) error) error {
+	rc, err := f.Open()
+	if err != nil {
+		return &CorruptArchiveError{f.Name, err}
+	}
+
+	defer rc.Close()
+
+	r := &archiveReader{rc, f.Name}
+
+	if err := fn(name, r); err != nil {
+		return err
+	}
+
+	// fn may not read the whole file. The checksum is only verified at EOF
+	_, err = io.Copy(ioutil.Discard, r)
+	return err
+}
+
+// Error reading an archive or one of its entries, e.g. a CRC-32 mismatch or invalid compressed data
+type CorruptArchiveError struct {
+	Name string
+	Err  error
+}
+
+func (e *CorruptArchiveError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("corrupt archive: %s", e.Err)
+	}
+	return fmt.Sprintf("corrupt archive entry %q: %s", e.Name, e.Err)
+}
+
+func (e *CorruptArchiveError) Unwrap() error {
+	return e.Err
+}
+
+// Reader of an archive entry returning read errors as *CorruptArchiveError
+type archiveReader struct {
+	r    io.Reader
+	name string
+}
+
+func (a *archiveReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = &CorruptArchiveError{a.name, err}
+	}
+	return n, err
+}
+
+// Returns the worlds of an archive created by ArchiveWorlds with several worlds, the top level directories
+// that contain a level.dat. Returns nil for archives of a single world, which Extract extracts
+func Worlds(source string, format Format) ([]string, error) {
+	names, err := entryNames(source, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return worldsOf(names), nil
+}
+
+// Extracts each world of an archive of several worlds into its directory in root, or the world of an
+// archive of a single world into target like Extract. Returns the paths of the extracted worlds
+func ExtractWorlds(source string, format Format, root, target string) ([]string, error) {
+	worlds, err := Worlds(source, format)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(worlds) == 0 {
+		return []string{target}, Extract(source, target, format)
+	}
+
+	var paths []string
+	for _, world := range worlds {
+		dest, err := securePath(root, world)
+		if err != nil {
+			return nil, err
+		}
+
+		switch format {
+		case FormatZip:
+			err = unzipWorld(source, world+"/", dest)
+		case FormatTarGz, FormatTarZst:
+			err = untarDir(source, format, world+"/", dest)
+		default:
+			err = fmt.Errorf("unsupported archive format %q", format)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		paths = append(paths, dest)
+	}
+
+	return paths, nil
+}
+
+// Extracts an archive with the volume layout into the server's data directory volume. Each of worlds, directories
+// relative to volume, replaces the existing world like ExtractWorlds. Other files are written into volume in place,
+// replacing files of the same name
+func ExtractVolume(source string, format Format, volume string, worlds []string) error {
+	names, err := entryNames(source, format)
+	if err != nil {
+		return err
+	}
+
+	var prefixes []string
+	for _, world := range worlds {
+		prefix := path.Clean(world) + "/"
+
+		// a world without entries would replace the existing world with an empty directory
+		if !hasPrefix(names, prefix) {
+			continue
+		}
+
+		dest, err := securePath(volume, world)
+		if err != nil {
+			return err
+		}
+
+		switch format {
+		case FormatZip:
+			err = unzipWorld(source, prefix, dest)
+		case FormatTarGz, FormatTarZst:
+			err = untarDir(source, format, prefix, dest)
+		default:
+			err = fmt.Errorf("unsupported archive format %q", format)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		prefixes = append(prefixes, prefix)
+	}
+
+	inWorld := func(name string) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(name, prefix) || name+"/" == prefix {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch format {
+	case FormatZip:
+		return unzipInPlace(source, volume, inWorld)
+	case FormatTarGz, FormatTarZst:
+		return untarInPlace(source, format, volume, inWorld)
+	default:
+		return fmt.Errorf("unsupported archive format %q", format)
+	}
+}
+
+// Returns the layout of an archive from its entries. Archives with a server.properties at their root have the volume layout
+func Layout(source string, format Format) (string, error) {
+	names, err := entryNames(source, format)
+	if err != nil {
+		return "", err
+	}
+
+	for _, name := range names {
+		if name == "server.properties" {
+			return VolumeLayout, nil
+		}
+	}
+
+	return WorldsLayout, nil
+}
+
+func hasPrefix(names []string, prefix string) bool {
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Writes the entries of a zip archive into target, except those skip returns true for
+func unzipInPlace(source, target string, skip func(name string) bool) error {
+	r, err := zip.OpenReader(source)
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	for _, f := range r.File {
+		if skip(f.Name) {
+			continue
+		}
+
+		dest, err := securePath(target, f.Name)
+		if err != nil {
+			return err
+		}
+
+		mode := f.Mode()
+
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				return err
+			}
+			continue
+		case !mode.IsRegular():
+			return fmt.Errorf("unsupported file type %v for %q in archive", mode.Type(), f.Name)
+		}
+
+		if err := extractFile(f, dest); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func unzipWorld(source, root, target string) error {
+	r, err := zip.OpenReader(source)
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	return unzipDir(r, root, target)
+}
+
+// Returns the names of every entry in an archive
+func entryNames(source string, format Format) ([]string, error) {
+	switch format {
+	case FormatZip:
+		r, err := zip.OpenReader(source)
+		if err != nil {
+			return nil, &CorruptArchiveError{Err: err}
+		}
+
+		defer r.Close()
+
+		names := make([]string, len(r.File))
+		for i, f := range r.File {
+			names[i] = f.Name
+		}
+
+		return names, nil
+	case FormatTarGz, FormatTarZst:
+		var names []string
+		err := readTar(source, format, func(header *tar.Header, r io.Reader) error {
+			names = append(names, header.Name)
+			return nil
+		})
+
+		return names, err
+	default:
+		return nil, fmt.Errorf("unsupported archive format %q", format)
+	}
+}
+
+// Returns the top level directories of the archive entry names if there are several and each contains a level.dat
+func worldsOf(names []string) []string {
+	// top level directory -> whether it contains a level.dat
+	dirs := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimPrefix(name, "/")
+
+		i := strings.Index(name, "/")
+		if i < 0 {
+			// files at the root belong to a single world
+			return nil
+		}
+
+		dir := name[:i]
+		dirs[dir] = dirs[dir] || path.Clean(name[i+1:]) == levelDat
+	}
+
+	if len(dirs) < 2 {
+		return nil
+	}
+
+	worlds := make([]string, 0, len(dirs))
+	for dir, hasLevel := range dirs {
+		if !hasLevel {
+			return nil
+		}
+		worlds = append(worlds, dir)
+	}
+
+	sort.Strings(worlds)
+	return worlds
+}
+
+// Returns the archive path prefix of the world root. "" for archives with level.dat at their root
+// or "<dir>/" for archives created by Zipit with the world in a single top level directory
+func worldRoot(files []*zip.File) string {
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.Name
+	}
+
+	return rootOf(names)
+}
+
+// Returns the path prefix of the world root in a list of archive entry names
+func rootOf(names []string) string {
+	var top string
+	for _, name := range names {
+		name = path.Clean(strings.TrimPrefix(name, "/"))
+
+		if name == levelDat {
+			return ""
+		}
+
+		dir := strings.SplitN(name, "/", 2)[0]
+		if top == "" {
+			top = dir
+		} else if top != dir {
+			return ""
+		}
+	}
+
+	if top == "" || top == "." || top == levelDat {
+		return ""
+	}
+
+	return top + "/"
+}
+
+// Joins the archive entry name onto dir. Returns an error for absolute names or names
+// that would escape dir (zip slip)
+func securePath(dir, name string) (string, error) {
+	if path.IsAbs(name) || filepath.IsAbs(name) || strings.Contains(name, `\`) {
+		return "", fmt.Errorf("illegal file path %q in archive", name)
+	}
+
+	dest := filepath.Join(dir, filepath.FromSlash(name))
+	if !strings.HasPrefix(dest, filepath.Clean(dir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("illegal file path %q in archive", name)
+	}
+
+	return dest, nil
+}
+
+// Writes a single archive entry to dest preserving its permissions and mtime
+func extractFile(f *zip.File, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+
+	defer rc.Close()
+
+	file, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, f.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, rc); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	// OpenFile permissions are subject to umask
+	if err := os.Chmod(dest, f.Mode().Perm()); err != nil {
+		return err
+	}
+
+	return os.Chtimes(dest, f.Modified, f.Modified)
+}
@@ -0,0 +1,304 @@
+package backup
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Entry of a test archive. Names ending with / are directories
+type entry struct {
+	name    string
+	body    string
+	mode    os.FileMode
+	modTime time.Time
+}
+
+var testTime = time.Date(2021, time.July, 1, 12, 30, 0, 0, time.UTC)
+
+func writeZip(t *testing.T, entries []entry) string {
+	f, err := ioutil.TempFile(t.TempDir(), "*.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: e.modTime}
+		if header.Modified.IsZero() {
+			header.Modified = testTime
+		}
+
+		mode := e.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		if strings.HasSuffix(e.name, "/") {
+			mode |= os.ModeDir
+		}
+		header.SetMode(mode)
+
+		fw, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := fw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return f.Name()
+}
+
+// Writes the files, slash separated paths relative to dir, with their contents
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, body := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(p, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Files in dir with their contents, by slash separated relative path
+func readFiles(t *testing.T, dir string) map[string]string {
+	files := map[string]string{}
+
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		rel, _ := filepath.Rel(dir, p)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return files
+}
+
+func sameFiles(t *testing.T, got, want map[string]string) {
+	t.Helper()
+
+	var g, w []string
+	for name, body := range got {
+		g = append(g, name+"="+body)
+	}
+	for name, body := range want {
+		w = append(w, name+"="+body)
+	}
+
+	sort.Strings(g)
+	sort.Strings(w)
+
+	if strings.Join(g, " ") != strings.Join(w, " ") {
+		t.Fatalf("files %v, want %v", g, w)
+	}
+}
+
+func TestSecurePath(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "world")
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"level.dat", filepath.Join(dir, "level.dat")},
+		{"region/r.0.0.mca", filepath.Join(dir, "region", "r.0.0.mca")},
+		{"region/../level.dat", filepath.Join(dir, "level.dat")},
+		{"../level.dat", ""},
+		{"region/../../level.dat", ""},
+		{"..", ""},
+		{".", ""},
+		{"", ""},
+		{"/etc/passwd", ""},
+		{`..\level.dat`, ""},
+		{`region\r.0.0.mca`, ""},
+	}
+
+	for _, tt := range tests {
+		got, err := securePath(dir, tt.name)
+		if tt.want == "" && err == nil {
+			t.Errorf("securePath(%q) = %s, want an error", tt.name, got)
+		} else if tt.want != "" && (err != nil || got != tt.want) {
+			t.Errorf("securePath(%q) = %s, %v, want %s", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestRootOf(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  string
+	}{
+		// created by Zipit
+		{[]string{"world/", "world/level.dat", "world/region/", "world/region/r.0.0.mca"}, "world/"},
+		{[]string{"/world/level.dat", "world/region/r.0.0.mca"}, "world/"},
+		// world files at the root
+		{[]string{"level.dat", "region/r.0.0.mca"}, ""},
+		{[]string{"region/r.0.0.mca", "level.dat"}, ""},
+		// several top level directories
+		{[]string{"world/level.dat", "world_nether/level.dat"}, ""},
+		// a directory with a level.dat below the world root
+		{[]string{"backup/world/level.dat"}, "backup/"},
+		{[]string{"level.dat/"}, ""},
+		{nil, ""},
+	}
+
+	for _, tt := range tests {
+		if got := rootOf(tt.names); got != tt.want {
+			t.Errorf("rootOf(%v) = %q, want %q", tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestUnzipLegacyLayout(t *testing.T) {
+	world := filepath.Join(t.TempDir(), "world")
+	files := map[string]string{"level.dat": "level", "region/r.0.0.mca": "region", "data/raids.dat": "raids"}
+	writeFiles(t, world, files)
+
+	archive, err := os.Create(filepath.Join(t.TempDir(), "world.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Zipit(world, archive); err != nil {
+		t.Fatal(err)
+	}
+	archive.Close()
+
+	// the existing world is replaced, so its files that are not in the backup are removed
+	target := filepath.Join(t.TempDir(), "server", "world")
+	writeFiles(t, target, map[string]string{"level.dat": "new world", "region/r.5.5.mca": "new region"})
+
+	if err := Unzip(archive.Name(), target); err != nil {
+		t.Fatal(err)
+	}
+
+	sameFiles(t, readFiles(t, target), files)
+
+	// the temp directory is removed
+	if entries, _ := ioutil.ReadDir(filepath.Dir(target)); len(entries) != 1 {
+		t.Fatalf("%d entries next to the world, want 1", len(entries))
+	}
+}
+
+func TestUnzipBareRoot(t *testing.T) {
+	archive := writeZip(t, []entry{
+		{name: "level.dat", body: "level"},
+		{name: "region/"},
+		{name: "region/r.0.0.mca", body: "region"},
+	})
+
+	target := filepath.Join(t.TempDir(), "world")
+	if err := Unzip(archive, target); err != nil {
+		t.Fatal(err)
+	}
+
+	sameFiles(t, readFiles(t, target), map[string]string{"level.dat": "level", "region/r.0.0.mca": "region"})
+}
+
+func TestUnzipModes(t *testing.T) {
+	dirTime := testTime.Add(-time.Hour)
+	fileTime := testTime.Add(-2 * time.Hour)
+
+	archive := writeZip(t, []entry{
+		{name: "world/", mode: 0755},
+		{name: "world/level.dat", body: "level", mode: 0600, modTime: fileTime},
+		{name: "world/scripts/", mode: 0700, modTime: dirTime},
+		{name: "world/scripts/run.sh", body: "#!/bin/sh", mode: 0755},
+	})
+
+	target := filepath.Join(t.TempDir(), "world")
+	if err := Unzip(archive, target); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		mode    os.FileMode
+		modTime time.Time
+	}{
+		{"level.dat", 0600, fileTime},
+		{"scripts", os.ModeDir | 0700, dirTime},
+		{"scripts/run.sh", 0755, testTime},
+	}
+
+	for _, tt := range tests {
+		info, err := os.Stat(filepath.Join(target, filepath.FromSlash(tt.name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode() != tt.mode {
+			t.Errorf("%s extracted with mode %v, want %v", tt.name, info.Mode(), tt.mode)
+		}
+
+		if !info.ModTime().Equal(tt.modTime) {
+			t.Errorf("%s extracted with mtime %s, want %s", tt.name, info.ModTime(), tt.modTime)
+		}
+	}
+}
+
+func TestUnzipSlip(t *testing.T) {
+	tests := map[string][]entry{
+		"parent of the root":  {{name: "world/level.dat"}, {name: "world/../../evil", body: "evil"}},
+		"parent of bare root": {{name: "level.dat"}, {name: "../evil", body: "evil"}},
+		"absolute":            {{name: "level.dat"}, {name: "/evil", body: "evil"}},
+		"backslashes":         {{name: "level.dat"}, {name: `..\evil`, body: "evil"}},
+	}
+
+	for name, entries := range tests {
+		t.Run(name, func(t *testing.T) {
+			archive := writeZip(t, entries)
+
+			dir := t.TempDir()
+			target := filepath.Join(dir, "server", "world")
+			writeFiles(t, target, map[string]string{"level.dat": "current"})
+
+			if err := Unzip(archive, target); err == nil {
+				t.Fatal("Unzip of an archive with an entry outside the world succeeded")
+			}
+
+			sameFiles(t, readFiles(t, dir), map[string]string{"server/world/level.dat": "current"})
+		})
+	}
+}
+
+func TestUnzipSymlink(t *testing.T) {
+	archive := writeZip(t, []entry{{name: "level.dat"}, {name: "link", body: "/etc/passwd", mode: os.ModeSymlink | 0777}})
+
+	target := filepath.Join(t.TempDir(), "world")
+	if err := Unzip(archive, target); err == nil {
+		t.Fatal("Unzip of an archive with a symlink succeeded")
+	}
+
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Fatal("world was extracted from an archive with a symlink")
+	}
+}
@@ -0,0 +1,108 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Returns the hex SHA-256 of the names, sizes, modification times and modes of the files the worlds would
+// archive. The fingerprint changes when a selected file is added, removed or written to, without reading any file
+func Fingerprint(worlds []World) (string, error) {
+	h := sha256.New()
+
+	for _, world := range worlds {
+		err := filepath.Walk(world.Path, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !info.IsDir() && !info.Mode().IsRegular() {
+				return nil
+			}
+
+			name, err := entryName(world, path)
+			if err != nil {
+				return err
+			}
+
+			if ok, err := world.selects(name, info); !ok {
+				return err
+			}
+
+			// directory times change with the files in them, which are fingerprinted themselves
+			if info.IsDir() {
+				fmt.Fprintf(h, "%s/\x00\n", name)
+				return nil
+			}
+
+			fmt.Fprintf(h, "%s\x00%d\x00%d\x00%o\n", name, info.Size(), info.ModTime().UnixNano(), info.Mode())
+			return nil
+		})
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Last successful backup of a server. Kept in a local file so unchanged worlds can be detected
+// without listing the backup destination
+type State struct {
+	Server      string    `json:"server"`
+	Backup      string    `json:"backup"`
+	Fingerprint string    `json:"fingerprint"`
+	Created     time.Time `json:"created"`
+}
+
+// Reads the state file. Returns an error satisfying os.IsNotExist if there is none
+func ReadState(path string) (*State, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var state State
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("invalid backup state file %q: %w", path, err)
+	}
+
+	return &state, nil
+}
+
+// Replaces the state file. The file is written next to path and renamed so it is never left half written
+func WriteState(path string, state *State) error {
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-"+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
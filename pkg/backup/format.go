@@ -0,0 +1,172 @@
+package backup
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Archive format of a full backup
+type Format string
+
+const (
+	FormatZip    Format = "zip"
+	FormatTarGz  Format = "tar.gz"
+	FormatTarZst Format = "tar.zst"
+)
+
+const (
+	TarGzContentType   string = "application/gzip"
+	TarZstContentType  string = "application/zstd"
+	JSONContentType    string = "application/json"
+	DefaultContentType string = "application/octet-stream"
+)
+
+// Compression level that selects the format's default level
+const DefaultCompressionLevel = 0
+
+// Parses a format name
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatZip, FormatTarGz, FormatTarZst:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unsupported archive format %q. expected zip, tar.gz or tar.zst", s)
+	}
+}
+
+// Returns the format of a backup from its name's extension. Names without a known extension are zips
+func FormatOf(name string) Format {
+	for _, f := range []Format{FormatTarGz, FormatTarZst, FormatZip} {
+		if strings.HasSuffix(name, f.Ext()) {
+			return f
+		}
+	}
+	return FormatZip
+}
+
+// Extension of backup names in the format, e.g. ".tar.zst"
+func (f Format) Ext() string {
+	return "." + string(f)
+}
+
+// Content type of objects in the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatTarGz:
+		return TarGzContentType
+	case FormatTarZst:
+		return TarZstContentType
+	default:
+		return ZipContentType
+	}
+}
+
+// Returns the content type of a stored object from its name
+func ContentType(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".json"):
+		return JSONContentType
+	case strings.HasSuffix(name, FormatZip.Ext()), strings.HasSuffix(name, FormatTarGz.Ext()), strings.HasSuffix(name, FormatTarZst.Ext()):
+		return FormatOf(name).ContentType()
+	default:
+		return DefaultContentType
+	}
+}
+
+// Writes an archive of source into target in the given format. level is the deflate/gzip level (1-9)
+// or zstd level (1-22). DefaultCompressionLevel selects the format's default
+func Archive(source string, target io.Writer, format Format, level int) (*ArchiveStats, error) {
+	return ArchiveWorlds(worldOf(source), target, format, level)
+}
+
+// Writes an archive of several worlds into target, each under a top level directory of its name. See Archive
+func ArchiveWorlds(worlds []World, target io.Writer, format Format, level int) (*ArchiveStats, error) {
+	switch format {
+	case FormatZip:
+		return zipit(worlds, target, level)
+	case FormatTarGz, FormatTarZst:
+		return tarit(worlds, target, format, level)
+	default:
+		return nil, fmt.Errorf("unsupported archive format %q", format)
+	}
+}
+
+// Extracts the archive of a world in the given format into the target world directory. See Unzip
+func Extract(source, target string, format Format) error {
+	switch format {
+	case FormatZip:
+		return Unzip(source, target)
+	case FormatTarGz, FormatTarZst:
+		return untar(source, target, format)
+	default:
+		return fmt.Errorf("unsupported archive format %q", format)
+	}
+}
+
+// Reads every file in the archive of a world in the given format. See WalkZip
+func Walk(source string, format Format, fn func(name string, r io.Reader) error) error {
+	switch format {
+	case FormatZip:
+		return WalkZip(source, fn)
+	case FormatTarGz, FormatTarZst:
+		return walkTar(source, format, fn)
+	default:
+		return fmt.Errorf("unsupported archive format %q", format)
+	}
+}
+
+func deflateLevel(level int) (int, error) {
+	if level == DefaultCompressionLevel {
+		return flate.DefaultCompression, nil
+	}
+
+	if level < flate.BestSpeed || level > flate.BestCompression {
+		return 0, fmt.Errorf("invalid deflate compression level %d. expected 1-9", level)
+	}
+
+	return level, nil
+}
+
+// Wraps w in the format's compressor
+func compressor(w io.Writer, format Format, level int) (io.WriteCloser, error) {
+	switch format {
+	case FormatTarGz:
+		level, err := deflateLevel(level)
+		if err != nil {
+			return nil, err
+		}
+		return gzip.NewWriterLevel(w, level)
+	case FormatTarZst:
+		var opts []zstd.EOption
+		if level != DefaultCompressionLevel {
+			if level < 1 || level > 22 {
+				return nil, fmt.Errorf("invalid zstd compression level %d. expected 1-22", level)
+			}
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		return zstd.NewWriter(w, opts...)
+	default:
+		return nil, fmt.Errorf("format %q is not a compressed tar", format)
+	}
+}
+
+// Wraps r in the format's decompressor
+func decompressor(r io.Reader, format Format) (io.ReadCloser, error) {
+	switch format {
+	case FormatTarGz:
+		return gzip.NewReader(r)
+	case FormatTarZst:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("format %q is not a compressed tar", format)
+	}
+}
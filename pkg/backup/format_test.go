@@ -0,0 +1,172 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	for s, want := range map[string]Format{"zip": FormatZip, "tar.gz": FormatTarGz, "TAR.ZST": FormatTarZst} {
+		if got, err := ParseFormat(s); err != nil || got != want {
+			t.Errorf("ParseFormat(%s) = %s, %v", s, got, err)
+		}
+	}
+
+	for _, s := range []string{"", "rar", "tgz", "gz"} {
+		if _, err := ParseFormat(s); err == nil {
+			t.Errorf("ParseFormat(%q) succeeded", s)
+		}
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	tests := map[string]Format{
+		"mc-server-2021-05-09T09:35:00.000Z.zip":     FormatZip,
+		"mc-server-2021-05-09T09:35:00.000Z.tar.gz":  FormatTarGz,
+		"mc-server-2021-05-09T09:35:00.000Z.tar.zst": FormatTarZst,
+		// backups from before formats were selectable
+		"mc-server-2021-05-09T09:35:00Z.zip": FormatZip,
+		"world.zip":                          FormatZip,
+		"world":                              FormatZip,
+		// only the extension counts
+		"world.tar.gz.zip": FormatZip,
+		"world.zip.tar.gz": FormatTarGz,
+	}
+
+	for name, want := range tests {
+		if got := FormatOf(name); got != want {
+			t.Errorf("FormatOf(%s) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	files := map[string]string{
+		"level.dat":        "level",
+		"region/r.0.0.mca": strings.Repeat("region", 10000),
+		"data/raids.dat":   "raids",
+	}
+
+	for _, format := range []Format{FormatZip, FormatTarGz, FormatTarZst} {
+		for _, level := range []int{DefaultCompressionLevel, 1, 9} {
+			world := filepath.Join(t.TempDir(), "world")
+			writeFiles(t, world, files)
+
+			if err := os.Chmod(filepath.Join(world, "data", "raids.dat"), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			var archive bytes.Buffer
+			stats, err := Archive(world, &archive, format, level)
+			if err != nil {
+				t.Fatalf("%s level %d: %v", format, level, err)
+			}
+
+			if stats.Files != len(files) {
+				t.Errorf("%s level %d: archived %d files, want %d", format, level, stats.Files, len(files))
+			}
+
+			source := filepath.Join(t.TempDir(), "world"+format.Ext())
+			if err := ioutil.WriteFile(source, archive.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			// the archive's world replaces the existing world
+			target := filepath.Join(t.TempDir(), "world")
+			writeFiles(t, target, map[string]string{"level.dat": "new world", "stale.dat": "stale"})
+
+			if err := Extract(source, target, format); err != nil {
+				t.Fatalf("%s level %d: %v", format, level, err)
+			}
+
+			sameFiles(t, readFiles(t, target), files)
+
+			info, err := os.Stat(filepath.Join(target, "data", "raids.dat"))
+			if err != nil || info.Mode().Perm() != 0600 {
+				t.Errorf("%s level %d: raids.dat extracted with mode %v, %v", format, level, info.Mode(), err)
+			}
+
+			var walked []string
+			err = Walk(source, format, func(name string, r io.Reader) error {
+				walked = append(walked, name)
+				return nil
+			})
+			sort.Strings(walked)
+
+			if err != nil || strings.Join(walked, " ") != "data/raids.dat level.dat region/r.0.0.mca" {
+				t.Errorf("%s level %d: walked %v, %v", format, level, walked, err)
+			}
+		}
+	}
+}
+
+func TestArchiveCorrupt(t *testing.T) {
+	world := filepath.Join(t.TempDir(), "world")
+	writeFiles(t, world, map[string]string{"level.dat": "level", "region/r.0.0.mca": strings.Repeat("region", 10000)})
+
+	for _, format := range []Format{FormatZip, FormatTarGz, FormatTarZst} {
+		var archive bytes.Buffer
+		if _, err := Archive(world, &archive, format, DefaultCompressionLevel); err != nil {
+			t.Fatal(err)
+		}
+
+		source := filepath.Join(t.TempDir(), "world"+format.Ext())
+		if err := ioutil.WriteFile(source, archive.Bytes()[:archive.Len()*2/3], 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		err := Walk(source, format, func(name string, r io.Reader) error { return nil })
+
+		var corrupt *CorruptArchiveError
+		if !errors.As(err, &corrupt) {
+			t.Errorf("%s: Walk of a truncated archive = %v, want a CorruptArchiveError", format, err)
+		}
+	}
+}
+
+func TestArchiveLevels(t *testing.T) {
+	world := filepath.Join(t.TempDir(), "world")
+	writeFiles(t, world, map[string]string{"level.dat": "level"})
+
+	tests := []struct {
+		format Format
+		level  int
+		ok     bool
+	}{
+		{FormatZip, DefaultCompressionLevel, true},
+		{FormatZip, 9, true},
+		{FormatZip, 10, false},
+		{FormatZip, -1, false},
+		{FormatTarGz, 1, true},
+		{FormatTarGz, 10, false},
+		{FormatTarGz, -2, false},
+		{FormatTarZst, 1, true},
+		{FormatTarZst, 22, true},
+		{FormatTarZst, 23, false},
+		{FormatTarZst, -1, false},
+	}
+
+	for _, tt := range tests {
+		_, err := Archive(world, ioutil.Discard, tt.format, tt.level)
+		if (err == nil) != tt.ok {
+			t.Errorf("Archive in %s at level %d = %v, want success %v", tt.format, tt.level, err, tt.ok)
+		}
+	}
+}
+
+func TestArchiveMissingWorld(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "world")
+
+	for _, format := range []Format{FormatZip, FormatTarGz, FormatTarZst} {
+		if _, err := Archive(missing, ioutil.Discard, format, DefaultCompressionLevel); !os.IsNotExist(err) {
+			t.Errorf("Archive of a missing world in %s = %v, want a not exist error", format, err)
+		}
+	}
+}
@@ -2,39 +2,72 @@ package google
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
-	"os"
-	"path"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
 
 	"github.com/saulmaldonado/agones-mc/pkg/backup"
 )
 
+// URL scheme for Google Cloud Storage destinations, e.g. gs://bucket/prefix
+const Scheme = "gs"
+
+// Size of the chunks of resumable uploads. A chunk that fails to upload is retried by the storage
+// client without restarting the upload
+const ChunkSize = 16 << 20
+
 type GoogleClient struct {
 	client  *storage.Client
 	bktName string
+	prefix  string
 }
 
-func New(ctx context.Context, bucketName string) (backup.BackupClient, error) {
+func init() {
+	backup.Register(Scheme, func(ctx context.Context, u *url.URL) (backup.BackupClient, error) {
+		if u.Host == "" {
+			return nil, fmt.Errorf("google: missing bucket name in %q", u.String())
+		}
+
+		return New(ctx, u.Host, u.Path)
+	})
+}
+
+// Creates a new Google Cloud Storage backup client. Objects are stored under the given prefix in the bucket
+func New(ctx context.Context, bucketName, prefix string) (backup.BackupClient, error) {
 	client, err := storage.NewClient(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return &GoogleClient{client, bucketName}, nil
+	return &GoogleClient{client, bucketName, strings.Trim(prefix, "/")}, nil
 }
 
-func (g *GoogleClient) Backup(file *os.File) error {
-	ctx := context.Background()
+// Streams the backup read from r into the bucket with a resumable upload. The upload is cancelled if
+// reading fails so a partial object is never written
+func (g *GoogleClient) Backup(ctx context.Context, name string, r io.Reader) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	bkt := g.client.Bucket(g.bktName)
 
-	obj := bkt.Object(file.Name())
+	obj := bkt.Object(g.objectName(name))
 
 	w := obj.NewWriter(ctx)
-	w.ContentType = backup.ZipContentType
+	w.ContentType = backup.ContentType(name)
+	w.ChunkSize = ChunkSize
 
-	if _, err := io.Copy(w, file); err != nil {
+	if _, err := io.Copy(w, r); err != nil {
+		cancel()
+		w.Close()
 		return err
 	}
 
@@ -45,35 +78,141 @@ func (g *GoogleClient) Backup(file *os.File) error {
 	return nil
 }
 
-func (g *GoogleClient) Load(name, targetVol string) error {
-	ctx := context.Background()
+// Downloads the backup into w
+func (g *GoogleClient) Load(ctx context.Context, name string, w io.Writer) error {
+	return g.LoadRange(ctx, name, 0, w)
+}
+
+// Downloads the backup from offset into w
+func (g *GoogleClient) LoadRange(ctx context.Context, name string, offset int64, w io.Writer) error {
 	bkt := g.client.Bucket(g.bktName)
 
-	obj := bkt.Object(name)
+	obj := bkt.Object(g.objectName(name))
 
-	r, err := obj.NewReader(ctx)
-	if err != nil {
-		return err
+	r, err := obj.NewRangeReader(ctx, offset, -1)
+	if err == storage.ErrObjectNotExist {
+		return fmt.Errorf("%w: %s", backup.ErrNotExist, name)
 	}
 
-	zipfile, err := os.Create(path.Join(targetVol, "world.zip"))
 	if err != nil {
 		return err
 	}
 
-	defer zipfile.Close()
+	defer r.Close()
 
-	if _, err := io.Copy(zipfile, r); err != nil {
+	if _, err := io.Copy(w, r); err != nil {
 		return err
 	}
 
-	if err := r.Close(); err != nil {
-		return err
+	return nil
+}
+
+// Lists objects in the bucket under the client prefix that start with prefix
+func (g *GoogleClient) List(ctx context.Context, prefix string) ([]backup.Object, error) {
+	bkt := g.client.Bucket(g.bktName)
+
+	it := bkt.Objects(ctx, &storage.Query{Prefix: g.objectName(prefix)})
+
+	var objects []backup.Object
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, backup.Object{
+			Name:    strings.TrimPrefix(attrs.Name, g.objectName("")),
+			Size:    attrs.Size,
+			Created: attrs.Created,
+		})
 	}
 
-	return nil
+	return objects, nil
+}
+
+func (g *GoogleClient) Delete(ctx context.Context, name string) error {
+	bkt := g.client.Bucket(g.bktName)
+
+	err := bkt.Object(g.objectName(name)).Delete(ctx)
+	if err == storage.ErrObjectNotExist {
+		return fmt.Errorf("%w: %s", backup.ErrNotExist, name)
+	}
+
+	return err
+}
+
+// Reads the object. Its generation is the object generation
+func (g *GoogleClient) ReadObject(ctx context.Context, name string) ([]byte, string, error) {
+	r, err := g.client.Bucket(g.bktName).Object(g.objectName(name)).NewReader(ctx)
+	if err == storage.ErrObjectNotExist {
+		return nil, "", fmt.Errorf("%w: %s", backup.ErrNotExist, name)
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return data, strconv.FormatInt(r.Attrs.Generation, 10), nil
+}
+
+// Writes the object with a generation match or does-not-exist precondition
+func (g *GoogleClient) WriteObject(ctx context.Context, name string, data []byte, generation string) (string, error) {
+	obj := g.client.Bucket(g.bktName).Object(g.objectName(name))
+
+	if generation == "" {
+		obj = obj.If(storage.Conditions{DoesNotExist: true})
+	} else {
+		gen, err := strconv.ParseInt(generation, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("google: invalid generation %q: %w", generation, err)
+		}
+		obj = obj.If(storage.Conditions{GenerationMatch: gen})
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := obj.NewWriter(ctx)
+	w.ContentType = backup.ContentType(name)
+
+	if _, err := w.Write(data); err != nil {
+		cancel()
+		w.Close()
+		return "", err
+	}
+
+	if err := w.Close(); err != nil {
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+			return "", fmt.Errorf("%w: %s", backup.ErrPreconditionFailed, name)
+		}
+		return "", err
+	}
+
+	return strconv.FormatInt(w.Attrs().Generation, 10), nil
 }
 
 func (g *GoogleClient) Close() error {
 	return g.client.Close()
 }
+
+// Returns the full object name in the bucket. Trailing slashes in name are kept so
+// it can be used as a listing prefix
+func (g *GoogleClient) objectName(name string) string {
+	if g.prefix == "" {
+		return name
+	}
+
+	return g.prefix + "/" + name
+}
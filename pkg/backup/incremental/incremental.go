@@ -0,0 +1,513 @@
+package incremental
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+)
+
+const (
+	// Size of the content-addressed chunks files are split into. Region files are modified in place
+	// so fixed size chunks at fixed offsets keep unchanged parts of a file deduplicated
+	ChunkSize = 1 << 20
+
+	// Suffix of snapshot manifest names
+	SnapshotSuffix = ".snapshot.json"
+
+	// Prefix chunks are stored under
+	ChunkPrefix = "chunks/"
+
+	// Chunks newer than this are never garbage collected since a backup that is still running
+	// may have uploaded them before writing its snapshot manifest
+	DefaultGCGracePeriod = time.Hour
+
+	snapshotVersion = 1
+)
+
+// Returned by Restore when a chunk does not match its hash
+var ErrCorruptChunk = errors.New("corrupt chunk")
+
+// Snapshot manifest referencing the chunks of every file in a world
+type Snapshot struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	// Directory names of the worlds in a snapshot of several worlds
+	Worlds []string `json:"worlds,omitempty"`
+	Files  []File   `json:"files"`
+}
+
+// File or directory in a snapshot. Paths are slash separated and relative to the world directory,
+// or prefixed with the world's directory name in a snapshot of several worlds
+type File struct {
+	Path    string      `json:"path"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"modTime"`
+	Size    int64       `json:"size"`
+	Chunks  []string    `json:"chunks,omitempty"`
+}
+
+// Totals for a snapshot backup
+type Stats struct {
+	Files int
+	// Total size of the files in the world
+	Size           int64
+	Chunks         int
+	UploadedChunks int
+	UploadedBytes  int64
+	// Hex SHA-256 and size of the snapshot manifest
+	SnapshotSHA256 string
+	SnapshotSize   int64
+}
+
+// Returns true if name is a snapshot manifest
+func IsSnapshot(name string) bool {
+	return strings.HasSuffix(name, SnapshotSuffix)
+}
+
+// Backs up the world directory source as a snapshot manifest with the given name.
+// Files are split into chunks addressed by their SHA-256 and only chunks that are not already stored are uploaded.
+// Stored chunks older than maxReuseAge are uploaded again, see BackupWorlds
+func Backup(ctx context.Context, client backup.BackupClient, name, source string, maxReuseAge time.Duration) (*Stats, error) {
+	return BackupWorlds(ctx, client, name, []backup.World{{Name: filepath.Base(source), Path: source}}, maxReuseAge)
+}
+
+// Backs up several worlds as a single snapshot manifest. A snapshot of a single world is the same as one made by Backup.
+// Chunks are uploaded with UploadWorlds
+func BackupWorlds(ctx context.Context, client backup.BackupClient, name string, worlds []backup.World, maxReuseAge time.Duration) (*Stats, error) {
+	snapshot, stats, err := UploadWorlds(ctx, client, worlds, maxReuseAge)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := WriteSnapshot(ctx, client, name, snapshot, stats); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// Uploads the chunks of the worlds that are not already stored and returns the snapshot that references them,
+// which is only backed up once it is written with WriteSnapshot.
+//
+// A stored chunk may be unreferenced and deleted by GC while the snapshot is written. GC keeps chunks younger than
+// its grace period, so only chunks stored less than maxReuseAge ago are reused and older ones are uploaded again,
+// which makes them young again. maxReuseAge must be shorter than the grace period by more than a backup takes.
+// Every stored chunk is reused if maxReuseAge is 0
+func UploadWorlds(ctx context.Context, client backup.BackupClient, worlds []backup.World, maxReuseAge time.Duration) (*Snapshot, *Stats, error) {
+	existing, err := client.List(ctx, ChunkPrefix)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cutoff := time.Now().Add(-maxReuseAge)
+
+	stored := make(map[string]bool, len(existing))
+	for _, obj := range existing {
+		if maxReuseAge <= 0 || obj.Created.After(cutoff) {
+			stored[obj.Name] = true
+		}
+	}
+
+	snapshot := &Snapshot{Version: snapshotVersion, Created: time.Now().UTC()}
+	stats := &Stats{}
+	buf := make([]byte, ChunkSize)
+
+	for _, world := range worlds {
+		// paths are only prefixed with the world's name when there are several worlds
+		var prefix string
+		if len(worlds) > 1 {
+			prefix = world.Name
+			snapshot.Worlds = append(snapshot.Worlds, world.Name)
+		}
+
+		if err := backupWorld(ctx, client, world, prefix, snapshot, buf, stored, stats); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return snapshot, stats, nil
+}
+
+// Writes the snapshot manifest with the given name and records its digest and size in stats
+func WriteSnapshot(ctx context.Context, client backup.BackupClient, name string, snapshot *Snapshot, stats *Stats) error {
+	manifest, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	if err := client.Backup(ctx, name, bytes.NewReader(manifest)); err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(manifest)
+	stats.SnapshotSHA256 = hex.EncodeToString(sum[:])
+	stats.SnapshotSize = int64(len(manifest))
+
+	return nil
+}
+
+// Adds the selected files of the world to the snapshot with paths prefixed by prefix
+func backupWorld(ctx context.Context, client backup.BackupClient, world backup.World, prefix string, snapshot *Snapshot, buf []byte, stored map[string]bool, stats *Stats) error {
+	return filepath.Walk(world.Path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(world.Path, p)
+		if err != nil {
+			return err
+		}
+
+		// files are selected by the name they would have in an archive of the world
+		if world.Select != nil && rel != "." {
+			switch world.Select(filepath.ToSlash(filepath.Join(world.Name, rel)), info.IsDir()) {
+			case backup.Exclude:
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			case backup.Descend:
+				return nil
+			}
+		}
+
+		if rel == "." && prefix == "" {
+			return nil
+		}
+
+		file := File{
+			Path:    filepath.ToSlash(filepath.Join(prefix, rel)),
+			Mode:    info.Mode(),
+			ModTime: info.ModTime(),
+		}
+
+		if info.Mode().IsRegular() {
+			if file.Size, file.Chunks, err = backupFile(ctx, client, p, buf, stored, stats); err != nil {
+				return err
+			}
+			stats.Files++
+			stats.Size += file.Size
+		} else if !info.IsDir() {
+			// sockets, symlinks and other special files are not part of a world
+			return nil
+		}
+
+		snapshot.Files = append(snapshot.Files, file)
+		return nil
+	})
+}
+
+// Splits the file into chunks and uploads the ones not in stored
+func backupFile(ctx context.Context, client backup.BackupClient, p string, buf []byte, stored map[string]bool, stats *Stats) (int64, []string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	defer f.Close()
+
+	var size int64
+	var chunks []string
+
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			sum := sha256.Sum256(buf[:n])
+			hash := hex.EncodeToString(sum[:])
+			chunkName := ChunkName(hash)
+
+			if !stored[chunkName] {
+				if err := client.Backup(ctx, chunkName, bytes.NewReader(buf[:n])); err != nil {
+					return 0, nil, err
+				}
+				stored[chunkName] = true
+				stats.UploadedChunks++
+				stats.UploadedBytes += int64(n)
+			}
+
+			chunks = append(chunks, hash)
+			stats.Chunks++
+			size += int64(n)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return size, chunks, nil
+		}
+
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+}
+
+// Returns the object name of the chunk with the given hex SHA-256. Names are the hashes of the plaintext
+// even when chunks are encrypted, so stored chunks can be matched against known files
+func ChunkName(hash string) string {
+	return ChunkPrefix + hash[:2] + "/" + hash
+}
+
+// Downloads and decodes a snapshot manifest
+func LoadSnapshot(ctx context.Context, client backup.BackupClient, name string) (*Snapshot, error) {
+	var buf bytes.Buffer
+	if err := client.Load(ctx, name, &buf); err != nil {
+		return nil, err
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(buf.Bytes(), &snapshot); err != nil {
+		return nil, fmt.Errorf("invalid snapshot %q: %w", name, err)
+	}
+
+	if snapshot.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d in %q", snapshot.Version, name)
+	}
+
+	return &snapshot, nil
+}
+
+// Rebuilds the world of the named snapshot into target. Every chunk is verified against its hash.
+// The world is restored into a temp directory next to target first and then replaces any existing world
+func Restore(ctx context.Context, client backup.BackupClient, name, target string) error {
+	snapshot, err := LoadSnapshot(ctx, client, name)
+	if err != nil {
+		return err
+	}
+
+	if len(snapshot.Worlds) > 0 {
+		return fmt.Errorf("snapshot %q has %d worlds", name, len(snapshot.Worlds))
+	}
+
+	return restore(ctx, client, snapshot.Files, target)
+}
+
+// Rebuilds each world of a snapshot of several worlds into its directory in root, or the world of a
+// snapshot of a single world into target like Restore. Returns the paths of the restored worlds
+func RestoreWorlds(ctx context.Context, client backup.BackupClient, name, root, target string) ([]string, error) {
+	snapshot, err := LoadSnapshot(ctx, client, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(snapshot.Worlds) == 0 {
+		return []string{target}, restore(ctx, client, snapshot.Files, target)
+	}
+
+	var paths []string
+	for _, world := range snapshot.Worlds {
+		dest, err := securePath(root, world)
+		if err != nil {
+			return nil, err
+		}
+
+		var files []File
+		for _, file := range snapshot.Files {
+			if strings.HasPrefix(file.Path, world+"/") {
+				file.Path = strings.TrimPrefix(file.Path, world+"/")
+				files = append(files, file)
+			}
+		}
+
+		if err := restore(ctx, client, files, dest); err != nil {
+			return nil, err
+		}
+
+		paths = append(paths, dest)
+	}
+
+	return paths, nil
+}
+
+// Rebuilds files into target
+func restore(ctx context.Context, client backup.BackupClient, files []File, target string) error {
+	parent := filepath.Dir(target)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempDir(parent, ".tmp-"+filepath.Base(target))
+	if err != nil {
+		return err
+	}
+
+	defer os.RemoveAll(tmp)
+
+	var dirs []File
+	for _, file := range files {
+		dest, err := securePath(tmp, file.Path)
+		if err != nil {
+			return err
+		}
+
+		if file.Mode.IsDir() {
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				return err
+			}
+			dirs = append(dirs, file)
+			continue
+		}
+
+		if err := restoreFile(ctx, client, file, dest); err != nil {
+			return err
+		}
+	}
+
+	// directory permissions and mtimes are applied last since restoring files into them changes their mtime
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dest := filepath.Join(tmp, filepath.FromSlash(dirs[i].Path))
+
+		if err := os.Chmod(dest, dirs[i].Mode.Perm()); err != nil {
+			return err
+		}
+
+		if err := os.Chtimes(dest, dirs[i].ModTime, dirs[i].ModTime); err != nil {
+			return err
+		}
+	}
+
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, target)
+}
+
+func restoreFile(ctx context.Context, client backup.BackupClient, file File, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, file.Mode.Perm())
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	for _, hash := range file.Chunks {
+		h := sha256.New()
+
+		n, err := loadChunk(ctx, client, hash, io.MultiWriter(f, h))
+		if err != nil {
+			f.Close()
+			return err
+		}
+
+		if got := hex.EncodeToString(h.Sum(nil)); got != hash {
+			f.Close()
+			return fmt.Errorf("%w: chunk %s of %q has hash %s", ErrCorruptChunk, hash, file.Path, got)
+		}
+
+		size += n
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if size != file.Size {
+		return fmt.Errorf("%w: restored %d bytes of %q, expected %d", ErrCorruptChunk, size, file.Path, file.Size)
+	}
+
+	// OpenFile permissions are subject to umask
+	if err := os.Chmod(dest, file.Mode.Perm()); err != nil {
+		return err
+	}
+
+	return os.Chtimes(dest, file.ModTime, file.ModTime)
+}
+
+func loadChunk(ctx context.Context, client backup.BackupClient, hash string, w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	err := client.Load(ctx, ChunkName(hash), cw)
+	return cw.n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Joins the snapshot path onto dir. Returns an error for paths that would escape dir
+func securePath(dir, name string) (string, error) {
+	if name == "" || path.IsAbs(name) || strings.Contains(name, `\`) {
+		return "", fmt.Errorf("illegal file path %q in snapshot", name)
+	}
+
+	dest := filepath.Join(dir, filepath.FromSlash(name))
+	if !strings.HasPrefix(dest, filepath.Clean(dir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("illegal file path %q in snapshot", name)
+	}
+
+	return dest, nil
+}
+
+// Deletes chunks that are not referenced by any snapshot and are older than gracePeriod.
+// Returns the names of the deleted chunks, or of the chunks that would be deleted when dryRun is set
+func GC(ctx context.Context, client backup.BackupClient, gracePeriod time.Duration, dryRun bool) ([]string, error) {
+	objects, err := client.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	referenced := make(map[string]bool)
+	var chunks []backup.Object
+
+	for _, obj := range objects {
+		switch {
+		case IsSnapshot(obj.Name):
+			snapshot, err := LoadSnapshot(ctx, client, obj.Name)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, file := range snapshot.Files {
+				for _, hash := range file.Chunks {
+					referenced[ChunkName(hash)] = true
+				}
+			}
+		case strings.HasPrefix(obj.Name, ChunkPrefix):
+			chunks = append(chunks, obj)
+		}
+	}
+
+	cutoff := time.Now().Add(-gracePeriod)
+
+	var deleted []string
+	for _, chunk := range chunks {
+		if referenced[chunk.Name] || chunk.Created.After(cutoff) {
+			continue
+		}
+
+		if !dryRun {
+			if err := client.Delete(ctx, chunk.Name); err != nil {
+				return deleted, err
+			}
+		}
+
+		deleted = append(deleted, chunk.Name)
+	}
+
+	return deleted, nil
+}
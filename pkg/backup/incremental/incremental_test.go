@@ -0,0 +1,138 @@
+package incremental
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+	"github.com/saulmaldonado/agones-mc/pkg/backup/local"
+)
+
+func TestBackupReusesOnlyRecentChunks(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	client, err := local.New(filepath.Join(dir, "backups"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	world := filepath.Join(dir, "world")
+	if err := os.MkdirAll(world, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte("a"), ChunkSize+10)
+	if err := ioutil.WriteFile(filepath.Join(world, "r.0.0.mca"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := Backup(ctx, client, "a"+SnapshotSuffix, world, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.UploadedChunks != 2 {
+		t.Fatalf("uploaded %d chunks, want 2", stats.UploadedChunks)
+	}
+
+	stats, err = Backup(ctx, client, "b"+SnapshotSuffix, world, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.UploadedChunks != 0 {
+		t.Fatalf("uploaded %d recent chunks again, want 0", stats.UploadedChunks)
+	}
+
+	// chunks older than the reuse age may be deleted by GC at any moment
+	chunks, err := client.List(ctx, ChunkPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	for _, chunk := range chunks {
+		if err := os.Chtimes(filepath.Join(dir, "backups", filepath.FromSlash(chunk.Name)), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err = Backup(ctx, client, "c"+SnapshotSuffix, world, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.UploadedChunks != 2 {
+		t.Fatalf("uploaded %d old chunks, want 2", stats.UploadedChunks)
+	}
+
+	deleted, err := GC(ctx, client, 90*time.Minute, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deleted) != 0 {
+		t.Fatalf("GC deleted re-uploaded chunks %v", deleted)
+	}
+}
+
+func TestUploadWorldsWritesNoSnapshot(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	client, err := local.New(filepath.Join(dir, "backups"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	world := filepath.Join(dir, "world")
+	if err := os.MkdirAll(world, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("level")
+	if err := ioutil.WriteFile(filepath.Join(world, "level.dat"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, stats, err := UploadWorlds(ctx, client, []backup.World{{Name: "world", Path: world}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a backup that fails after its chunks are uploaded leaves no snapshot behind
+	objects, err := client.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, obj := range objects {
+		if IsSnapshot(obj.Name) {
+			t.Fatalf("snapshot %s written before WriteSnapshot", obj.Name)
+		}
+	}
+
+	if err := WriteSnapshot(ctx, client, "a"+SnapshotSuffix, snapshot, stats); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.SnapshotSHA256 == "" || stats.SnapshotSize == 0 {
+		t.Fatalf("snapshot digest not recorded: %+v", stats)
+	}
+
+	target := filepath.Join(dir, "restored")
+	if err := Restore(ctx, client, "a"+SnapshotSuffix, target); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(target, "level.dat"))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("restored level.dat = %q, %v", got, err)
+	}
+}
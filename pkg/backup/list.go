@@ -0,0 +1,94 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Backup in a destination listing
+type Entry struct {
+	Object
+	// Server and time parsed from the backup name. Backups that are not named by Name
+	// have no server and the object's creation time
+	Server string    `json:"server,omitempty"`
+	Time   time.Time `json:"time"`
+	// Manifest of the backup if it has one and manifests were loaded
+	Manifest *Manifest `json:"manifest,omitempty"`
+}
+
+// Backup listing filter. Zero values match every backup
+type Filter struct {
+	// Backup name prefix, e.g. a pod name or the fleet name pod names start with
+	Prefix string
+	// Only backups taken at or after Since and before Until
+	Since time.Time
+	Until time.Time
+}
+
+// Lists the backups in the destination that match the filter, newest first. Manifests, snapshot
+// chunks and other objects that are not named like backups or archives are skipped
+func List(ctx context.Context, client BackupClient, filter Filter) ([]Entry, error) {
+	objects, err := client.List(ctx, filter.Prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, obj := range objects {
+		if IsManifest(obj.Name) {
+			continue
+		}
+
+		entry := Entry{Object: obj, Time: obj.Created}
+
+		if server, t, _, ok := ParseName(obj.Name); ok {
+			entry.Server, entry.Time = server, t
+		} else if !hasArchiveExt(obj.Name) {
+			continue
+		}
+
+		if !filter.Since.IsZero() && entry.Time.Before(filter.Since) {
+			continue
+		}
+
+		if !filter.Until.IsZero() && !entry.Time.Before(filter.Until) {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.After(entries[j].Time) })
+
+	return entries, nil
+}
+
+// Loads the manifest of each entry. Entries without a manifest keep a nil Manifest
+func LoadManifests(ctx context.Context, client BackupClient, entries []Entry) error {
+	for i := range entries {
+		manifest, err := LoadManifest(ctx, client, entries[i].Name)
+		if errors.Is(err, ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		entries[i].Manifest = manifest
+	}
+
+	return nil
+}
+
+func hasArchiveExt(name string) bool {
+	for _, f := range []Format{FormatZip, FormatTarGz, FormatTarZst} {
+		if strings.HasSuffix(name, f.Ext()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package backup
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Client with backups of the servers mc-a and mc-ab, their manifests and objects that are not backups
+func newListClient(t *testing.T) *fakeClient {
+	c := newFakeClient()
+
+	for _, name := range []string{
+		"mc-a-2021-07-01T10:00:00.000Z.zip",
+		"mc-a-2021-07-01T12:00:00.000Z.tar.zst",
+		"mc-a-2021-07-01T14:00:00.000Z.snapshot.json",
+		"mc-ab-2021-07-01T11:00:00.000Z.tar.gz",
+		// made by earlier versions
+		"mc-ab-2021-07-01T13:00:00Z.zip",
+		// uploaded by hand
+		"world.zip",
+		"mc-a-2021-07-01T12:00:00.000Z.tar.zst" + ManifestSuffix,
+		"chunks/ab/abcdef",
+		"leases/mc/backup-0.json",
+		"notes.txt",
+	} {
+		c.objects[name] = []byte(name)
+	}
+
+	return c
+}
+
+func names(entries []Entry) string {
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestList(t *testing.T) {
+	at := func(hour int) time.Time { return time.Date(2021, time.July, 1, hour, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   string
+	}{
+		{"all", Filter{}, "mc-a-2021-07-01T14:00:00.000Z.snapshot.json mc-ab-2021-07-01T13:00:00Z.zip mc-a-2021-07-01T12:00:00.000Z.tar.zst " +
+			"mc-ab-2021-07-01T11:00:00.000Z.tar.gz mc-a-2021-07-01T10:00:00.000Z.zip world.zip"},
+		// prefixes match the servers whose names start with them
+		{"prefix", Filter{Prefix: "mc-a"}, "mc-a-2021-07-01T14:00:00.000Z.snapshot.json mc-ab-2021-07-01T13:00:00Z.zip " +
+			"mc-a-2021-07-01T12:00:00.000Z.tar.zst mc-ab-2021-07-01T11:00:00.000Z.tar.gz mc-a-2021-07-01T10:00:00.000Z.zip"},
+		{"server", Filter{Prefix: "mc-ab-"}, "mc-ab-2021-07-01T13:00:00Z.zip mc-ab-2021-07-01T11:00:00.000Z.tar.gz"},
+		{"since", Filter{Since: at(12)}, "mc-a-2021-07-01T14:00:00.000Z.snapshot.json mc-ab-2021-07-01T13:00:00Z.zip mc-a-2021-07-01T12:00:00.000Z.tar.zst"},
+		{"until", Filter{Until: at(12)}, "mc-ab-2021-07-01T11:00:00.000Z.tar.gz mc-a-2021-07-01T10:00:00.000Z.zip world.zip"},
+		{"since and until", Filter{Prefix: "mc-a-", Since: at(11), Until: at(14)}, "mc-a-2021-07-01T12:00:00.000Z.tar.zst"},
+		{"none", Filter{Prefix: "mc-b"}, ""},
+	}
+
+	for _, tt := range tests {
+		entries, err := List(context.Background(), newListClient(t), tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := names(entries); got != tt.want {
+			t.Errorf("%s: List = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestListEntries(t *testing.T) {
+	entries, err := List(context.Background(), newListClient(t), Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		if entry.Size != int64(len(entry.Name)) {
+			t.Errorf("%s listed with size %d", entry.Name, entry.Size)
+		}
+
+		if entry.Name == "world.zip" {
+			// the time of backups that are not named by Name is their creation time
+			if entry.Server != "" || !entry.Time.Equal(entry.Created) {
+				t.Errorf("%s listed as %s at %s", entry.Name, entry.Server, entry.Time)
+			}
+			continue
+		}
+
+		if server := strings.TrimSuffix(entry.Name[:5], "-"); entry.Server != server {
+			t.Errorf("%s listed with server %s", entry.Name, entry.Server)
+		}
+	}
+}
+
+func TestLoadManifests(t *testing.T) {
+	ctx := context.Background()
+	c := newListClient(t)
+
+	manifest := &Manifest{Name: "mc-a-2021-07-01T12:00:00.000Z.tar.zst", Server: "mc-a", SHA256: "abc"}
+	if err := WriteManifest(ctx, c, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := List(ctx, c, Filter{Prefix: "mc-a-"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadManifests(ctx, c, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		if entry.Name != manifest.Name {
+			if entry.Manifest != nil {
+				t.Errorf("%s listed with manifest %+v", entry.Name, *entry.Manifest)
+			}
+			continue
+		}
+
+		if entry.Manifest == nil || entry.Manifest.SHA256 != "abc" {
+			t.Errorf("%s listed with manifest %+v", entry.Name, entry.Manifest)
+		}
+	}
+
+	// errors other than a missing manifest are returned
+	c.failures["load"] = 10
+	if err := LoadManifests(ctx, c, entries); err == nil {
+		t.Fatal("LoadManifests succeeded while loads fail")
+	}
+}
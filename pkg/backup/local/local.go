@@ -0,0 +1,288 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+)
+
+// URL scheme for local directory destinations, e.g. file:///backups
+const Scheme = "file"
+
+// Backup client that stores archives in a local directory such as a mounted PVC or NFS share
+type LocalClient struct {
+	dir string
+}
+
+func init() {
+	backup.Register(Scheme, func(ctx context.Context, u *url.URL) (backup.BackupClient, error) {
+		if u.Host != "" && u.Host != "localhost" {
+			return nil, fmt.Errorf("local: destination must be an absolute path (file:///path), got %q", u.String())
+		}
+
+		return New(u.Path)
+	})
+}
+
+// Creates a new local backup client. The backup directory is created if it does not exist
+func New(dir string) (backup.BackupClient, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("local: backup directory is empty")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &LocalClient{dir}, nil
+}
+
+// Writes the backup read from r into the backup directory. The backup is written to a temp file
+// first and renamed so a partially written backup is never visible under its final name
+func (l *LocalClient) Backup(ctx context.Context, name string, r io.Reader) error {
+	target, err := l.path(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(target), ".tmp-"+filepath.Base(target))
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, contextReader{ctx, r}); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), target)
+}
+
+// Copies the backup into w
+func (l *LocalClient) Load(ctx context.Context, name string, w io.Writer) error {
+	return l.LoadRange(ctx, name, 0, w)
+}
+
+// Copies the backup from offset into w
+func (l *LocalClient) LoadRange(ctx context.Context, name string, offset int64, w io.Writer) error {
+	source, err := l.path(name)
+	if err != nil {
+		return err
+	}
+
+	r, err := os.Open(source)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", backup.ErrNotExist, name)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, contextReader{ctx, r}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Lists backups in the backup directory whose slash separated relative names start with prefix.
+// In-progress temp files are skipped. Created is the file's modification time
+func (l *LocalClient) List(ctx context.Context, prefix string) ([]backup.Object, error) {
+	var objects []backup.Object
+
+	err := filepath.Walk(l.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".tmp-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(l.dir, p)
+		if err != nil {
+			return err
+		}
+
+		name := filepath.ToSlash(rel)
+		if strings.HasPrefix(name, prefix) {
+			objects = append(objects, backup.Object{Name: name, Size: info.Size(), Created: info.ModTime()})
+		}
+
+		return nil
+	})
+
+	return objects, err
+}
+
+func (l *LocalClient) Delete(ctx context.Context, name string) error {
+	p, err := l.path(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(p)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", backup.ErrNotExist, name)
+	}
+
+	return err
+}
+
+// Reads the object. Its generation is the SHA-256 of its content
+func (l *LocalClient) ReadObject(ctx context.Context, name string) ([]byte, string, error) {
+	p, err := l.path(name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, "", fmt.Errorf("%w: %s", backup.ErrNotExist, name)
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return data, generation(data), nil
+}
+
+// Writes the object if its content is unchanged. Writers are serialized with a lock file next to the
+// object, so processes sharing the directory, e.g. over NFS, can not replace each other's writes
+func (l *LocalClient) WriteObject(ctx context.Context, name string, data []byte, gen string) (string, error) {
+	p, err := l.path(name)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return "", err
+	}
+
+	unlock, err := lock(ctx, filepath.Join(filepath.Dir(p), ".tmp-"+filepath.Base(p)+".lock"))
+	if err != nil {
+		return "", err
+	}
+
+	defer unlock()
+
+	current, err := ioutil.ReadFile(p)
+	switch {
+	case os.IsNotExist(err):
+		if gen != "" {
+			return "", fmt.Errorf("%w: %s", backup.ErrPreconditionFailed, name)
+		}
+	case err != nil:
+		return "", err
+	case gen != generation(current):
+		return "", fmt.Errorf("%w: %s", backup.ErrPreconditionFailed, name)
+	}
+
+	if err := l.Backup(ctx, name, bytes.NewReader(data)); err != nil {
+		return "", err
+	}
+
+	return generation(data), nil
+}
+
+func generation(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Lock files older than this were left behind by a process that died while holding them
+const staleLock = 30 * time.Second
+
+// Creates the lock file, waiting while another process holds it. The returned function removes it
+func lock(ctx context.Context, p string) (func(), error) {
+	for {
+		f, err := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(p) }, nil
+		}
+
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(p); err == nil && time.Since(info.ModTime()) > staleLock {
+			os.Remove(p)
+			continue
+		}
+
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (l *LocalClient) Close() error {
+	return nil
+}
+
+// Reader that stops with the context's error once the context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// Resolves a backup name to a path in the backup directory.
+// Returns an error for names that would escape the directory
+func (l *LocalClient) path(name string) (string, error) {
+	p := filepath.Join(l.dir, filepath.FromSlash(name))
+
+	rel, err := filepath.Rel(l.dir, p)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("local: invalid backup name %q", name)
+	}
+
+	return p, nil
+}
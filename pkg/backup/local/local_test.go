@@ -0,0 +1,354 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+)
+
+func newClient(t *testing.T) (*LocalClient, string) {
+	dir := filepath.Join(t.TempDir(), "backups")
+
+	c, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c.(*LocalClient), dir
+}
+
+// Files in dir and its subdirectories, as slash separated relative paths
+func files(t *testing.T, dir string) []string {
+	var names []string
+
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		names = append(names, filepath.ToSlash(rel))
+		return err
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func TestBackupIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	c, dir := newClient(t)
+
+	if err := c.Backup(ctx, "a.zip", bytes.NewReader([]byte("old"))); err != nil {
+		t.Fatal(err)
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- c.Backup(ctx, "a.zip", pr) }()
+
+	pw.Write([]byte("partial"))
+
+	// the backup being written is neither listed nor loaded
+	objects, err := c.List(ctx, "")
+	if err != nil || len(objects) != 1 || objects[0].Size != 3 {
+		t.Fatalf("List during a backup = %+v, %v", objects, err)
+	}
+
+	var out bytes.Buffer
+	if err := c.Load(ctx, "a.zip", &out); err != nil || out.String() != "old" {
+		t.Fatalf("Load during a backup = %q, %v", out.String(), err)
+	}
+
+	// a failed backup leaves the previous object and no temp file
+	pw.CloseWithError(errors.New("archive failed"))
+	if err := <-done; err == nil {
+		t.Fatal("Backup of a failed reader succeeded")
+	}
+
+	if got := files(t, dir); len(got) != 1 || got[0] != "a.zip" {
+		t.Fatalf("files after a failed backup = %v", got)
+	}
+
+	out.Reset()
+	if err := c.Load(ctx, "a.zip", &out); err != nil || out.String() != "old" {
+		t.Fatalf("Load after a failed backup = %q, %v", out.String(), err)
+	}
+
+	// a finished backup replaces the object
+	if err := c.Backup(ctx, "a.zip", bytes.NewReader([]byte("new"))); err != nil {
+		t.Fatal(err)
+	}
+
+	out.Reset()
+	if err := c.Load(ctx, "a.zip", &out); err != nil || out.String() != "new" {
+		t.Fatalf("Load = %q, %v", out.String(), err)
+	}
+
+	// cancelled backups are not stored
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if err := c.Backup(cancelled, "b.zip", bytes.NewReader([]byte("b"))); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Backup with a cancelled context = %v", err)
+	}
+
+	if got := files(t, dir); len(got) != 1 {
+		t.Fatalf("files after a cancelled backup = %v", got)
+	}
+}
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	c, dir := newClient(t)
+
+	for _, name := range []string{"mc-a-1.zip", "mc-ab-1.zip", "other.zip", "chunks/ab/abcdef"} {
+		if err := c.Backup(ctx, name, bytes.NewReader([]byte(name))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// left behind by a process that died while writing
+	if err := ioutil.WriteFile(filepath.Join(dir, ".tmp-mc-a-2.zip123"), []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]string{
+		"":        {"chunks/ab/abcdef", "mc-a-1.zip", "mc-ab-1.zip", "other.zip"},
+		"mc-a":    {"mc-a-1.zip", "mc-ab-1.zip"},
+		"mc-a-":   {"mc-a-1.zip"},
+		"chunks/": {"chunks/ab/abcdef"},
+		"none":    nil,
+	}
+
+	for prefix, want := range tests {
+		objects, err := c.List(ctx, prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, obj := range objects {
+			got = append(got, obj.Name)
+			if obj.Size != int64(len(obj.Name)) || obj.Created.IsZero() {
+				t.Errorf("%s listed with size %d and created %s", obj.Name, obj.Size, obj.Created)
+			}
+		}
+		sort.Strings(got)
+
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("List(%q) = %v, want %v", prefix, got, want)
+		}
+	}
+}
+
+func TestLoadRange(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newClient(t)
+
+	if err := c.Backup(ctx, "a.zip", bytes.NewReader([]byte("0123456789"))); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := c.LoadRange(ctx, "a.zip", 4, &out); err != nil || out.String() != "456789" {
+		t.Fatalf("LoadRange = %q, %v", out.String(), err)
+	}
+}
+
+func TestNotExist(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newClient(t)
+
+	if err := c.Load(ctx, "missing.zip", ioutil.Discard); !errors.Is(err, backup.ErrNotExist) {
+		t.Errorf("Load = %v, want ErrNotExist", err)
+	}
+
+	if err := c.Delete(ctx, "missing.zip"); !errors.Is(err, backup.ErrNotExist) {
+		t.Errorf("Delete = %v, want ErrNotExist", err)
+	}
+
+	if _, _, err := c.ReadObject(ctx, "missing.json"); !errors.Is(err, backup.ErrNotExist) {
+		t.Errorf("ReadObject = %v, want ErrNotExist", err)
+	}
+
+	if err := c.Backup(ctx, "a.zip", bytes.NewReader(nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Delete(ctx, "a.zip"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Load(ctx, "a.zip", ioutil.Discard); !errors.Is(err, backup.ErrNotExist) {
+		t.Errorf("Load of a deleted backup = %v, want ErrNotExist", err)
+	}
+}
+
+func TestInvalidNames(t *testing.T) {
+	ctx := context.Background()
+	c, dir := newClient(t)
+
+	// a file next to the backup directory that must not be reachable
+	if err := ioutil.WriteFile(filepath.Join(dir, "..", "secret"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"", ".", "..", "../secret", "a/../../secret", "chunks/../../secret"} {
+		if err := c.Backup(ctx, name, bytes.NewReader([]byte("x"))); err == nil {
+			t.Errorf("Backup(%q) succeeded", name)
+		}
+
+		if err := c.Load(ctx, name, ioutil.Discard); err == nil || errors.Is(err, backup.ErrNotExist) {
+			t.Errorf("Load(%q) = %v, want an invalid name error", name, err)
+		}
+
+		if err := c.Delete(ctx, name); err == nil || errors.Is(err, backup.ErrNotExist) {
+			t.Errorf("Delete(%q) = %v, want an invalid name error", name, err)
+		}
+
+		if _, err := c.WriteObject(ctx, name, []byte("x"), ""); err == nil {
+			t.Errorf("WriteObject(%q) succeeded", name)
+		}
+	}
+
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "..", "secret")); err != nil || string(data) != "secret" {
+		t.Fatalf("file outside the backup directory = %q, %v", data, err)
+	}
+
+	// names are cleaned within the directory
+	if err := c.Backup(ctx, "chunks/../a.zip", bytes.NewReader([]byte("a"))); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := files(t, dir); len(got) != 1 || got[0] != "a.zip" {
+		t.Fatalf("files = %v", got)
+	}
+}
+
+func TestWriteObject(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newClient(t)
+
+	gen, err := c.WriteObject(ctx, "lease.json", []byte("a"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only a missing object can be created
+	if _, err := c.WriteObject(ctx, "lease.json", []byte("b"), ""); !errors.Is(err, backup.ErrPreconditionFailed) {
+		t.Fatalf("WriteObject of an existing object = %v, want ErrPreconditionFailed", err)
+	}
+
+	if _, err := c.WriteObject(ctx, "other.json", []byte("b"), gen); !errors.Is(err, backup.ErrPreconditionFailed) {
+		t.Fatalf("WriteObject of a missing object with a generation = %v, want ErrPreconditionFailed", err)
+	}
+
+	data, readGen, err := c.ReadObject(ctx, "lease.json")
+	if err != nil || string(data) != "a" || readGen != gen {
+		t.Fatalf("ReadObject = %q, %s, %v, want generation %s", data, readGen, err, gen)
+	}
+
+	next, err := c.WriteObject(ctx, "lease.json", []byte("b"), gen)
+	if err != nil || next == gen {
+		t.Fatalf("WriteObject = %s, %v", next, err)
+	}
+
+	// writes based on an old read fail
+	if _, err := c.WriteObject(ctx, "lease.json", []byte("c"), gen); !errors.Is(err, backup.ErrPreconditionFailed) {
+		t.Fatalf("WriteObject with a stale generation = %v, want ErrPreconditionFailed", err)
+	}
+}
+
+func TestWriteObjectConcurrent(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newClient(t)
+
+	if _, err := c.WriteObject(ctx, "counter", []byte("0"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// every increment is kept since writers retry after losing to another writer
+	const writers = 8
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				data, gen, err := c.ReadObject(ctx, "counter")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				n, _ := strconv.Atoi(string(data))
+				_, err = c.WriteObject(ctx, "counter", []byte(strconv.Itoa(n+1)), gen)
+				if errors.Is(err, backup.ErrPreconditionFailed) {
+					continue
+				}
+
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	data, _, err := c.ReadObject(ctx, "counter")
+	if err != nil || string(data) != strconv.Itoa(writers) {
+		t.Fatalf("counter = %s, %v, want %d", data, err, writers)
+	}
+}
+
+func TestWriteObjectLock(t *testing.T) {
+	c, dir := newClient(t)
+	lockFile := filepath.Join(dir, ".tmp-lease.json.lock")
+
+	// held by another process
+	if err := ioutil.WriteFile(lockFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.WriteObject(ctx, "lease.json", []byte("a"), ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WriteObject while the lock is held = %v, want the context's error", err)
+	}
+
+	// left behind by a process that died
+	old := time.Now().Add(-2 * staleLock)
+	if err := os.Chtimes(lockFile, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.WriteObject(context.Background(), "lease.json", []byte("a"), ""); err != nil {
+		t.Fatalf("WriteObject with a stale lock = %v", err)
+	}
+
+	if _, err := os.Stat(lockFile); !os.IsNotExist(err) {
+		t.Fatal("lock file was not removed")
+	}
+}
@@ -0,0 +1,127 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+)
+
+// Suffix of the manifest stored alongside each backup
+const ManifestSuffix = ".manifest.json"
+
+const manifestVersion = 1
+
+// Returned by clients when loading an object that does not exist
+var ErrNotExist = errors.New("backup does not exist")
+
+// Metadata describing a backup. Stored as JSON under the backup name with ManifestSuffix appended
+type Manifest struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	// Archive format of full backups. Empty for snapshots
+	Format string `json:"format,omitempty"`
+	// Hex SHA-256 and size of the stored backup object
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	// Files in the world and their total uncompressed size
+	FileCount        int   `json:"fileCount"`
+	UncompressedSize int64 `json:"uncompressedSize"`
+
+	Edition       string `json:"edition"`
+	ServerVersion string `json:"serverVersion,omitempty"`
+	Protocol      int32  `json:"protocol,omitempty"`
+	// World format version. Java Edition DataVersion or Bedrock Edition StorageVersion
+	DataVersion    int32  `json:"dataVersion,omitempty"`
+	StorageVersion int32  `json:"storageVersion,omitempty"`
+	LevelName      string `json:"levelName,omitempty"`
+	// Directories of the worlds in the backup, relative to the root of the backup. In the worlds layout
+	// the first is the server's main world
+	Worlds []string `json:"worlds,omitempty"`
+	// Layout of the archive, WorldsLayout if empty, and the files selected for backup
+	Layout   string    `json:"layout,omitempty"`
+	Contents *Contents `json:"contents,omitempty"`
+	// Fingerprint of the selected files when they were backed up. See Fingerprint
+	Fingerprint string `json:"fingerprint,omitempty"`
+
+	// Encryption algorithm and ID of the key the backup is encrypted with. Empty for unencrypted backups
+	Encryption string `json:"encryption,omitempty"`
+	KeyID      string `json:"keyId,omitempty"`
+
+	Server          string    `json:"server"`
+	Fleet           string    `json:"fleet,omitempty"`
+	AgonesMcVersion string    `json:"agonesMcVersion"`
+	Created         time.Time `json:"created"`
+}
+
+// Returns true if name is a backup manifest
+func IsManifest(name string) bool {
+	return strings.HasSuffix(name, ManifestSuffix)
+}
+
+// Returns the name of the manifest for the named backup
+func ManifestName(name string) string {
+	return name + ManifestSuffix
+}
+
+// Uploads the manifest next to the backup it describes
+func WriteManifest(ctx context.Context, client BackupClient, m *Manifest) error {
+	m.Version = manifestVersion
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return client.Backup(ctx, ManifestName(m.Name), bytes.NewReader(b))
+}
+
+// Downloads the manifest of the named backup. Returns ErrNotExist if the backup has no manifest
+func LoadManifest(ctx context.Context, client BackupClient, name string) (*Manifest, error) {
+	var buf bytes.Buffer
+	if err := client.Load(ctx, ManifestName(name), &buf); err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest for %q: %w", name, err)
+	}
+
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d for %q", m.Version, name)
+	}
+
+	return &m, nil
+}
+
+// Writer computing the SHA-256 and size of everything written to it
+type DigestWriter struct {
+	hash hash.Hash
+	size int64
+}
+
+func NewDigestWriter() *DigestWriter {
+	return &DigestWriter{hash: sha256.New()}
+}
+
+func (d *DigestWriter) Write(p []byte) (int, error) {
+	d.size += int64(len(p))
+	return d.hash.Write(p)
+}
+
+// Hex SHA-256 of the bytes written so far
+func (d *DigestWriter) Sum() string {
+	return hex.EncodeToString(d.hash.Sum(nil))
+}
+
+// Number of bytes written so far
+func (d *DigestWriter) Size() int64 {
+	return d.size
+}
@@ -0,0 +1,67 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Timestamp of backup names. Milliseconds keep backups taken within the same second from overwriting each other
+const nameTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// Returns the backup name for a server's backup taken at t, e.g. mc-server-qfsgr-2021-05-09T09:35:00.000Z.zip
+func Name(server string, t time.Time, ext string) string {
+	return fmt.Sprintf("%s-%s%s", server, t.Format(nameTimeFormat), ext)
+}
+
+// Parses a backup name created by Name into the server name, backup time and extension. Names without
+// milliseconds, made by earlier versions, are parsed too.
+// Returns false for names that do not contain a server name followed by an RFC3339 timestamp
+func ParseName(name string) (server string, t time.Time, ext string, ok bool) {
+	// server names may contain dashes so every dash is tried as the separator
+	for i := strings.Index(name, "-"); i > 0; {
+		rest := name[i+1:]
+
+		if end := timestampEnd(rest); end > 0 {
+			if t, err := time.Parse(time.RFC3339, rest[:end]); err == nil {
+				return name[:i], t, rest[end:], true
+			}
+		}
+
+		next := strings.Index(rest, "-")
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+
+	return "", time.Time{}, "", false
+}
+
+// Returns the length of the RFC3339 timestamp at the start of s or 0 if s does not start with one
+func timestampEnd(s string) int {
+	// 2006-01-02T15:04:05
+	const dateTimeLen = 19
+	if len(s) <= dateTimeLen || s[10] != 'T' {
+		return 0
+	}
+
+	end := dateTimeLen
+
+	// fractional seconds
+	if s[end] == '.' {
+		end++
+		for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+			end++
+		}
+	}
+
+	switch {
+	case end < len(s) && s[end] == 'Z':
+		return end + 1
+	case end+6 <= len(s) && (s[end] == '+' || s[end] == '-'):
+		return end + 6
+	}
+
+	return 0
+}
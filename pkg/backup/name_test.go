@@ -0,0 +1,67 @@
+package backup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestName(t *testing.T) {
+	at := time.Date(2021, time.May, 9, 9, 35, 0, 0, time.UTC)
+
+	if got, want := Name("mc-server-qfsgr", at, ".zip"), "mc-server-qfsgr-2021-05-09T09:35:00.000Z.zip"; got != want {
+		t.Fatalf("Name = %s, want %s", got, want)
+	}
+
+	// backups taken within the same second get different names
+	a := Name("mc-server", at.Add(100*time.Millisecond), ".zip")
+	b := Name("mc-server", at.Add(900*time.Millisecond), ".zip")
+	if a == b {
+		t.Fatalf("backups within the same second are both named %s", a)
+	}
+
+	for _, name := range []string{a, b} {
+		server, parsed, ext, ok := ParseName(name)
+		if !ok || server != "mc-server" || ext != ".zip" || parsed.Truncate(time.Second) != at {
+			t.Errorf("ParseName(%s) = %s, %s, %s, %v", name, server, parsed, ext, ok)
+		}
+	}
+
+	_, ta, _, _ := ParseName(a)
+	_, tb, _, _ := ParseName(b)
+	if !tb.After(ta) {
+		t.Fatalf("%s is not parsed as newer than %s", b, a)
+	}
+}
+
+func TestParseName(t *testing.T) {
+	at := time.Date(2021, time.May, 9, 9, 35, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		server string
+		time   time.Time
+		ext    string
+		ok     bool
+	}{
+		{"mc-server-qfsgr-2021-05-09T09:35:00.000Z.zip", "mc-server-qfsgr", at, ".zip", true},
+		// names from before milliseconds were added
+		{"mc-server-qfsgr-2021-05-09T09:35:00Z.zip", "mc-server-qfsgr", at, ".zip", true},
+		{"mc-server-2021-05-09T09:35:00.123Z.tar.zst", "mc-server", at.Add(123 * time.Millisecond), ".tar.zst", true},
+		{"a-2021-05-09T11:35:00+02:00.snapshot.json", "a", at, ".snapshot.json", true},
+		{"a-2021-05-09T04:35:00.500-05:00", "a", at.Add(500 * time.Millisecond), "", true},
+		// server names with dashes and digits
+		{"mc-2021-fleet-x7k2p-2021-05-09T09:35:00.000Z.zip", "mc-2021-fleet-x7k2p", at, ".zip", true},
+		{"chunks/ab/abcdef", "", time.Time{}, "", false},
+		{"nope-2021", "", time.Time{}, "", false},
+		{"-2021-05-09T09:35:00Z.zip", "", time.Time{}, "", false},
+		{"mc-2021-05-09T09:35:00.zip", "", time.Time{}, "", false},
+		{"mc-2021-13-09T09:35:00Z.zip", "", time.Time{}, "", false},
+	}
+
+	for _, tt := range tests {
+		server, parsed, ext, ok := ParseName(tt.name)
+		if ok != tt.ok || server != tt.server || !parsed.Equal(tt.time) || ext != tt.ext {
+			t.Errorf("ParseName(%s) = %q, %s, %q, %v, want %q, %s, %q, %v", tt.name, server, parsed, ext, ok, tt.server, tt.time, tt.ext, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package backup
+
+import (
+	"errors"
+	"os"
+)
+
+// Reflinks are only made on Linux
+func reflink(dst, src *os.File) error {
+	return errors.New("reflinks are not supported on this platform")
+}
@@ -0,0 +1,70 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// Creates a BackupClient for a destination URL, e.g. gs://bucket/prefix
+type Factory func(ctx context.Context, destination *url.URL) (BackupClient, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Registers a backend factory for the given URL scheme.
+// Backends call Register from their init function. Panics if the scheme is registered twice
+func Register(scheme string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if factory == nil {
+		panic("backup: Register factory is nil")
+	}
+
+	if _, dup := factories[scheme]; dup {
+		panic("backup: Register called twice for scheme " + scheme)
+	}
+
+	factories[scheme] = factory
+}
+
+// Returns the sorted list of registered URL schemes
+func Schemes() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	schemes := make([]string, 0, len(factories))
+	for scheme := range factories {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+
+	return schemes
+}
+
+// Creates a BackupClient for the destination URL using the backend registered for its scheme
+func New(ctx context.Context, destination string) (BackupClient, error) {
+	if destination == "" {
+		return nil, fmt.Errorf("backup destination is empty")
+	}
+
+	u, err := url.Parse(destination)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup destination %q: %w", destination, err)
+	}
+
+	factoriesMu.RLock()
+	factory, ok := factories[u.Scheme]
+	factoriesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unsupported backup destination scheme %q (registered: %v)", u.Scheme, Schemes())
+	}
+
+	return factory(ctx, u)
+}
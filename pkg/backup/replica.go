@@ -0,0 +1,355 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Decides whether an upload to several destinations succeeded
+type ReplicationPolicy string
+
+const (
+	// Every destination must store the backup
+	RequireAll ReplicationPolicy = "all"
+	// The primary destination must store the backup. Failed replicas are only reported
+	RequirePrimary ReplicationPolicy = "primary"
+	// Any destination storing the backup is enough
+	RequireAny ReplicationPolicy = "any"
+)
+
+func ParseReplicationPolicy(s string) (ReplicationPolicy, error) {
+	switch p := ReplicationPolicy(strings.ToLower(s)); p {
+	case RequireAll, RequirePrimary, RequireAny:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown replication policy %q. expected all, primary or any", s)
+	}
+}
+
+// Destination of a ReplicatedClient
+type Destination struct {
+	// Name the destination is reported with, e.g. its URL
+	Name   string
+	Client BackupClient
+}
+
+// Outcome of an upload to one destination
+type ReplicaResult struct {
+	Destination string
+	Err         error
+}
+
+// Returned when an upload did not reach the destinations its policy requires
+type ReplicationError struct {
+	Name    string
+	Policy  ReplicationPolicy
+	Results []ReplicaResult
+}
+
+func (e *ReplicationError) Error() string {
+	var stored int
+	var failures []string
+
+	for _, r := range e.Results {
+		if r.Err == nil {
+			stored++
+			continue
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", r.Destination, r.Err))
+	}
+
+	return fmt.Sprintf("%s stored in %d of %d destinations, replication policy %s requires more: %s",
+		e.Name, stored, len(e.Results), e.Policy, strings.Join(failures, "; "))
+}
+
+// The first failure
+func (e *ReplicationError) Unwrap() error {
+	for _, r := range e.Results {
+		if r.Err != nil {
+			return r.Err
+		}
+	}
+	return nil
+}
+
+// Backup client that uploads every object to several destinations at once, e.g. a local volume and an
+// offsite bucket. The first destination is the primary.
+//
+// The backup is read once. Readers that are io.ReaderAt and io.Seeker, such as spooled archives, are read
+// by each upload independently so failed uploads can be retried. Other readers are streamed to every
+// destination at the pace of the slowest one; a destination that fails is dropped without stopping the others.
+//
+// Downloads are served by the primary and fall back to the replicas. Listings merge the objects of every
+// destination and deletes remove the object from each of them
+type ReplicatedClient struct {
+	destinations []Destination
+	policy       ReplicationPolicy
+
+	// Called with the result of each destination after every upload, e.g. for logging
+	OnResult func(name string, result ReplicaResult)
+}
+
+func NewReplicatedClient(policy ReplicationPolicy, primary Destination, replicas ...Destination) *ReplicatedClient {
+	return &ReplicatedClient{destinations: append([]Destination{primary}, replicas...), policy: policy}
+}
+
+// The primary destination's client
+func (c *ReplicatedClient) Unwrap() BackupClient {
+	return c.destinations[0].Client
+}
+
+// Uploads the backup to every destination. Returns a *ReplicationError if the uploads that succeeded
+// do not satisfy the replication policy
+func (c *ReplicatedClient) Backup(ctx context.Context, name string, r io.Reader) error {
+	var results []ReplicaResult
+	var err error
+
+	if ra, start, end, ok := sections(r); ok {
+		results = c.backupSections(ctx, name, ra, start, end)
+		r.(io.Seeker).Seek(end, io.SeekStart)
+	} else if results, err = c.backupStream(ctx, name, r); err != nil {
+		// the backup itself could not be read
+		return err
+	}
+
+	for _, result := range results {
+		if c.OnResult != nil {
+			c.OnResult(name, result)
+		}
+	}
+
+	if !c.satisfied(results) {
+		return &ReplicationError{Name: name, Policy: c.policy, Results: results}
+	}
+
+	return nil
+}
+
+// Returns r as an io.ReaderAt with its current offset and size, if it is one
+func sections(r io.Reader) (io.ReaderAt, int64, int64, bool) {
+	ra, ok := r.(io.ReaderAt)
+	seeker, isSeeker := r.(io.Seeker)
+	if !ok || !isSeeker {
+		return nil, 0, 0, false
+	}
+
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, 0, 0, false
+	}
+
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, 0, false
+	}
+
+	if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+		return nil, 0, 0, false
+	}
+
+	return ra, start, end, true
+}
+
+func (c *ReplicatedClient) backupSections(ctx context.Context, name string, ra io.ReaderAt, start, end int64) []ReplicaResult {
+	results := make([]ReplicaResult, len(c.destinations))
+
+	var wg sync.WaitGroup
+	for i, d := range c.destinations {
+		wg.Add(1)
+		go func(i int, d Destination) {
+			defer wg.Done()
+			err := d.Client.Backup(ctx, name, io.NewSectionReader(ra, start, end-start))
+			results[i] = ReplicaResult{d.Name, err}
+		}(i, d)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// Streams r to every destination through pipes. Returns an error if reading r fails
+func (c *ReplicatedClient) backupStream(ctx context.Context, name string, r io.Reader) ([]ReplicaResult, error) {
+	results := make([]ReplicaResult, len(c.destinations))
+	pipes := make([]*io.PipeWriter, len(c.destinations))
+
+	var wg sync.WaitGroup
+	for i, d := range c.destinations {
+		pr, pw := io.Pipe()
+		pipes[i] = pw
+
+		wg.Add(1)
+		go func(i int, d Destination) {
+			defer wg.Done()
+			err := d.Client.Backup(ctx, name, pr)
+			// unblocks writes to an upload that stopped reading
+			pr.CloseWithError(errUploadStopped)
+			results[i] = ReplicaResult{d.Name, err}
+		}(i, d)
+	}
+
+	// destinations still reading the backup
+	live := make([]bool, len(pipes))
+	for i := range live {
+		live[i] = true
+	}
+
+	buf := make([]byte, 1<<20)
+	var readErr error
+
+	for {
+		n, err := r.Read(buf)
+
+		if n > 0 {
+			for i, pw := range pipes {
+				if live[i] {
+					if _, err := pw.Write(buf[:n]); err != nil {
+						live[i] = false
+					}
+				}
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+
+	for _, pw := range pipes {
+		pw.CloseWithError(readErr)
+	}
+
+	wg.Wait()
+
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	for i := range results {
+		// an upload that returned before reading the whole backup did not store all of it
+		if !live[i] && results[i].Err == nil {
+			results[i].Err = errUploadStopped
+		}
+	}
+
+	return results, nil
+}
+
+var errUploadStopped = errors.New("upload stopped before the backup was fully read")
+
+func (c *ReplicatedClient) satisfied(results []ReplicaResult) bool {
+	switch c.policy {
+	case RequirePrimary:
+		return results[0].Err == nil
+	case RequireAny:
+		for _, r := range results {
+			if r.Err == nil {
+				return true
+			}
+		}
+		return false
+	default:
+		for _, r := range results {
+			if r.Err != nil {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Downloads the backup from the first destination that has it. A destination that fails after writing
+// to w can not be fallen back from
+func (c *ReplicatedClient) Load(ctx context.Context, name string, w io.Writer) error {
+	cw := &countWriter{w: w}
+
+	var firstErr error
+	for _, d := range c.destinations {
+		err := d.Client.Load(ctx, name, cw)
+		if err == nil || cw.n > 0 || ctx.Err() != nil {
+			return err
+		}
+
+		if firstErr == nil || errors.Is(firstErr, ErrNotExist) {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Lists the objects of every destination. Objects stored in several destinations are listed once,
+// as stored in the first of them
+func (c *ReplicatedClient) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	seen := make(map[string]bool)
+
+	for _, d := range c.destinations {
+		list, err := d.Client.List(ctx, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", d.Name, err)
+		}
+
+		for _, obj := range list {
+			if !seen[obj.Name] {
+				seen[obj.Name] = true
+				objects = append(objects, obj)
+			}
+		}
+	}
+
+	return objects, nil
+}
+
+// Deletes the object from every destination. Returns ErrNotExist only if no destination had it
+func (c *ReplicatedClient) Delete(ctx context.Context, name string) error {
+	var firstErr error
+	missing := 0
+
+	for _, d := range c.destinations {
+		err := d.Client.Delete(ctx, name)
+		if errors.Is(err, ErrNotExist) {
+			missing++
+			continue
+		}
+
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s: %w", d.Name, err)
+		}
+	}
+
+	if firstErr == nil && missing == len(c.destinations) {
+		return fmt.Errorf("%w: %s", ErrNotExist, name)
+	}
+
+	return firstErr
+}
+
+func (c *ReplicatedClient) Close() error {
+	var firstErr error
+	for _, d := range c.destinations {
+		if err := d.Client.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,280 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Client whose uploads stop after reading a few bytes of the backup, with err
+type stoppedClient struct {
+	*fakeClient
+	err error
+}
+
+func (c stoppedClient) Backup(ctx context.Context, name string, r io.Reader) error {
+	io.CopyN(ioutil.Discard, r, 10)
+	return c.err
+}
+
+// Client whose loads write part of the object before failing
+type brokenClient struct {
+	*fakeClient
+}
+
+func (c brokenClient) Load(ctx context.Context, name string, w io.Writer) error {
+	w.Write([]byte("par"))
+	return errReset
+}
+
+func TestParseReplicationPolicy(t *testing.T) {
+	for s, want := range map[string]ReplicationPolicy{"all": RequireAll, "Primary": RequirePrimary, "ANY": RequireAny} {
+		if got, err := ParseReplicationPolicy(s); err != nil || got != want {
+			t.Errorf("ParseReplicationPolicy(%s) = %s, %v", s, got, err)
+		}
+	}
+
+	if _, err := ParseReplicationPolicy("most"); err == nil {
+		t.Error("ParseReplicationPolicy accepted an unknown policy")
+	}
+}
+
+func TestReplicatedBackup(t *testing.T) {
+	// larger than the buffer backups are streamed with
+	data := bytes.Repeat([]byte("0123456789"), 300000)
+
+	tests := []struct {
+		name   string
+		policy ReplicationPolicy
+		// failing destinations, the primary first
+		failing []bool
+		// a failing destination returns success without reading the whole backup
+		stopped bool
+		wantErr bool
+	}{
+		{name: "all stored", policy: RequireAll, failing: []bool{false, false, false}},
+		{name: "all with a failed replica", policy: RequireAll, failing: []bool{false, false, true}, wantErr: true},
+		{name: "primary with a failed replica", policy: RequirePrimary, failing: []bool{false, true, true}},
+		{name: "primary failed", policy: RequirePrimary, failing: []bool{true, false, false}, wantErr: true},
+		{name: "any with a failed primary", policy: RequireAny, failing: []bool{true, true, false}},
+		{name: "any failed", policy: RequireAny, failing: []bool{true, true, true}, wantErr: true},
+		{name: "upload stopped", policy: RequireAll, failing: []bool{false, true}, stopped: true, wantErr: true},
+	}
+
+	readers := map[string]func() io.Reader{
+		// streamed to every destination
+		"stream": func() io.Reader { return io.MultiReader(bytes.NewReader(data)) },
+		// read by each destination from the reader's offset
+		"sections": func() io.Reader {
+			r := io.NewSectionReader(bytes.NewReader(append([]byte("skipped"), data...)), 0, int64(len(data)+7))
+			r.Seek(7, io.SeekStart)
+			return r
+		},
+	}
+
+	for _, tt := range tests {
+		for kind, reader := range readers {
+			// an upload that does not read the whole section is not noticed
+			if tt.stopped && kind == "sections" {
+				continue
+			}
+
+			t.Run(tt.name+"/"+kind, func(t *testing.T) {
+				var destinations []Destination
+				for i, failing := range tt.failing {
+					fake := newFakeClient()
+					d := Destination{Name: string(rune('a' + i)), Client: fake}
+
+					if failing && tt.stopped {
+						d.Client = stoppedClient{fake, nil}
+					} else if failing {
+						d.Client = stoppedClient{fake, errReset}
+					}
+
+					destinations = append(destinations, d)
+				}
+
+				c := NewReplicatedClient(tt.policy, destinations[0], destinations[1:]...)
+
+				var mu sync.Mutex
+				reported := map[string]error{}
+				c.OnResult = func(name string, result ReplicaResult) {
+					mu.Lock()
+					defer mu.Unlock()
+					reported[result.Destination] = result.Err
+				}
+
+				r := reader()
+				err := c.Backup(context.Background(), "a.zip", r)
+
+				var replErr *ReplicationError
+				if tt.wantErr != errors.As(err, &replErr) {
+					t.Fatalf("Backup = %v, want a ReplicationError %v", err, tt.wantErr)
+				}
+
+				if replErr != nil && (replErr.Policy != tt.policy || len(replErr.Results) != len(destinations)) {
+					t.Fatalf("ReplicationError = %+v", replErr)
+				}
+
+				if len(reported) != len(destinations) {
+					t.Fatalf("OnResult called for %d of %d destinations", len(reported), len(destinations))
+				}
+
+				for i, d := range destinations {
+					if failed := reported[d.Name] != nil; failed != tt.failing[i] {
+						t.Errorf("destination %s reported error %v", d.Name, reported[d.Name])
+					}
+
+					if tt.failing[i] {
+						continue
+					}
+
+					if stored := d.Client.(*fakeClient).objects["a.zip"]; !bytes.Equal(stored, data) {
+						t.Errorf("destination %s stored %d of %d bytes", d.Name, len(stored), len(data))
+					}
+				}
+
+				// the backup is read to its end
+				if n, _ := r.Read(make([]byte, 1)); n != 0 {
+					t.Error("backup was not read to its end")
+				}
+			})
+		}
+	}
+}
+
+func TestReplicatedBackupReadError(t *testing.T) {
+	a, b := newFakeClient(), newFakeClient()
+	c := NewReplicatedClient(RequireAny, Destination{"a", a}, Destination{"b", b})
+
+	r := io.MultiReader(strings.NewReader("partial"), &failingReader{errReset})
+	if err := c.Backup(context.Background(), "a.zip", r); !errors.Is(err, errReset) {
+		t.Fatalf("Backup = %v, want the read error", err)
+	}
+
+	if len(a.objects)+len(b.objects) != 0 {
+		t.Fatal("a partially read backup was stored")
+	}
+}
+
+type failingReader struct {
+	err error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+func TestReplicatedLoad(t *testing.T) {
+	ctx := context.Background()
+
+	primary, replica := newFakeClient(), newFakeClient()
+	primary.objects["both.zip"] = []byte("primary")
+	replica.objects["both.zip"] = []byte("replica")
+	replica.objects["replica.zip"] = []byte("replica")
+
+	c := NewReplicatedClient(RequireAll, Destination{"primary", primary}, Destination{"replica", replica})
+
+	tests := []struct {
+		name string
+		want string
+		err  error
+	}{
+		{"both.zip", "primary", nil},
+		// falls back to the replica
+		{"replica.zip", "replica", nil},
+		{"missing.zip", "", ErrNotExist},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		err := c.Load(ctx, tt.name, &out)
+		if !errors.Is(err, tt.err) || out.String() != tt.want {
+			t.Errorf("Load(%s) = %q, %v, want %q, %v", tt.name, out.String(), err, tt.want, tt.err)
+		}
+	}
+
+	// a failed primary is reported over a replica that does not have the backup
+	failing := newFakeClient()
+	failing.failures["load"] = 1
+	failing.objects["a.zip"] = []byte("a")
+
+	c = NewReplicatedClient(RequireAll, Destination{"primary", failing}, Destination{"replica", newFakeClient()})
+	if err := c.Load(ctx, "a.zip", ioutil.Discard); !errors.Is(err, errReset) {
+		t.Errorf("Load = %v, want the primary's error", err)
+	}
+
+	// a download that wrote to w is not retried from the replica
+	c = NewReplicatedClient(RequireAll, Destination{"primary", brokenClient{newFakeClient()}}, Destination{"replica", replica})
+
+	var out bytes.Buffer
+	if err := c.Load(ctx, "replica.zip", &out); !errors.Is(err, errReset) || out.String() != "par" {
+		t.Errorf("Load = %q, %v, want the partial download's error", out.String(), err)
+	}
+}
+
+func TestReplicatedList(t *testing.T) {
+	primary, replica := newFakeClient(), newFakeClient()
+	primary.objects["a.zip"] = []byte("a")
+	replica.objects["a.zip"] = []byte("a from the replica")
+	replica.objects["b.zip"] = []byte("b")
+	replica.objects["other"] = []byte("other")
+
+	c := NewReplicatedClient(RequireAll, Destination{"primary", primary}, Destination{"replica", replica})
+
+	objects, err := c.List(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+
+	if len(objects) != 3 || objects[0].Name != "a.zip" || objects[0].Size != 1 || objects[1].Name != "b.zip" {
+		t.Fatalf("List = %+v, want a.zip as stored in the primary, b.zip and other", objects)
+	}
+
+	replica.failures["list"] = 1
+	if _, err := c.List(context.Background(), ""); !errors.Is(err, errReset) || !strings.HasPrefix(err.Error(), "replica: ") {
+		t.Fatalf("List = %v, want the replica's error", err)
+	}
+}
+
+func TestReplicatedDelete(t *testing.T) {
+	ctx := context.Background()
+
+	primary, replica := newFakeClient(), newFakeClient()
+	replica.objects["a.zip"] = []byte("a")
+
+	c := NewReplicatedClient(RequireAll, Destination{"primary", primary}, Destination{"replica", replica})
+
+	// a backup missing from some destinations is deleted from the others
+	if err := c.Delete(ctx, "a.zip"); err != nil {
+		t.Fatalf("Delete = %v", err)
+	}
+
+	if _, ok := replica.objects["a.zip"]; ok {
+		t.Fatal("backup was not deleted from the replica")
+	}
+
+	if err := c.Delete(ctx, "a.zip"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("Delete of a missing backup = %v, want ErrNotExist", err)
+	}
+
+	primary.objects["b.zip"] = []byte("b")
+	replica.objects["b.zip"] = []byte("b")
+	replica.failures["delete"] = 1
+
+	if err := c.Delete(ctx, "b.zip"); !errors.Is(err, errReset) || errors.Is(err, ErrNotExist) {
+		t.Fatalf("Delete = %v, want the replica's error", err)
+	}
+
+	if _, ok := primary.objects["b.zip"]; ok {
+		t.Fatal("backup was not deleted from the primary")
+	}
+}
@@ -0,0 +1,63 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Backup name specs that are resolved against the backups in a destination
+const (
+	// The most recent backup. latest:<prefix> is the most recent backup whose name starts with prefix
+	Latest = "latest"
+	// before:<RFC3339 time> is the most recent backup taken before the time
+	Before = "before"
+)
+
+// Returns true if name is a spec resolved by Resolve rather than a backup name
+func IsSpec(name string) bool {
+	return name == Latest || strings.HasPrefix(name, Latest+":") || strings.HasPrefix(name, Before+":")
+}
+
+// Resolves a backup name spec to the name of a backup in the destination. Names that are not
+// specs are returned unchanged. Returns an error wrapping ErrNotExist if no backup matches the spec
+func Resolve(ctx context.Context, client BackupClient, spec string) (string, error) {
+	if !IsSpec(spec) {
+		return spec, nil
+	}
+
+	var filter Filter
+
+	if kind, arg, ok := cut(spec, ":"); ok {
+		switch kind {
+		case Latest:
+			filter.Prefix = arg
+		case Before:
+			t, err := time.Parse(time.RFC3339, arg)
+			if err != nil {
+				return "", fmt.Errorf("invalid backup spec %q: %w", spec, err)
+			}
+			filter.Until = t
+		}
+	}
+
+	entries, err := List(ctx, client, filter)
+	if err != nil {
+		return "", err
+	}
+
+	// entries are sorted newest first
+	if len(entries) == 0 {
+		return "", fmt.Errorf("%w: no backups match %q", ErrNotExist, spec)
+	}
+
+	return entries[0].Name, nil
+}
+
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
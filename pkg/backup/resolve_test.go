@@ -0,0 +1,90 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestIsSpec(t *testing.T) {
+	tests := map[string]bool{
+		"latest":                            true,
+		"latest:mc-a-":                      true,
+		"latest:":                           true,
+		"before:2021-07-01T12:00:00Z":       true,
+		"before:":                           true,
+		"mc-a-2021-07-01T10:00:00.000Z.zip": false,
+		"latest.zip":                        false,
+		"before":                            false,
+		"":                                  false,
+	}
+
+	for name, want := range tests {
+		if got := IsSpec(name); got != want {
+			t.Errorf("IsSpec(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"latest", "mc-a-2021-07-01T14:00:00.000Z.snapshot.json"},
+		{"latest:mc-ab-", "mc-ab-2021-07-01T13:00:00Z.zip"},
+		// the prefix matches every server whose name starts with it
+		{"latest:mc-a", "mc-a-2021-07-01T14:00:00.000Z.snapshot.json"},
+		{"latest:", "mc-a-2021-07-01T14:00:00.000Z.snapshot.json"},
+		// backups taken at the time are not before it
+		{"before:2021-07-01T12:00:00Z", "mc-ab-2021-07-01T11:00:00.000Z.tar.gz"},
+		{"before:2021-07-01T12:00:00.001Z", "mc-a-2021-07-01T12:00:00.000Z.tar.zst"},
+		{"before:2021-07-01T14:30:00+01:00", "mc-ab-2021-07-01T13:00:00Z.zip"},
+		{"before:2021-07-02T00:00:00Z", "mc-a-2021-07-01T14:00:00.000Z.snapshot.json"},
+		// backups without a time in their name are listed at their creation time
+		{"before:2021-07-01T10:00:00Z", "world.zip"},
+		// names are not resolved
+		{"mc-a-2021-07-01T10:00:00.000Z.zip", "mc-a-2021-07-01T10:00:00.000Z.zip"},
+		{"mc-a-2021-07-01T00:00:00.000Z.zip", "mc-a-2021-07-01T00:00:00.000Z.zip"},
+	}
+
+	for _, tt := range tests {
+		got, err := Resolve(context.Background(), newListClient(t), tt.spec)
+		if err != nil || got != tt.want {
+			t.Errorf("Resolve(%s) = %s, %v, want %s", tt.spec, got, err, tt.want)
+		}
+	}
+}
+
+func TestResolveMissing(t *testing.T) {
+	for _, spec := range []string{"latest:mc-b", "latest:world.", "before:2021-07-01T00:00:00Z"} {
+		c := newListClient(t)
+		delete(c.objects, "world.zip")
+
+		if got, err := Resolve(context.Background(), c, spec); !errors.Is(err, ErrNotExist) {
+			t.Errorf("Resolve(%s) = %s, %v, want ErrNotExist", spec, got, err)
+		}
+	}
+
+	// a destination without backups
+	if got, err := Resolve(context.Background(), newFakeClient(), Latest); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Resolve(latest) without backups = %s, %v, want ErrNotExist", got, err)
+	}
+}
+
+func TestResolveInvalid(t *testing.T) {
+	for _, spec := range []string{"before:yesterday", "before:2021-07-01", "before:"} {
+		got, err := Resolve(context.Background(), newListClient(t), spec)
+		if err == nil || errors.Is(err, ErrNotExist) {
+			t.Errorf("Resolve(%s) = %s, %v, want an invalid spec error", spec, got, err)
+		}
+	}
+
+	// listing errors are returned
+	c := newListClient(t)
+	c.failures["list"] = 1
+
+	if _, err := Resolve(context.Background(), c, Latest); !errors.Is(err, errReset) {
+		t.Errorf("Resolve while listing fails = %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+)
+
+// Retention policy applied to each server's backups.
+// A backup is kept if it is one of the KeepLast most recent backups or the most recent backup of one of the
+// KeepDaily most recent days, KeepWeekly weeks or KeepMonthly months. Backups older than MaxAge are removed.
+// When no Keep* count is set every backup younger than MaxAge is kept.
+// The most recent backup of a server is always kept
+type Policy struct {
+	KeepLast    int
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+	MaxAge      time.Duration
+}
+
+// Backup object with the server name and time parsed from its name
+type Backup struct {
+	backup.Object
+	Server string
+	Time   time.Time
+}
+
+// Returns true if the policy keeps every backup
+func (p Policy) Empty() bool {
+	return p.KeepLast <= 0 && p.KeepDaily <= 0 && p.KeepWeekly <= 0 && p.KeepMonthly <= 0 && p.MaxAge <= 0
+}
+
+func (p Policy) String() string {
+	return fmt.Sprintf("last=%d daily=%d weekly=%d monthly=%d maxAge=%v", p.KeepLast, p.KeepDaily, p.KeepWeekly, p.KeepMonthly, p.MaxAge)
+}
+
+// Splits a single server's backups into the ones to keep and the ones to remove. Both are sorted newest first
+func (p Policy) Apply(backups []Backup, now time.Time) (keep, remove []Backup) {
+	sorted := make([]Backup, len(backups))
+	copy(sorted, backups)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.After(sorted[j].Time) })
+
+	kept := make([]bool, len(sorted))
+
+	if p.KeepLast <= 0 && p.KeepDaily <= 0 && p.KeepWeekly <= 0 && p.KeepMonthly <= 0 {
+		for i := range kept {
+			kept[i] = true
+		}
+	}
+
+	for i := 0; i < p.KeepLast && i < len(sorted); i++ {
+		kept[i] = true
+	}
+
+	keepPeriods(sorted, kept, p.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") })
+	keepPeriods(sorted, kept, p.KeepWeekly, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	})
+	keepPeriods(sorted, kept, p.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") })
+
+	if p.MaxAge > 0 {
+		for i := range sorted {
+			if now.Sub(sorted[i].Time) > p.MaxAge {
+				kept[i] = false
+			}
+		}
+	}
+
+	if len(sorted) > 0 {
+		kept[0] = true
+	}
+
+	for i, b := range sorted {
+		if kept[i] {
+			keep = append(keep, b)
+		} else {
+			remove = append(remove, b)
+		}
+	}
+
+	return keep, remove
+}
+
+// Keeps the newest backup of each of the n most recent periods. backups must be sorted newest first
+func keepPeriods(backups []Backup, kept []bool, n int, period func(t time.Time) string) {
+	if n <= 0 {
+		return
+	}
+
+	seen := make(map[string]bool)
+	for i, b := range backups {
+		key := period(b.Time.UTC())
+		if seen[key] {
+			continue
+		}
+
+		if len(seen) == n {
+			return
+		}
+
+		seen[key] = true
+		kept[i] = true
+	}
+}
+
+// Groups the listed objects that are named like backups by server. Manifests and other objects are ignored
+func GroupByServer(objects []backup.Object) map[string][]Backup {
+	servers := make(map[string][]Backup)
+
+	for _, obj := range objects {
+		if backup.IsManifest(obj.Name) {
+			continue
+		}
+
+		server, t, _, ok := backup.ParseName(obj.Name)
+		if !ok {
+			continue
+		}
+
+		servers[server] = append(servers[server], Backup{obj, server, t})
+	}
+
+	return servers
+}
+
+// Applies the policy to the backups of the given server, or of every server if server is empty,
+// and deletes the backups it does not keep along with their manifests. Returns the removed backups, or the backups that would be
+// removed when dryRun is set
+func Prune(ctx context.Context, client backup.BackupClient, policy Policy, server string, now time.Time, dryRun bool) ([]Backup, error) {
+	if policy.Empty() {
+		return nil, nil
+	}
+
+	objects, err := client.List(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := make(map[string]bool)
+	for _, obj := range objects {
+		if backup.IsManifest(obj.Name) {
+			manifests[obj.Name] = true
+		}
+	}
+
+	var removed []Backup
+	for name, backups := range GroupByServer(objects) {
+		if server != "" && name != server {
+			continue
+		}
+
+		_, remove := policy.Apply(backups, now)
+
+		for _, b := range remove {
+			if !dryRun {
+				if err := client.Delete(ctx, b.Name); err != nil {
+					return removed, err
+				}
+
+				if manifest := backup.ManifestName(b.Name); manifests[manifest] {
+					if err := client.Delete(ctx, manifest); err != nil {
+						return removed, err
+					}
+				}
+			}
+
+			removed = append(removed, b)
+		}
+	}
+
+	return removed, nil
+}
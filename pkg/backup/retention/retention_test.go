@@ -0,0 +1,270 @@
+package retention
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+	"github.com/saulmaldonado/agones-mc/pkg/backup/local"
+)
+
+// Backups of server mc taken every 12 hours from May 1 to July 1 2021, newest 2021-07-01T12:00:00Z
+func twiceDaily() []string {
+	var names []string
+	for t := time.Date(2021, time.May, 1, 0, 0, 0, 0, time.UTC); !t.After(time.Date(2021, time.July, 1, 12, 0, 0, 0, time.UTC)); t = t.Add(12 * time.Hour) {
+		names = append(names, backup.Name("mc", t, ".zip"))
+	}
+	return names
+}
+
+func backups(t *testing.T, names []string) []Backup {
+	var objects []backup.Object
+	for _, name := range names {
+		objects = append(objects, backup.Object{Name: name})
+	}
+
+	servers := GroupByServer(objects)
+	if len(servers) != 1 {
+		t.Fatalf("backups of %d servers, want 1", len(servers))
+	}
+
+	return servers["mc"]
+}
+
+func names(backups []Backup) string {
+	var n []string
+	for _, b := range backups {
+		n = append(n, b.Name)
+	}
+	return strings.Join(n, " ")
+}
+
+func TestApply(t *testing.T) {
+	now := time.Date(2021, time.July, 1, 13, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		backups []string
+		policy  Policy
+		keep    []string
+	}{
+		{
+			name:    "keep last",
+			backups: twiceDaily(),
+			policy:  Policy{KeepLast: 3},
+			keep: []string{
+				"mc-2021-07-01T12:00:00.000Z.zip",
+				"mc-2021-07-01T00:00:00.000Z.zip",
+				"mc-2021-06-30T12:00:00.000Z.zip",
+			},
+		},
+		{
+			// 2021-07-01 is a Thursday of ISO week 26, which starts on June 28
+			name:    "keep last with daily, weekly and monthly",
+			backups: twiceDaily(),
+			policy:  Policy{KeepLast: 2, KeepDaily: 3, KeepWeekly: 2, KeepMonthly: 3},
+			keep: []string{
+				"mc-2021-07-01T12:00:00.000Z.zip",
+				"mc-2021-07-01T00:00:00.000Z.zip",
+				"mc-2021-06-30T12:00:00.000Z.zip",
+				"mc-2021-06-29T12:00:00.000Z.zip",
+				"mc-2021-06-27T12:00:00.000Z.zip",
+				"mc-2021-05-31T12:00:00.000Z.zip",
+			},
+		},
+		{
+			name:    "max age",
+			backups: twiceDaily(),
+			policy:  Policy{KeepLast: 2, KeepDaily: 3, KeepWeekly: 2, KeepMonthly: 3, MaxAge: 10 * 24 * time.Hour},
+			keep: []string{
+				"mc-2021-07-01T12:00:00.000Z.zip",
+				"mc-2021-07-01T00:00:00.000Z.zip",
+				"mc-2021-06-30T12:00:00.000Z.zip",
+				"mc-2021-06-29T12:00:00.000Z.zip",
+				"mc-2021-06-27T12:00:00.000Z.zip",
+			},
+		},
+		{
+			name:    "max age only",
+			backups: twiceDaily(),
+			policy:  Policy{MaxAge: 25 * time.Hour},
+			keep: []string{
+				"mc-2021-07-01T12:00:00.000Z.zip",
+				"mc-2021-07-01T00:00:00.000Z.zip",
+				"mc-2021-06-30T12:00:00.000Z.zip",
+			},
+		},
+		{
+			name:    "newest is always kept",
+			backups: []string{"mc-2021-01-01T00:00:00Z.zip", "mc-2021-01-02T00:00:00Z.zip"},
+			policy:  Policy{MaxAge: time.Hour},
+			keep:    []string{"mc-2021-01-02T00:00:00Z.zip"},
+		},
+		{
+			name: "same second",
+			backups: []string{
+				"mc-2021-07-01T00:00:00.250Z.zip",
+				"mc-2021-07-01T00:00:00Z.zip",
+				"mc-2021-07-01T00:00:00.750Z.snapshot.json",
+			},
+			policy: Policy{KeepLast: 2},
+			keep: []string{
+				"mc-2021-07-01T00:00:00.750Z.snapshot.json",
+				"mc-2021-07-01T00:00:00.250Z.zip",
+			},
+		},
+		{
+			// 01:00+02:00 on July 2 is 23:00 UTC on July 1, so it is the newest backup of July 1
+			name: "days are UTC days",
+			backups: []string{
+				"mc-2021-07-01T10:00:00Z.zip",
+				"mc-2021-07-02T01:00:00+02:00.zip",
+				"mc-2021-07-02T03:00:00+02:00.zip",
+			},
+			policy: Policy{KeepDaily: 2},
+			keep: []string{
+				"mc-2021-07-02T03:00:00+02:00.zip",
+				"mc-2021-07-02T01:00:00+02:00.zip",
+			},
+		},
+		{
+			// 2021-01-03 is in ISO week 53 of 2020
+			name: "weeks are ISO weeks",
+			backups: []string{
+				"mc-2020-12-28T00:00:00Z.zip",
+				"mc-2021-01-01T00:00:00Z.zip",
+				"mc-2021-01-03T00:00:00Z.zip",
+				"mc-2021-01-04T00:00:00Z.zip",
+			},
+			policy: Policy{KeepWeekly: 2},
+			keep: []string{
+				"mc-2021-01-04T00:00:00Z.zip",
+				"mc-2021-01-03T00:00:00Z.zip",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			all := backups(t, tt.backups)
+			keep, remove := tt.policy.Apply(all, now)
+
+			if got, want := names(keep), strings.Join(tt.keep, " "); got != want {
+				t.Errorf("kept\n%s\nwant\n%s", strings.ReplaceAll(got, " ", "\n"), strings.ReplaceAll(want, " ", "\n"))
+			}
+
+			if len(keep)+len(remove) != len(all) {
+				t.Fatalf("kept %d and removed %d of %d backups", len(keep), len(remove), len(all))
+			}
+
+			for i := 1; i < len(remove); i++ {
+				if remove[i].Time.After(remove[i-1].Time) {
+					t.Fatal("removed backups are not sorted newest first")
+				}
+			}
+		})
+	}
+}
+
+func TestApplyEmpty(t *testing.T) {
+	keep, remove := Policy{KeepLast: 1}.Apply(nil, time.Now())
+	if keep != nil || remove != nil {
+		t.Fatalf("Apply(nil) = %v, %v", keep, remove)
+	}
+}
+
+func TestGroupByServer(t *testing.T) {
+	objects := []backup.Object{
+		{Name: "mc-server-abcde-2021-07-01T00:00:00.000Z.zip"},
+		{Name: "mc-server-abcde-2021-07-01T00:00:00.000Z.zip" + backup.ManifestSuffix},
+		{Name: "mc-server-fghij-2021-07-01T00:00:00Z.tar.zst"},
+		{Name: "mc-server-abcde-2021-07-02T00:00:00.000Z.snapshot.json"},
+		{Name: "chunks/ab/abcdef"},
+		{Name: "world.zip"},
+	}
+
+	servers := GroupByServer(objects)
+
+	var got []string
+	for server, backups := range servers {
+		got = append(got, server+"="+names(backups))
+	}
+	sort.Strings(got)
+
+	want := []string{
+		"mc-server-abcde=mc-server-abcde-2021-07-01T00:00:00.000Z.zip mc-server-abcde-2021-07-02T00:00:00.000Z.snapshot.json",
+		"mc-server-fghij=mc-server-fghij-2021-07-01T00:00:00Z.tar.zst",
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("GroupByServer =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+
+	client, err := local.New(filepath.Join(t.TempDir(), "backups"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objects := []string{
+		"mc-a-2021-07-01T00:00:00.000Z.zip",
+		"mc-a-2021-07-02T00:00:00.000Z.zip",
+		"mc-a-2021-07-02T00:00:00.000Z.zip" + backup.ManifestSuffix,
+		"mc-a-2021-07-03T00:00:00.000Z.zip",
+		"mc-b-2021-07-01T00:00:00.000Z.zip",
+		"mc-b-2021-07-02T00:00:00.000Z.zip",
+	}
+	for _, name := range objects {
+		if err := client.Backup(ctx, name, bytes.NewReader([]byte(name))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Date(2021, time.July, 4, 0, 0, 0, 0, time.UTC)
+
+	removed, err := Prune(ctx, client, Policy{KeepLast: 1}, "mc-a", now, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := names(removed); got != "mc-a-2021-07-02T00:00:00.000Z.zip mc-a-2021-07-01T00:00:00.000Z.zip" {
+		t.Fatalf("dry run removed %s", got)
+	}
+
+	if stored, _ := client.List(ctx, ""); len(stored) != len(objects) {
+		t.Fatalf("dry run deleted %d objects", len(objects)-len(stored))
+	}
+
+	if _, err := Prune(ctx, client, Policy{KeepLast: 1}, "mc-a", now, false); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := client.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var left []string
+	for _, obj := range stored {
+		left = append(left, obj.Name)
+	}
+	sort.Strings(left)
+
+	want := []string{
+		"mc-a-2021-07-03T00:00:00.000Z.zip",
+		"mc-b-2021-07-01T00:00:00.000Z.zip",
+		"mc-b-2021-07-02T00:00:00.000Z.zip",
+	}
+
+	if strings.Join(left, " ") != strings.Join(want, " ") {
+		t.Fatalf("left %v, want %v", left, want)
+	}
+}
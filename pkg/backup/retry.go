@@ -0,0 +1,317 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// Returned by RetryClient when an operation made no progress for its timeout
+var ErrStalled = errors.New("storage operation made no progress")
+
+// Exponential backoff between attempts of a storage operation
+type RetryPolicy struct {
+	// Attempts of each operation, including the first. Values below 1 are treated as 1
+	Attempts int
+	// Delay before the first retry. Doubled after each retry up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{Attempts: 4, Backoff: time.Second, MaxBackoff: time.Minute}
+
+// Returns the delay before the given retry, starting at 1. Delays are jittered between half and all
+// of the backoff so clients that failed together do not retry together
+func (p RetryPolicy) delay(retry int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < retry && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Calls fn until it succeeds, returns an error that is not retryable or the policy's attempts are used up.
+// notify, if not nil, is called with the error and the delay before each retry
+func Retry(ctx context.Context, policy RetryPolicy, fn func() error, notify func(err error, delay time.Duration)) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= policy.Attempts || !Retryable(err) || ctx.Err() != nil {
+			if err != nil && attempt > 1 {
+				return fmt.Errorf("after %d attempts: %w", attempt, err)
+			}
+			return err
+		}
+
+		delay := policy.delay(attempt)
+		if notify != nil {
+			notify(err, delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// Reports whether a failed storage operation may succeed if it is tried again. Missing objects, cancelled
+// operations and errors with a Retryable method that returns false are not retried
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, ErrNotExist) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var r interface{ Retryable() bool }
+	if errors.As(err, &r) {
+		return r.Retryable()
+	}
+
+	return true
+}
+
+// Error that is never retried
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string   { return e.err.Error() }
+func (e *permanentError) Unwrap() error   { return e.err }
+func (e *permanentError) Retryable() bool { return false }
+
+// Counts of the retried storage operations of a RetryClient
+type RetryStats struct {
+	// Attempts after the first
+	Retries int64
+	// Downloads resumed from where they stopped
+	Resumes int64
+	// Attempts cancelled after making no progress
+	Stalls int64
+}
+
+// Backup client that retries failed operations of the client it wraps with exponential backoff.
+// Attempts that read or write no data for the timeout are cancelled and retried.
+//
+// Uploads are retried only if their reader is an io.Seeker, e.g. a spooled archive file, so it can be
+// read again from the start. Streamed uploads rely on the resumable and multipart uploads of the backend
+// instead. Downloads are resumed from where they stopped if the client is a RangeLoader and are otherwise
+// only retried if nothing was written yet
+type RetryClient struct {
+	client  BackupClient
+	policy  RetryPolicy
+	timeout time.Duration
+
+	// Called before each retry, e.g. for logging
+	OnRetry func(op, name string, err error, delay time.Duration)
+
+	retries, resumes, stalls int64
+}
+
+// Wraps client. A timeout of 0 never cancels an attempt
+func NewRetryClient(client BackupClient, policy RetryPolicy, timeout time.Duration) *RetryClient {
+	return &RetryClient{client: client, policy: policy, timeout: timeout}
+}
+
+// Returns the counts of the client's retried operations so far
+func (c *RetryClient) Stats() RetryStats {
+	return RetryStats{
+		Retries: atomic.LoadInt64(&c.retries),
+		Resumes: atomic.LoadInt64(&c.resumes),
+		Stalls:  atomic.LoadInt64(&c.stalls),
+	}
+}
+
+// The wrapped client
+func (c *RetryClient) Unwrap() BackupClient {
+	return c.client
+}
+
+func (c *RetryClient) Backup(ctx context.Context, name string, r io.Reader) error {
+	policy := c.policy
+
+	seeker, ok := r.(io.Seeker)
+	var start int64
+	if ok {
+		var err error
+		start, err = seeker.Seek(0, io.SeekCurrent)
+		ok = err == nil
+	}
+
+	// streamed uploads can not be read again
+	if !ok {
+		policy.Attempts = 1
+	}
+
+	first := true
+	return c.retry(ctx, policy, "backup", name, func() error {
+		if !first {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return &permanentError{err}
+			}
+		}
+		first = false
+
+		return c.attempt(ctx, func(ctx context.Context, progress func()) error {
+			return c.client.Backup(ctx, name, &progressReader{r, progress})
+		})
+	})
+}
+
+func (c *RetryClient) Load(ctx context.Context, name string, w io.Writer) error {
+	rl, resumable := c.client.(RangeLoader)
+	pw := &progressWriter{w: w}
+
+	return c.retry(ctx, c.policy, "load", name, func() error {
+		err := c.attempt(ctx, func(ctx context.Context, progress func()) error {
+			pw.progress = progress
+
+			if pw.n == 0 {
+				return c.client.Load(ctx, name, pw)
+			}
+
+			atomic.AddInt64(&c.resumes, 1)
+			return rl.LoadRange(ctx, name, pw.n, pw)
+		})
+
+		// a download can not start over once w was written to
+		if err != nil && pw.n > 0 && !resumable {
+			return &permanentError{err}
+		}
+
+		return err
+	})
+}
+
+func (c *RetryClient) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+
+	err := c.retry(ctx, c.policy, "list", prefix, func() error {
+		return c.attempt(ctx, func(ctx context.Context, progress func()) error {
+			var err error
+			objects, err = c.client.List(ctx, prefix)
+			return err
+		})
+	})
+
+	return objects, err
+}
+
+func (c *RetryClient) Delete(ctx context.Context, name string) error {
+	first := true
+
+	return c.retry(ctx, c.policy, "delete", name, func() error {
+		err := c.attempt(ctx, func(ctx context.Context, progress func()) error {
+			return c.client.Delete(ctx, name)
+		})
+
+		// an earlier attempt may have deleted the object before it failed
+		if !first && errors.Is(err, ErrNotExist) {
+			return nil
+		}
+		first = false
+
+		return err
+	})
+}
+
+func (c *RetryClient) Close() error {
+	return c.client.Close()
+}
+
+func (c *RetryClient) retry(ctx context.Context, policy RetryPolicy, op, name string, fn func() error) error {
+	return Retry(ctx, policy, fn, func(err error, delay time.Duration) {
+		atomic.AddInt64(&c.retries, 1)
+		if c.OnRetry != nil {
+			c.OnRetry(op, name, err, delay)
+		}
+	})
+}
+
+// Runs a single attempt with a context that is cancelled if progress is not called for the timeout
+func (c *RetryClient) attempt(ctx context.Context, fn func(ctx context.Context, progress func()) error) error {
+	if c.timeout <= 0 {
+		return fn(ctx, func() {})
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var stalled int32
+	timer := time.AfterFunc(c.timeout, func() {
+		atomic.StoreInt32(&stalled, 1)
+		cancel()
+	})
+
+	defer timer.Stop()
+
+	err := fn(ctx, func() { timer.Reset(c.timeout) })
+
+	if err != nil && atomic.LoadInt32(&stalled) == 1 {
+		atomic.AddInt64(&c.stalls, 1)
+		return fmt.Errorf("%w for %s: %v", ErrStalled, c.timeout, err)
+	}
+
+	return err
+}
+
+type progressReader struct {
+	r        io.Reader
+	progress func()
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.progress()
+	}
+	return n, err
+}
+
+// Writer that counts the bytes written across attempts
+type progressWriter struct {
+	w        io.Writer
+	n        int64
+	progress func()
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.n += int64(n)
+	if n > 0 {
+		p.progress()
+	}
+	return n, err
+}
+
+// Returns the retry stats of client, or of the client it wraps
+func RetryStatsOf(client BackupClient) (RetryStats, bool) {
+	for client != nil {
+		if c, ok := client.(*RetryClient); ok {
+			return c.Stats(), true
+		}
+
+		u, ok := client.(interface{ Unwrap() BackupClient })
+		if !ok {
+			break
+		}
+
+		client = u.Unwrap()
+	}
+
+	return RetryStats{}, false
+}
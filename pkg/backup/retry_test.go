@@ -0,0 +1,451 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testPolicy = RetryPolicy{Attempts: 4, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+var errReset = errors.New("connection reset by peer")
+
+// In-memory client whose operations fail or stall a given number of times
+type fakeClient struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+
+	// Remaining failures of each operation
+	failures map[string]int
+	// Bytes written by a failing load before it fails
+	partial int
+	// Remaining attempts that block until they are cancelled
+	stalls int
+
+	attempts map[string]int
+	// Offsets of resumed loads
+	offsets []int64
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{objects: map[string][]byte{}, failures: map[string]int{}, attempts: map[string]int{}}
+}
+
+// Counts an attempt of op and returns whether it fails or stalls
+func (c *fakeClient) start(op string) (fail, stall bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.attempts[op]++
+
+	if c.stalls > 0 {
+		c.stalls--
+		return false, true
+	}
+
+	if c.failures[op] > 0 {
+		c.failures[op]--
+		return true, false
+	}
+
+	return false, false
+}
+
+func (c *fakeClient) Backup(ctx context.Context, name string, r io.Reader) error {
+	fail, stall := c.start("backup")
+	if stall {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if fail {
+		return errReset
+	}
+
+	c.mu.Lock()
+	c.objects[name] = data
+	c.mu.Unlock()
+
+	return nil
+}
+
+func (c *fakeClient) Load(ctx context.Context, name string, w io.Writer) error {
+	return c.load(ctx, name, 0, w)
+}
+
+func (c *fakeClient) load(ctx context.Context, name string, offset int64, w io.Writer) error {
+	fail, stall := c.start("load")
+	if stall {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	c.mu.Lock()
+	data, ok := c.objects[name]
+	c.mu.Unlock()
+
+	if !ok {
+		return ErrNotExist
+	}
+
+	data = data[offset:]
+
+	if fail {
+		if c.partial < len(data) {
+			data = data[:c.partial]
+		}
+
+		w.Write(data)
+		return errReset
+	}
+
+	_, err := w.Write(data)
+	return err
+}
+
+func (c *fakeClient) List(ctx context.Context, prefix string) ([]Object, error) {
+	if fail, _ := c.start("list"); fail {
+		return nil, errReset
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var objects []Object
+	for name, data := range c.objects {
+		if strings.HasPrefix(name, prefix) {
+			objects = append(objects, Object{Name: name, Size: int64(len(data))})
+		}
+	}
+
+	return objects, nil
+}
+
+func (c *fakeClient) Delete(ctx context.Context, name string) error {
+	fail, _ := c.start("delete")
+
+	c.mu.Lock()
+	_, ok := c.objects[name]
+	delete(c.objects, name)
+	c.mu.Unlock()
+
+	// the object is deleted but the response is lost
+	if fail {
+		return errReset
+	}
+
+	if !ok {
+		return ErrNotExist
+	}
+
+	return nil
+}
+
+func (c *fakeClient) Close() error {
+	return nil
+}
+
+// fakeClient that resumes downloads
+type fakeRangeClient struct {
+	*fakeClient
+}
+
+func (c fakeRangeClient) LoadRange(ctx context.Context, name string, offset int64, w io.Writer) error {
+	c.mu.Lock()
+	c.offsets = append(c.offsets, offset)
+	c.mu.Unlock()
+
+	return c.load(ctx, name, offset, w)
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		failures int
+		attempts int
+		wantErr  bool
+	}{
+		{name: "success", attempts: 1},
+		{name: "transient", err: errReset, failures: 2, attempts: 3},
+		{name: "attempts used up", err: errReset, failures: 10, attempts: 4, wantErr: true},
+		{name: "not exist", err: fmt.Errorf("load: %w", ErrNotExist), failures: 10, attempts: 1, wantErr: true},
+		{name: "permanent", err: &permanentError{errReset}, failures: 10, attempts: 1, wantErr: true},
+		{name: "canceled", err: context.Canceled, failures: 10, attempts: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts, notified int
+			err := Retry(context.Background(), testPolicy, func() error {
+				attempts++
+				if attempts <= tt.failures {
+					return tt.err
+				}
+				return nil
+			}, func(err error, delay time.Duration) {
+				notified++
+				if delay > testPolicy.MaxBackoff {
+					t.Errorf("delay %s exceeds the maximum backoff", delay)
+				}
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Retry = %v, want error %v", err, tt.wantErr)
+			}
+
+			if err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("Retry = %v, want %v", err, tt.err)
+			}
+
+			if attempts != tt.attempts || notified != attempts-1 {
+				t.Errorf("%d attempts and %d retries, want %d attempts", attempts, notified, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestRetryCanceledDuringBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	attempts := 0
+	err := Retry(ctx, RetryPolicy{Attempts: 4, Backoff: time.Hour, MaxBackoff: time.Hour}, func() error {
+		attempts++
+		return errReset
+	}, func(err error, delay time.Duration) {
+		cancel()
+	})
+
+	if !errors.Is(err, errReset) || attempts != 1 {
+		t.Fatalf("Retry = %v after %d attempts, want the first error", err, attempts)
+	}
+}
+
+func TestRetryClientBackup(t *testing.T) {
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("world"), 1000)
+
+	fake := newFakeClient()
+	fake.failures["backup"] = 2
+	client := NewRetryClient(fake, testPolicy, 0)
+
+	// seekable uploads are read again from where they started
+	r := bytes.NewReader(append([]byte("skipped"), data...))
+	r.Seek(int64(len("skipped")), io.SeekStart)
+
+	if err := client.Backup(ctx, "a.zip", r); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(fake.objects["a.zip"], data) {
+		t.Fatalf("stored %d bytes, want %d", len(fake.objects["a.zip"]), len(data))
+	}
+
+	if fake.attempts["backup"] != 3 || client.Stats().Retries != 2 {
+		t.Fatalf("%d attempts and %d retries, want 3 attempts", fake.attempts["backup"], client.Stats().Retries)
+	}
+
+	// streamed uploads can not be read again
+	fake = newFakeClient()
+	fake.failures["backup"] = 1
+	client = NewRetryClient(fake, testPolicy, 0)
+
+	if err := client.Backup(ctx, "b.zip", io.MultiReader(bytes.NewReader(data))); !errors.Is(err, errReset) {
+		t.Fatalf("streamed Backup = %v, want %v", err, errReset)
+	}
+
+	if fake.attempts["backup"] != 1 || client.Stats().Retries != 0 {
+		t.Fatalf("streamed upload was attempted %d times, want 1", fake.attempts["backup"])
+	}
+}
+
+func TestRetryClientLoad(t *testing.T) {
+	ctx := context.Background()
+	data := []byte("0123456789abcdefghij")
+
+	t.Run("resumed", func(t *testing.T) {
+		fake := newFakeClient()
+		fake.objects["a.zip"] = data
+		fake.failures["load"] = 2
+		fake.partial = 5
+		client := NewRetryClient(fakeRangeClient{fake}, testPolicy, 0)
+
+		var out bytes.Buffer
+		if err := client.Load(ctx, "a.zip", &out); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(out.Bytes(), data) {
+			t.Fatalf("loaded %q, want %q", out.Bytes(), data)
+		}
+
+		if got := fmt.Sprint(fake.offsets); got != "[5 10]" {
+			t.Fatalf("resumed from offsets %s, want [5 10]", got)
+		}
+
+		if stats := client.Stats(); stats.Resumes != 2 || stats.Retries != 2 {
+			t.Fatalf("stats = %+v, want 2 resumes", stats)
+		}
+	})
+
+	t.Run("not resumable", func(t *testing.T) {
+		fake := newFakeClient()
+		fake.objects["a.zip"] = data
+		fake.failures["load"] = 1
+		fake.partial = 5
+		client := NewRetryClient(fake, testPolicy, 0)
+
+		if err := client.Load(ctx, "a.zip", ioutil.Discard); !errors.Is(err, errReset) {
+			t.Fatalf("Load = %v, want %v", err, errReset)
+		}
+
+		if fake.attempts["load"] != 1 {
+			t.Fatalf("partly written load was attempted %d times, want 1", fake.attempts["load"])
+		}
+	})
+
+	t.Run("retried before writing", func(t *testing.T) {
+		fake := newFakeClient()
+		fake.objects["a.zip"] = data
+		fake.failures["load"] = 1
+		client := NewRetryClient(fake, testPolicy, 0)
+
+		var out bytes.Buffer
+		if err := client.Load(ctx, "a.zip", &out); err != nil || !bytes.Equal(out.Bytes(), data) {
+			t.Fatalf("Load = %q, %v", out.Bytes(), err)
+		}
+
+		if fake.attempts["load"] != 2 {
+			t.Fatalf("load was attempted %d times, want 2", fake.attempts["load"])
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		fake := newFakeClient()
+		client := NewRetryClient(fake, testPolicy, 0)
+
+		if err := client.Load(ctx, "missing.zip", ioutil.Discard); !errors.Is(err, ErrNotExist) {
+			t.Fatalf("Load = %v, want ErrNotExist", err)
+		}
+
+		if fake.attempts["load"] != 1 {
+			t.Fatalf("missing object was loaded %d times, want 1", fake.attempts["load"])
+		}
+	})
+}
+
+func TestRetryClientStall(t *testing.T) {
+	ctx := context.Background()
+
+	fake := newFakeClient()
+	fake.stalls = 1
+	client := NewRetryClient(fake, testPolicy, 50*time.Millisecond)
+
+	start := time.Now()
+	if err := client.Backup(ctx, "a.zip", bytes.NewReader([]byte("world"))); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("stalled attempt was cancelled after %s", elapsed)
+	}
+
+	if stats := client.Stats(); stats.Stalls != 1 || stats.Retries != 1 {
+		t.Fatalf("stats = %+v, want 1 stall and 1 retry", stats)
+	}
+
+	// every attempt stalls
+	fake.stalls = testPolicy.Attempts
+	if err := client.Load(ctx, "a.zip", ioutil.Discard); !errors.Is(err, ErrStalled) {
+		t.Fatalf("Load = %v, want ErrStalled", err)
+	}
+}
+
+func TestRetryClientDelete(t *testing.T) {
+	ctx := context.Background()
+
+	fake := newFakeClient()
+	fake.objects["a.zip"] = []byte("world")
+	fake.failures["delete"] = 1
+	client := NewRetryClient(fake, testPolicy, 0)
+
+	// the first attempt deleted the object before it failed
+	if err := client.Delete(ctx, "a.zip"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Delete(ctx, "a.zip"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("Delete of a missing object = %v, want ErrNotExist", err)
+	}
+}
+
+func TestRetryStatsOf(t *testing.T) {
+	client := NewRetryClient(newFakeClient(), testPolicy, 0)
+
+	if _, ok := RetryStatsOf(wrappedClient{client}); !ok {
+		t.Fatal("no retry stats found through Unwrap")
+	}
+
+	if _, ok := RetryStatsOf(newFakeClient()); ok {
+		t.Fatal("retry stats found without a RetryClient")
+	}
+}
+
+type wrappedClient struct {
+	BackupClient
+}
+
+func (c wrappedClient) Unwrap() BackupClient {
+	return c.BackupClient
+}
+
+func TestStream(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeClient()
+
+	err := Stream(ctx, fake, "a.zip", func(w io.Writer) error {
+		_, err := io.WriteString(w, "archive")
+		return err
+	})
+
+	if err != nil || string(fake.objects["a.zip"]) != "archive" {
+		t.Fatalf("Stream = %v, stored %q", err, fake.objects["a.zip"])
+	}
+
+	// archive errors are reported over the upload errors they cause
+	errArchive := errors.New("archive failed")
+	err = Stream(ctx, fake, "b.zip", func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return errArchive
+	})
+
+	if !errors.Is(err, errArchive) {
+		t.Fatalf("Stream = %v, want %v", err, errArchive)
+	}
+
+	if _, ok := fake.objects["b.zip"]; ok {
+		t.Fatal("failed archive was stored")
+	}
+
+	fake.failures["backup"] = 1
+	err = Stream(ctx, fake, "c.zip", func(w io.Writer) error {
+		_, err := io.WriteString(w, "archive")
+		return err
+	})
+
+	if !errors.Is(err, errReset) {
+		t.Fatalf("Stream = %v, want %v", err, errReset)
+	}
+}
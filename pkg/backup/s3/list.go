@@ -0,0 +1,89 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+)
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// Lists objects under the client prefix that start with prefix using ListObjectsV2.
+// S3 does not record creation times separately so Created is the object's last modified time
+func (s *S3Client) List(ctx context.Context, prefix string) ([]backup.Object, error) {
+	base := ""
+	if s.prefix != "" {
+		base = s.prefix + "/"
+	}
+
+	var objects []backup.Object
+	var token string
+
+	for {
+		q := url.Values{
+			"list-type": {"2"},
+			"prefix":    {base + prefix},
+		}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+
+		req, err := s.newBucketRequest(ctx, http.MethodGet, q)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := s.do(req, emptyPayload)
+		if err != nil {
+			return nil, err
+		}
+
+		var result listBucketResult
+		err = xml.NewDecoder(res.Body).Decode(&result)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range result.Contents {
+			objects = append(objects, backup.Object{
+				Name:    strings.TrimPrefix(c.Key, base),
+				Size:    c.Size,
+				Created: c.LastModified,
+			})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *S3Client) Delete(ctx context.Context, name string) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, name, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.do(req, emptyPayload)
+	if err != nil {
+		return err
+	}
+
+	return res.Body.Close()
+}
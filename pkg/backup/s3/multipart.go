@@ -0,0 +1,146 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+)
+
+// Time allowed for aborting a failed multipart upload
+const abortTimeout = 30 * time.Second
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+// Uploads a complete object with a single PUT request
+func (s *S3Client) putObject(ctx context.Context, key string, body []byte) error {
+	req, err := s.newRequest(ctx, http.MethodPut, key, nil, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", backup.ContentType(key))
+
+	res, err := s.do(req, hashHex(body))
+	if err != nil {
+		return err
+	}
+
+	return res.Body.Close()
+}
+
+func (s *S3Client) createMultipartUpload(ctx context.Context, key string) (string, error) {
+	req, err := s.newRequest(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", backup.ContentType(key))
+
+	res, err := s.do(req, emptyPayload)
+	if err != nil {
+		return "", err
+	}
+
+	defer res.Body.Close()
+
+	var result initiateMultipartUploadResult
+	if err := xml.NewDecoder(res.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	if result.UploadID == "" {
+		return "", fmt.Errorf("s3: missing upload id for multipart upload of %q", key)
+	}
+
+	return result.UploadID, nil
+}
+
+// Uploads a single part and returns its ETag
+func (s *S3Client) uploadPart(ctx context.Context, key, uploadID string, partNumber int, body []byte) (string, error) {
+	q := url.Values{
+		"partNumber": {strconv.Itoa(partNumber)},
+		"uploadId":   {uploadID},
+	}
+
+	req, err := s.newRequest(ctx, http.MethodPut, key, q, body)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := s.do(req, hashHex(body))
+	if err != nil {
+		return "", err
+	}
+
+	res.Body.Close()
+
+	return res.Header.Get("ETag"), nil
+}
+
+func (s *S3Client) completeMultipartUpload(ctx context.Context, key, uploadID string, parts []completedPart) error {
+	body, err := xml.Marshal(completeMultipartUpload{Parts: parts})
+	if err != nil {
+		return err
+	}
+
+	req, err := s.newRequest(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, body)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.do(req, hashHex(body))
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	// CompleteMultipartUpload can fail after responding with 200 OK. The error is then sent in the body
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	var s3Err Error
+	if xml.Unmarshal(resBody, &s3Err) == nil && s3Err.Code != "" {
+		s3Err.StatusCode = res.StatusCode
+		return &s3Err
+	}
+
+	return nil
+}
+
+// Aborts a multipart upload so its uploaded parts are not retained. Errors are ignored since
+// aborting is only done after another error. The upload is aborted even if its context was cancelled
+func (s *S3Client) abortMultipartUpload(key, uploadID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), abortTimeout)
+	defer cancel()
+
+	req, err := s.newRequest(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil)
+	if err != nil {
+		return
+	}
+
+	if res, err := s.do(req, emptyPayload); err == nil {
+		res.Body.Close()
+	}
+}
@@ -0,0 +1,369 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+)
+
+const (
+	// URL scheme for S3 destinations, e.g. s3://bucket/prefix?endpoint=http://minio:9000&path_style=true
+	Scheme = "s3"
+
+	// Region used when none is configured
+	DefaultRegion = "us-east-1"
+
+	// Size of the parts streamed in multipart uploads. S3 requires at least 5 MiB for all but the last part
+	PartSize = 8 << 20
+)
+
+// Connection options for an S3-compatible object store (AWS S3, MinIO, Ceph RGW)
+type Options struct {
+	// Endpoint URL of the object store. Defaults to the AWS S3 endpoint for the region
+	Endpoint string
+	Region   string
+	// Address buckets as http://endpoint/bucket/key instead of http://bucket.endpoint/key.
+	// Required by most MinIO and Ceph RGW deployments
+	PathStyle bool
+	// Key prefix objects are stored under
+	Prefix      string
+	Credentials Credentials
+	// HTTP client used for requests. Defaults to http.DefaultClient
+	HTTPClient *http.Client
+	// Retries of failed parts of multipart uploads. Defaults to backup.DefaultRetryPolicy
+	PartRetry backup.RetryPolicy
+}
+
+type S3Client struct {
+	client    *http.Client
+	endpoint  *url.URL
+	region    string
+	pathStyle bool
+	creds     Credentials
+	bktName   string
+	prefix    string
+	partRetry backup.RetryPolicy
+}
+
+// Error response returned by the object store
+type Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: unexpected status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3: %s: %s (status %d)", e.Code, e.Message, e.StatusCode)
+}
+
+// Missing objects match backup.ErrNotExist and failed conditional writes backup.ErrPreconditionFailed
+func (e *Error) Is(target error) bool {
+	switch target {
+	case backup.ErrNotExist:
+		return e.StatusCode == http.StatusNotFound
+	case backup.ErrPreconditionFailed:
+		// a conflicting conditional write was in progress
+		return e.StatusCode == http.StatusPreconditionFailed || e.Code == "ConditionalRequestConflict"
+	default:
+		return false
+	}
+}
+
+// Server errors, throttling and request timeouts are retried. Other client errors are not
+func (e *Error) Retryable() bool {
+	switch {
+	case e.StatusCode >= 500, e.StatusCode == http.StatusTooManyRequests, e.StatusCode == http.StatusRequestTimeout:
+		return true
+	default:
+		return e.Code == "RequestTimeout" || e.Code == "SlowDown"
+	}
+}
+
+func init() {
+	backup.Register(Scheme, newFromURL)
+}
+
+// Creates a client from an s3://bucket/prefix destination.
+// The endpoint, region and path_style query parameters configure the connection and
+// credentials are read from the standard AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN env variables.
+// The region defaults to AWS_REGION and then to DefaultRegion
+func newFromURL(ctx context.Context, u *url.URL) (backup.BackupClient, error) {
+	q := u.Query()
+
+	region := q.Get("region")
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+
+	var pathStyle bool
+	if v := q.Get("path_style"); v != "" {
+		var err error
+		if pathStyle, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("s3: invalid path_style %q: %w", v, err)
+		}
+	}
+
+	return New(u.Host, Options{
+		Endpoint:  q.Get("endpoint"),
+		Region:    region,
+		PathStyle: pathStyle,
+		Prefix:    u.Path,
+		Credentials: Credentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		},
+	})
+}
+
+// Creates a new S3 backup client for the given bucket
+func New(bucketName string, opts Options) (backup.BackupClient, error) {
+	if bucketName == "" {
+		return nil, fmt.Errorf("s3: bucket name is empty")
+	}
+
+	region := opts.Region
+	if region == "" {
+		region = DefaultRegion
+	}
+
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("s3: invalid endpoint %q: %w", endpoint, err)
+	}
+
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	partRetry := opts.PartRetry
+	if partRetry.Attempts == 0 {
+		partRetry = backup.DefaultRetryPolicy
+	}
+
+	return &S3Client{client, u, region, opts.PathStyle, opts.Credentials, bucketName, strings.Trim(opts.Prefix, "/"), partRetry}, nil
+}
+
+// Uploads the backup read from r. Backups smaller than a single part are uploaded with one PUT,
+// larger ones are streamed with a multipart upload so only one part is held in memory at a time.
+// Failed parts are retried without restarting the upload
+func (s *S3Client) Backup(ctx context.Context, name string, r io.Reader) error {
+	buf := make([]byte, PartSize)
+
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return s.putObject(ctx, name, buf[:n])
+	}
+
+	if err != nil {
+		return err
+	}
+
+	uploadID, err := s.createMultipartUpload(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	var parts []completedPart
+	for partNumber := 1; n > 0; partNumber++ {
+		var etag string
+		err := backup.Retry(ctx, s.partRetry, func() error {
+			var err error
+			etag, err = s.uploadPart(ctx, name, uploadID, partNumber, buf[:n])
+			return err
+		}, nil)
+
+		if err != nil {
+			s.abortMultipartUpload(name, uploadID)
+			return err
+		}
+
+		parts = append(parts, completedPart{partNumber, etag})
+
+		n, err = io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			s.abortMultipartUpload(name, uploadID)
+			return err
+		}
+	}
+
+	if err := s.completeMultipartUpload(ctx, name, uploadID, parts); err != nil {
+		s.abortMultipartUpload(name, uploadID)
+		return err
+	}
+
+	return nil
+}
+
+// Downloads the backup into w
+func (s *S3Client) Load(ctx context.Context, name string, w io.Writer) error {
+	return s.LoadRange(ctx, name, 0, w)
+}
+
+// Downloads the backup from offset into w with a ranged GET
+func (s *S3Client) LoadRange(ctx context.Context, name string, offset int64, w io.Writer) error {
+	req, err := s.newRequest(ctx, http.MethodGet, name, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	res, err := s.do(req, emptyPayload)
+
+	// the whole object was already downloaded
+	var s3Err *Error
+	if offset > 0 && errors.As(err, &s3Err) && s3Err.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
+// Reads the object. Its generation is the object's ETag
+func (s *S3Client) ReadObject(ctx context.Context, name string) ([]byte, string, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, name, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	res, err := s.do(req, emptyPayload)
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return data, res.Header.Get("ETag"), nil
+}
+
+// Writes the object with an If-Match or If-None-Match precondition. Stores that ignore conditional
+// PUTs overwrite the object unconditionally
+func (s *S3Client) WriteObject(ctx context.Context, name string, data []byte, generation string) (string, error) {
+	req, err := s.newRequest(ctx, http.MethodPut, name, nil, data)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", backup.ContentType(name))
+
+	if generation == "" {
+		req.Header.Set("If-None-Match", "*")
+	} else {
+		req.Header.Set("If-Match", generation)
+	}
+
+	res, err := s.do(req, hashHex(data))
+	if err != nil {
+		return "", err
+	}
+
+	res.Body.Close()
+	return res.Header.Get("ETag"), nil
+}
+
+// S3Client holds no open connections besides the shared HTTP client's idle ones
+func (s *S3Client) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// Builds a request for the given object key using path-style or virtual-hosted-style addressing
+func (s *S3Client) newRequest(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Request, error) {
+	return s.newURLRequest(ctx, method, strings.TrimPrefix(path.Join(s.prefix, key), "/"), query, body)
+}
+
+// Builds a request for the bucket itself, e.g. object listings
+func (s *S3Client) newBucketRequest(ctx context.Context, method string, query url.Values) (*http.Request, error) {
+	return s.newURLRequest(ctx, method, "", query, nil)
+}
+
+func (s *S3Client) newURLRequest(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Request, error) {
+	u := *s.endpoint
+
+	// endpoints behind a reverse proxy may have a base path
+	basePath := strings.TrimSuffix(s.endpoint.Path, "/")
+	baseRawPath := strings.TrimSuffix(s.endpoint.EscapedPath(), "/")
+
+	if s.pathStyle {
+		u.Path = basePath + "/" + s.bktName + "/" + key
+		u.RawPath = baseRawPath + "/" + escapePath(s.bktName) + "/" + escapePath(key)
+	} else {
+		u.Host = s.bktName + "." + u.Host
+		u.Path = basePath + "/" + key
+		u.RawPath = baseRawPath + "/" + escapePath(key)
+	}
+
+	if query != nil {
+		u.RawQuery = query.Encode()
+	}
+
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	return http.NewRequestWithContext(ctx, method, u.String(), r)
+}
+
+// Signs and sends the request. Non-2xx responses are returned as *Error
+func (s *S3Client) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	sign(req, s.creds, s.region, payloadHash, time.Now())
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		defer res.Body.Close()
+
+		s3Err := &Error{StatusCode: res.StatusCode}
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1<<16))
+		xml.Unmarshal(body, s3Err)
+
+		return nil, s3Err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,469 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+)
+
+// In-memory stand-in for the parts of the S3 API the client uses
+type fakeS3 struct {
+	// Path of the bucket, including the endpoint's base path
+	base string
+	// Objects returned per list page
+	pageSize int
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	aborted int
+	// Attempts of each part number
+	partAttempts map[int]int
+	// Remaining failures of each part number and their status
+	partFailures map[int]int
+	failStatus   int
+	nextUpload   int
+}
+
+func newFakeS3(base string) *fakeS3 {
+	return &fakeS3{
+		base:         base,
+		pageSize:     2,
+		objects:      map[string][]byte{},
+		uploads:      map[string]map[int][]byte{},
+		partAttempts: map[int]int{},
+		partFailures: map[int]int{},
+	}
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return strconv.Quote(hex.EncodeToString(sum[:]))
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), signingAlgorithm+" ") {
+		writeError(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	if r.URL.Path != f.base && !strings.HasPrefix(r.URL.Path, f.base+"/") {
+		writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, f.base), "/")
+	q := r.URL.Query()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+
+	if hash := r.Header.Get("X-Amz-Content-Sha256"); hash != unsignedPayload && hash != hashHex(body) {
+		writeError(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		f.list(w, q)
+	case r.Method == http.MethodGet:
+		f.get(w, r, key)
+	case r.Method == http.MethodPut && q.Get("uploadId") != "":
+		f.uploadPart(w, q, body)
+	case r.Method == http.MethodPut:
+		f.put(w, r, key, body)
+	case r.Method == http.MethodPost && q["uploads"] != nil:
+		f.nextUpload++
+		id := strconv.Itoa(f.nextUpload)
+		f.uploads[id] = map[int][]byte{}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPost && q.Get("uploadId") != "":
+		f.complete(w, key, q.Get("uploadId"), body)
+	case r.Method == http.MethodDelete && q.Get("uploadId") != "":
+		delete(f.uploads, q.Get("uploadId"))
+		f.aborted++
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, q url.Values) {
+	var keys []string
+	for k := range f.objects {
+		if strings.HasPrefix(k, q.Get("prefix")) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	start, _ := strconv.Atoi(q.Get("continuation-token"))
+	end := start + f.pageSize
+	if end > len(keys) {
+		end = len(keys)
+	}
+
+	var result listBucketResult
+	for _, k := range keys[start:end] {
+		result.Contents = append(result.Contents, struct {
+			Key          string    `xml:"Key"`
+			Size         int64     `xml:"Size"`
+			LastModified time.Time `xml:"LastModified"`
+		}{k, int64(len(f.objects[k])), time.Now()})
+	}
+
+	if end < len(keys) {
+		result.IsTruncated = true
+		result.NextContinuationToken = strconv.Itoa(end)
+	}
+
+	xml.NewEncoder(w).Encode(result)
+}
+
+func (f *fakeS3) get(w http.ResponseWriter, r *http.Request, key string) {
+	data, ok := f.objects[key]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	w.Header().Set("ETag", etag(data))
+
+	if rng := r.Header.Get("Range"); rng != "" {
+		offset, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+		if err != nil || offset >= len(data) {
+			writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+			return
+		}
+
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[offset:])
+		return
+	}
+
+	w.Write(data)
+}
+
+func (f *fakeS3) put(w http.ResponseWriter, r *http.Request, key string, body []byte) {
+	data, exists := f.objects[key]
+
+	if r.Header.Get("If-None-Match") == "*" && exists {
+		writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+		return
+	}
+
+	if match := r.Header.Get("If-Match"); match != "" && (!exists || match != etag(data)) {
+		writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+		return
+	}
+
+	f.objects[key] = body
+	w.Header().Set("ETag", etag(body))
+}
+
+func (f *fakeS3) uploadPart(w http.ResponseWriter, q url.Values, body []byte) {
+	parts, ok := f.uploads[q.Get("uploadId")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	n, _ := strconv.Atoi(q.Get("partNumber"))
+	f.partAttempts[n]++
+
+	if f.partFailures[n] > 0 {
+		f.partFailures[n]--
+		writeError(w, f.failStatus, http.StatusText(f.failStatus))
+		return
+	}
+
+	parts[n] = body
+	w.Header().Set("ETag", etag(body))
+}
+
+func (f *fakeS3) complete(w http.ResponseWriter, key, uploadID string, body []byte) {
+	parts, ok := f.uploads[uploadID]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	var req completeMultipartUpload
+	if err := xml.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+
+	var data []byte
+	for i, part := range req.Parts {
+		if part.PartNumber != i+1 || part.ETag != etag(parts[part.PartNumber]) {
+			// sent with 200 OK like S3 does
+			fmt.Fprint(w, "<Error><Code>InvalidPart</Code><Message>InvalidPart</Message></Error>")
+			return
+		}
+		data = append(data, parts[part.PartNumber]...)
+	}
+
+	delete(f.uploads, uploadID)
+	f.objects[key] = data
+	fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+}
+
+func newTestClient(t *testing.T, f *fakeS3, basePath string) *S3Client {
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	client, err := New("bucket", Options{
+		Endpoint:    srv.URL + basePath,
+		PathStyle:   true,
+		Prefix:      "backups",
+		Credentials: Credentials{AccessKeyID: "id", SecretAccessKey: "secret"},
+		PartRetry:   backup.RetryPolicy{Attempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client.(*S3Client)
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeS3("/proxy/s3/bucket")
+	client := newTestClient(t, f, "/proxy/s3/")
+
+	data := []byte("world archive")
+	if err := client.Backup(ctx, "a b.zip", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := f.objects["backups/a b.zip"]; !ok {
+		t.Fatalf("object not stored under the prefix: %v", f.objects)
+	}
+
+	var out bytes.Buffer
+	if err := client.Load(ctx, "a b.zip", &out); err != nil || !bytes.Equal(out.Bytes(), data) {
+		t.Fatalf("Load = %q, %v", out.Bytes(), err)
+	}
+
+	out.Reset()
+	if err := client.LoadRange(ctx, "a b.zip", 6, &out); err != nil || out.String() != "archive" {
+		t.Fatalf("LoadRange = %q, %v", out.Bytes(), err)
+	}
+
+	out.Reset()
+	if err := client.LoadRange(ctx, "a b.zip", int64(len(data)), &out); err != nil || out.Len() != 0 {
+		t.Fatalf("LoadRange past the end = %q, %v", out.Bytes(), err)
+	}
+
+	if err := client.Load(ctx, "missing.zip", &out); !errors.Is(err, backup.ErrNotExist) {
+		t.Fatalf("Load of a missing object = %v, want ErrNotExist", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := client.Backup(ctx, fmt.Sprintf("list/%d.zip", i), bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	objects, err := client.List(ctx, "list/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, obj := range objects {
+		names = append(names, obj.Name)
+		if obj.Size != int64(len(data)) {
+			t.Errorf("%s has size %d, want %d", obj.Name, obj.Size, len(data))
+		}
+	}
+
+	if got, want := strings.Join(names, ","), "list/0.zip,list/1.zip,list/2.zip,list/3.zip"; got != want {
+		t.Fatalf("List = %s, want %s", got, want)
+	}
+
+	if err := client.Delete(ctx, "a b.zip"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Load(ctx, "a b.zip", &out); !errors.Is(err, backup.ErrNotExist) {
+		t.Fatalf("Load of a deleted object = %v, want ErrNotExist", err)
+	}
+}
+
+func TestClientConditionalWrites(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t, newFakeS3("/bucket"), "")
+
+	gen, err := client.WriteObject(ctx, "lease.json", []byte("a"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.WriteObject(ctx, "lease.json", []byte("b"), ""); !errors.Is(err, backup.ErrPreconditionFailed) {
+		t.Fatalf("create of an existing object = %v, want ErrPreconditionFailed", err)
+	}
+
+	if _, err := client.WriteObject(ctx, "lease.json", []byte("b"), `"stale"`); !errors.Is(err, backup.ErrPreconditionFailed) {
+		t.Fatalf("write with a stale generation = %v, want ErrPreconditionFailed", err)
+	}
+
+	if _, err := client.WriteObject(ctx, "lease.json", []byte("b"), gen); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _, err := client.ReadObject(ctx, "lease.json")
+	if err != nil || string(data) != "b" {
+		t.Fatalf("ReadObject = %q, %v", data, err)
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("0123456789abcdef"), (2*PartSize+100)/16)
+
+	t.Run("retried part", func(t *testing.T) {
+		f := newFakeS3("/bucket")
+		f.partFailures[2] = 1
+		f.failStatus = http.StatusServiceUnavailable
+		client := newTestClient(t, f, "")
+
+		if err := client.Backup(ctx, "big.zip", bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(f.objects["backups/big.zip"], data) {
+			t.Fatalf("stored %d bytes, want %d", len(f.objects["backups/big.zip"]), len(data))
+		}
+
+		if f.partAttempts[1] != 1 || f.partAttempts[2] != 2 || f.partAttempts[3] != 1 {
+			t.Fatalf("part attempts = %v, want part 2 retried once", f.partAttempts)
+		}
+
+		if f.aborted != 0 || len(f.uploads) != 0 {
+			t.Fatalf("aborted %d uploads, %d left", f.aborted, len(f.uploads))
+		}
+	})
+
+	t.Run("aborted upload", func(t *testing.T) {
+		f := newFakeS3("/bucket")
+		f.partFailures[2] = 1
+		f.failStatus = http.StatusForbidden
+		client := newTestClient(t, f, "")
+
+		err := client.Backup(ctx, "big.zip", bytes.NewReader(data))
+
+		var s3Err *Error
+		if !errors.As(err, &s3Err) || s3Err.StatusCode != http.StatusForbidden {
+			t.Fatalf("Backup = %v, want a 403 error", err)
+		}
+
+		if f.partAttempts[2] != 1 || f.partAttempts[3] != 0 {
+			t.Fatalf("part attempts = %v, want part 2 tried once", f.partAttempts)
+		}
+
+		if f.aborted != 1 || len(f.uploads) != 0 {
+			t.Fatalf("aborted %d uploads, %d left", f.aborted, len(f.uploads))
+		}
+
+		if _, ok := f.objects["backups/big.zip"]; ok {
+			t.Fatal("failed upload was stored")
+		}
+	})
+}
+
+func TestErrorIs(t *testing.T) {
+	tests := []struct {
+		err          *Error
+		notExist     bool
+		precondition bool
+		retryable    bool
+	}{
+		{err: &Error{StatusCode: 404, Code: "NoSuchKey"}, notExist: true},
+		{err: &Error{StatusCode: 412, Code: "PreconditionFailed"}, precondition: true},
+		{err: &Error{StatusCode: 409, Code: "ConditionalRequestConflict"}, precondition: true},
+		{err: &Error{StatusCode: 403, Code: "AccessDenied"}},
+		{err: &Error{StatusCode: 500, Code: "InternalError"}, retryable: true},
+		{err: &Error{StatusCode: 503, Code: "SlowDown"}, retryable: true},
+		{err: &Error{StatusCode: 429}, retryable: true},
+		{err: &Error{StatusCode: 400, Code: "RequestTimeout"}, retryable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			var err error = fmt.Errorf("wrapped: %w", tt.err)
+
+			if got := errors.Is(err, backup.ErrNotExist); got != tt.notExist {
+				t.Errorf("Is(ErrNotExist) = %v, want %v", got, tt.notExist)
+			}
+
+			if got := errors.Is(err, backup.ErrPreconditionFailed); got != tt.precondition {
+				t.Errorf("Is(ErrPreconditionFailed) = %v, want %v", got, tt.precondition)
+			}
+
+			if got := backup.Retryable(err); got != tt.retryable {
+				t.Errorf("Retryable = %v, want %v", got, tt.retryable)
+			}
+		})
+	}
+}
+
+func TestNewRequestURL(t *testing.T) {
+	tests := []struct {
+		endpoint  string
+		pathStyle bool
+		want      string
+	}{
+		{"https://s3.amazonaws.com", false, "https://bucket.s3.amazonaws.com/backups/a%20b.zip"},
+		{"http://minio:9000", true, "http://minio:9000/bucket/backups/a%20b.zip"},
+		{"http://proxy/s3/", true, "http://proxy/s3/bucket/backups/a%20b.zip"},
+		{"http://proxy/s3", false, "http://bucket.proxy/s3/backups/a%20b.zip"},
+	}
+
+	for _, tt := range tests {
+		client, err := New("bucket", Options{Endpoint: tt.endpoint, PathStyle: tt.pathStyle, Prefix: "/backups/"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := client.(*S3Client).newRequest(context.Background(), http.MethodGet, "a b.zip", nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := req.URL.String(); got != tt.want {
+			t.Errorf("%s (path style %v): URL = %s, want %s", tt.endpoint, tt.pathStyle, got, tt.want)
+		}
+	}
+}
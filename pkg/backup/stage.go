@@ -0,0 +1,161 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// How Stage creates the staged files
+type StageMode string
+
+const (
+	// Copy-on-write clones on filesystems that support them, e.g. Btrfs and XFS, and copies elsewhere
+	StageReflink StageMode = "reflink"
+	// Hard links on the same filesystem, and copies elsewhere. A hard linked file is the original file,
+	// so writes to the original after staging also change the staged file
+	StageHardlink StageMode = "hardlink"
+	StageCopy     StageMode = "copy"
+)
+
+func ParseStageMode(s string) (StageMode, error) {
+	switch m := StageMode(strings.ToLower(s)); m {
+	case StageReflink, StageHardlink, StageCopy:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown stage mode %q. expected reflink, hardlink or copy", s)
+	}
+}
+
+// Totals for the files staged by Stage
+type StageStats struct {
+	Files  int
+	Cloned int
+	Linked int
+	Copied int
+	// Total size of the staged files
+	Size int64
+}
+
+// Stages the files the worlds would archive into dir, keeping their modes and modification times. Returns worlds
+// that archive the staged files under the same entry names. dir may be inside one of the worlds, e.g. the server's
+// data directory, in which case it is skipped
+func Stage(worlds []World, dir string, mode StageMode) ([]World, *StageStats, error) {
+	stats := &StageStats{}
+	staged := make([]World, len(worlds))
+
+	for i, world := range worlds {
+		// worlds may have the same or empty names, so each is staged under its index
+		root := filepath.Join(dir, strconv.Itoa(i))
+
+		if err := stageWorld(world, dir, root, mode, stats); err != nil {
+			return nil, nil, err
+		}
+
+		staged[i] = World{Name: world.Name, Path: root, Select: world.Select}
+	}
+
+	return staged, stats, nil
+}
+
+func stageWorld(world World, dir, root string, mode StageMode, stats *StageStats) error {
+	return filepath.Walk(world.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() && filepath.Clean(path) == filepath.Clean(dir) {
+			return filepath.SkipDir
+		}
+
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(world.Path, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(root, rel)
+
+		if rel == "." {
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		}
+
+		name, err := entryName(world, path)
+		if err != nil {
+			return err
+		}
+
+		// directories that are only descended into are created with the first file staged in them
+		if ok, err := world.selects(name, info); !ok {
+			return err
+		}
+
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		used, err := stageFile(path, target, info, mode)
+		if err != nil {
+			return err
+		}
+
+		stats.Files++
+		stats.Size += info.Size()
+
+		switch used {
+		case StageReflink:
+			stats.Cloned++
+		case StageHardlink:
+			stats.Linked++
+		default:
+			stats.Copied++
+		}
+
+		return nil
+	})
+}
+
+// Stages the file at src as dst with the given mode, falling back to a copy. Returns the mode that was used
+func stageFile(src, dst string, info os.FileInfo, mode StageMode) (StageMode, error) {
+	if mode == StageHardlink {
+		if err := os.Link(src, dst); err == nil {
+			return StageHardlink, nil
+		}
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return "", err
+	}
+
+	used := StageCopy
+	if mode == StageReflink && reflink(out, in) == nil {
+		used = StageReflink
+	} else if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return "", err
+	}
+
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+
+	return used, os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
@@ -0,0 +1,203 @@
+package backup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseStageMode(t *testing.T) {
+	for s, want := range map[string]StageMode{"reflink": StageReflink, "hardlink": StageHardlink, "COPY": StageCopy} {
+		if got, err := ParseStageMode(s); err != nil || got != want {
+			t.Errorf("ParseStageMode(%s) = %s, %v", s, got, err)
+		}
+	}
+
+	for _, s := range []string{"", "link", "symlink"} {
+		if _, err := ParseStageMode(s); err == nil {
+			t.Errorf("ParseStageMode(%q) succeeded", s)
+		}
+	}
+}
+
+// Selects the files of a server's data directory like the world and properties presets would
+func selectWorld(name string, dir bool) Selection {
+	switch {
+	case name == "world" || strings.HasPrefix(name, "world/") || name == "server.properties":
+		return Include
+	case name == "logs":
+		return Exclude
+	case dir:
+		return Descend
+	default:
+		return Exclude
+	}
+}
+
+func TestStage(t *testing.T) {
+	files := map[string]string{
+		"world/level.dat":        "level",
+		"world/region/r.0.0.mca": "region",
+		"server.properties":      "level-name=world",
+		"logs/latest.log":        "log",
+		"ops.json":               "[]",
+	}
+	staged := map[string]string{
+		"0/world/level.dat":        "level",
+		"0/world/region/r.0.0.mca": "region",
+		"0/server.properties":      "level-name=world",
+	}
+
+	for _, mode := range []StageMode{StageReflink, StageHardlink, StageCopy} {
+		t.Run(string(mode), func(t *testing.T) {
+			volume := t.TempDir()
+			writeFiles(t, volume, files)
+
+			if err := os.Chmod(filepath.Join(volume, "world", "level.dat"), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			worlds := []World{{Path: volume, Select: selectWorld}}
+			dir := t.TempDir()
+
+			stagedWorlds, stats, err := Stage(worlds, dir, mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sameFiles(t, readFiles(t, dir), staged)
+
+			if stats.Files != 3 || stats.Size != int64(len("level")+len("region")+len("level-name=world")) {
+				t.Errorf("stats %+v", *stats)
+			}
+
+			// the staged worlds archive the same files with the same sizes, times and modes
+			want, err := Fingerprint(worlds)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, err := Fingerprint(stagedWorlds); err != nil || got != want {
+				t.Errorf("fingerprint of the staged worlds = %s, %v, want %s", got, err, want)
+			}
+
+			src := filepath.Join(volume, "world", "level.dat")
+			dst := filepath.Join(dir, "0", "world", "level.dat")
+
+			srcInfo, err := os.Stat(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dstInfo, err := os.Stat(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			switch mode {
+			case StageHardlink:
+				if stats.Linked != 3 || !os.SameFile(srcInfo, dstInfo) {
+					t.Errorf("%+v, want every file linked", *stats)
+				}
+			case StageCopy:
+				if stats.Copied != 3 || os.SameFile(srcInfo, dstInfo) {
+					t.Errorf("%+v, want every file copied", *stats)
+				}
+			case StageReflink:
+				// filesystems without reflinks fall back to copies
+				if stats.Cloned+stats.Copied != 3 || os.SameFile(srcInfo, dstInfo) {
+					t.Errorf("%+v, want every file cloned or copied", *stats)
+				}
+			}
+
+			// writes to the world after staging only change linked files
+			if err := ioutil.WriteFile(src, []byte("saved"), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			want = "level"
+			if mode == StageHardlink {
+				want = "saved"
+			}
+
+			if got := readFiles(t, dir)["0/world/level.dat"]; got != want {
+				t.Errorf("staged level.dat = %q after the world was written to, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestStageHardlinkFallback(t *testing.T) {
+	volume := t.TempDir()
+	writeFiles(t, volume, map[string]string{"world/level.dat": "level"})
+
+	// files cannot be linked across filesystems
+	dir, err := ioutil.TempDir("/dev/shm", "stage-")
+	if err != nil {
+		t.Skip("no tmpfs to stage into: ", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.Link(filepath.Join(volume, "world", "level.dat"), filepath.Join(dir, "probe")); err == nil {
+		t.Skip("the staging dir is on the same filesystem as the world")
+	}
+
+	_, stats, err := Stage([]World{{Path: volume}}, dir, StageHardlink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Linked != 0 || stats.Copied != 1 {
+		t.Errorf("stats %+v, want the file copied", *stats)
+	}
+
+	sameFiles(t, readFiles(t, dir), map[string]string{"0/world/level.dat": "level"})
+}
+
+func TestStageIntoWorld(t *testing.T) {
+	volume := t.TempDir()
+	writeFiles(t, volume, map[string]string{"world/level.dat": "level", "server.properties": "level-name=world"})
+
+	// staging into the volume that is staged, with everything selected
+	dir, err := ioutil.TempDir(volume, ".stage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	staged, stats, err := Stage([]World{{Path: volume}}, dir, StageCopy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Files != 2 {
+		t.Errorf("staged %d files, want 2", stats.Files)
+	}
+
+	sameFiles(t, readFiles(t, staged[0].Path), map[string]string{"world/level.dat": "level", "server.properties": "level-name=world"})
+}
+
+func TestStageWorlds(t *testing.T) {
+	dir := t.TempDir()
+	overworld := filepath.Join(dir, "server", "world")
+	nether := filepath.Join(dir, "server", "world_nether")
+	writeFiles(t, overworld, map[string]string{"level.dat": "overworld"})
+	writeFiles(t, nether, map[string]string{"level.dat": "nether"})
+
+	// worlds with the same name are staged apart
+	worlds := []World{{Name: "world", Path: overworld}, {Name: "world", Path: nether}}
+
+	staged, _, err := Stage(worlds, filepath.Join(dir, "stage"), StageCopy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []string{"overworld", "nether"} {
+		if staged[i].Name != "world" {
+			t.Errorf("staged world %d named %s", i, staged[i].Name)
+		}
+
+		sameFiles(t, readFiles(t, staged[i].Path), map[string]string{"level.dat": want})
+	}
+}
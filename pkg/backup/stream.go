@@ -0,0 +1,42 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Streams the archive produced by write directly into the backup client without a local temp file.
+// The archive is written on a separate goroutine through a pipe read by the client's upload
+func Stream(ctx context.Context, client BackupClient, name string, write func(w io.Writer) error) error {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+
+	go func() {
+		err := write(pw)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	uploadErr := client.Backup(ctx, name, pr)
+
+	// unblocks the archive writer if the upload stopped reading early
+	pr.CloseWithError(io.ErrClosedPipe)
+
+	writeErr := <-done
+
+	// archive errors are reported over the upload errors they cause
+	if writeErr != nil && writeErr != io.ErrClosedPipe {
+		return writeErr
+	}
+
+	if uploadErr != nil {
+		return uploadErr
+	}
+
+	if writeErr == io.ErrClosedPipe {
+		return fmt.Errorf("upload of %q finished before the archive was complete", name)
+	}
+
+	return nil
+}
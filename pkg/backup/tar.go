@@ -0,0 +1,302 @@
+package backup
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Writes a compressed tar archive of worlds into target. Like Zipit each world is archived
+// under a top level directory
+func tarit(worlds []World, target io.Writer, format Format, level int) (*ArchiveStats, error) {
+	cw, err := compressor(target, format, level)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := tar.NewWriter(cw)
+	stats := &ArchiveStats{}
+
+	for _, world := range worlds {
+		if err := tarWorld(archive, world, stats); err != nil {
+			// releases the compressor, e.g. the goroutines of the zstd encoder
+			cw.Close()
+			return nil, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		cw.Close()
+		return nil, err
+	}
+
+	// Close flushes the compressed stream
+	return stats, cw.Close()
+}
+
+// Adds the files of world to the archive under the world's name
+func tarWorld(archive *tar.Writer, world World, stats *ArchiveStats) error {
+	return filepath.Walk(world.Path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// sockets, symlinks and other special files are not part of a world
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+
+		name, err := entryName(world, p)
+		if err != nil {
+			return err
+		}
+
+		if ok, err := world.selects(name, info); !ok {
+			return err
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+
+		header.Name = name
+
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+
+		n, err := io.Copy(archive, file)
+		stats.Files++
+		stats.UncompressedSize += n
+		return err
+	})
+}
+
+// Extracts a compressed tar archive of a world into the target world directory. The archive is read
+// twice, first to find the world root and then to extract it. See Unzip
+func untar(source, target string, format Format) error {
+	root, err := tarRoot(source, format)
+	if err != nil {
+		return err
+	}
+
+	return untarDir(source, format, root, target)
+}
+
+// Extracts the entries under the archive path prefix root into target
+func untarDir(source string, format Format, root, target string) error {
+	parent := filepath.Dir(target)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempDir(parent, ".tmp-"+filepath.Base(target))
+	if err != nil {
+		return err
+	}
+
+	defer os.RemoveAll(tmp)
+
+	type dirAttrs struct {
+		path    string
+		perm    os.FileMode
+		modTime time.Time
+	}
+	var dirs []dirAttrs
+
+	err = readTar(source, format, func(header *tar.Header, r io.Reader) error {
+		if !strings.HasPrefix(header.Name, root) {
+			return nil
+		}
+
+		name := strings.TrimPrefix(header.Name, root)
+		if name == "" || path.Clean(name) == "." {
+			return nil
+		}
+
+		dest, err := securePath(tmp, name)
+		if err != nil {
+			return err
+		}
+
+		mode := header.FileInfo().Mode()
+
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirAttrs{dest, mode.Perm(), header.ModTime})
+			return nil
+		case !mode.IsRegular():
+			return fmt.Errorf("unsupported file type %v for %q in archive", mode.Type(), header.Name)
+		}
+
+		return extractTarFile(r, dest, mode.Perm(), header.ModTime)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// directory permissions and mtimes are applied last since extracting files into them changes their mtime
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(dirs[i].path, dirs[i].perm); err != nil {
+			return err
+		}
+
+		if err := os.Chtimes(dirs[i].path, dirs[i].modTime, dirs[i].modTime); err != nil {
+			return err
+		}
+	}
+
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, target)
+}
+
+// Writes the entries of a compressed tar archive into target, except those skip returns true for
+func untarInPlace(source string, format Format, target string, skip func(name string) bool) error {
+	return readTar(source, format, func(header *tar.Header, r io.Reader) error {
+		if skip(header.Name) {
+			return nil
+		}
+
+		dest, err := securePath(target, header.Name)
+		if err != nil {
+			return err
+		}
+
+		mode := header.FileInfo().Mode()
+
+		switch {
+		case mode.IsDir():
+			return os.MkdirAll(dest, 0755)
+		case !mode.IsRegular():
+			return fmt.Errorf("unsupported file type %v for %q in archive", mode.Type(), header.Name)
+		}
+
+		return extractTarFile(r, dest, mode.Perm(), header.ModTime)
+	})
+}
+
+func extractTarFile(r io.Reader, dest string, perm os.FileMode, modTime time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	// OpenFile permissions are subject to umask
+	if err := os.Chmod(dest, perm); err != nil {
+		return err
+	}
+
+	return os.Chtimes(dest, modTime, modTime)
+}
+
+// Reads every file in a compressed tar archive of a world. See WalkZip
+func walkTar(source string, format Format, fn func(name string, r io.Reader) error) error {
+	root, err := tarRoot(source, format)
+	if err != nil {
+		return err
+	}
+
+	return readTar(source, format, func(header *tar.Header, r io.Reader) error {
+		if header.Typeflag != tar.TypeReg {
+			return nil
+		}
+
+		if err := fn(path.Clean(strings.TrimPrefix(header.Name, root)), r); err != nil {
+			return err
+		}
+
+		// fn may not read the whole file. Decompression errors may only surface at its end
+		_, err := io.Copy(ioutil.Discard, r)
+		return err
+	})
+}
+
+// Returns the path prefix of the world root in a compressed tar archive
+func tarRoot(source string, format Format) (string, error) {
+	names, err := entryNames(source, format)
+	return rootOf(names), err
+}
+
+// Calls fn for every entry of a compressed tar archive. Errors reading the archive are returned as *CorruptArchiveError
+func readTar(source string, format Format, fn func(header *tar.Header, r io.Reader) error) error {
+	file, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	dr, err := decompressor(file, format)
+	if err != nil {
+		return &CorruptArchiveError{Err: err}
+	}
+
+	defer dr.Close()
+
+	tr := tar.NewReader(dr)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			// the compressed stream's checksum is only verified at its end
+			if _, err := io.Copy(ioutil.Discard, dr); err != nil {
+				return &CorruptArchiveError{Err: err}
+			}
+			return nil
+		}
+
+		if err != nil {
+			return &CorruptArchiveError{Err: err}
+		}
+
+		if err := fn(header, &archiveReader{tr, header.Name}); err != nil {
+			return err
+		}
+	}
+}
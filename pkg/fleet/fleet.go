@@ -0,0 +1,252 @@
+// Package fleet coordinates the backups of the servers of a fleet through lease objects in their shared
+// backup destination, so only a limited number of them back up at once
+package fleet
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+)
+
+// Prefix lease objects are stored under in the backup destination
+const LeasePrefix = "leases/"
+
+// Returned for leases that another server took over after they expired
+var ErrLeaseLost = errors.New("backup lease was lost")
+
+// Content of a lease object
+type record struct {
+	// Server holding the lease. Empty once released
+	Holder string `json:"holder"`
+	// Identifies the acquisition, so a write whose response was lost can be recognized as our own
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+// Limits the servers of a fleet that back up at once to a number of leases. A lease is held as long as
+// it is renewed, so leases of servers that die while backing up expire after the TTL
+type Semaphore struct {
+	store  backup.ConditionalWriter
+	fleet  string
+	slots  int
+	holder string
+	ttl    time.Duration
+
+	// Interval between attempts to acquire a lease while all of them are held
+	Poll time.Duration
+}
+
+// Creates a semaphore of slots leases for the fleet. holder identifies the server, e.g. its pod name
+func NewSemaphore(store backup.ConditionalWriter, fleet string, slots int, holder string, ttl time.Duration) *Semaphore {
+	return &Semaphore{store: store, fleet: fleet, slots: slots, holder: holder, ttl: ttl, Poll: 10 * time.Second}
+}
+
+// Waits until a lease is acquired or ctx is done. The lease is renewed in the background until it is released
+func (s *Semaphore) Acquire(ctx context.Context) (*Lease, error) {
+	if s.slots < 1 {
+		return nil, fmt.Errorf("invalid number of backup leases %d", s.slots)
+	}
+
+	if s.ttl < time.Second {
+		return nil, fmt.Errorf("backup lease TTL %s is shorter than a second", s.ttl)
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// servers start at different slots so they rarely race for the same one
+	first := int(hash(s.holder) % uint64(s.slots))
+
+	for {
+		for i := 0; i < s.slots; i++ {
+			lease, err := s.tryAcquire(ctx, (first+i)%s.slots, token)
+			if err != nil {
+				return nil, err
+			}
+
+			if lease != nil {
+				go lease.renew()
+				return lease, nil
+			}
+		}
+
+		select {
+		case <-time.After(s.Poll):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Acquires the slot's lease if it is free, expired or left behind by an earlier process of this server.
+// Returns a nil lease if another server holds it
+func (s *Semaphore) tryAcquire(ctx context.Context, slot int, token string) (*Lease, error) {
+	name := s.slotName(slot)
+
+	data, generation, err := s.store.ReadObject(ctx, name)
+	if errors.Is(err, backup.ErrNotExist) {
+		generation = ""
+	} else if err != nil {
+		return nil, err
+	} else {
+		var r record
+		if err := json.Unmarshal(data, &r); err == nil && r.Holder != "" && r.Holder != s.holder && time.Now().Before(r.Expires) {
+			return nil, nil
+		}
+	}
+
+	lease := &Lease{s: s, name: name, token: token, stop: make(chan struct{}), done: make(chan struct{})}
+
+	generation, err = s.write(ctx, name, record{s.holder, token, time.Now().Add(s.ttl)}, generation)
+	if errors.Is(err, backup.ErrPreconditionFailed) {
+		// another server acquired it first
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	lease.generation = generation
+	return lease, nil
+}
+
+// Writes the record if the object's generation matches. A write that failed with another error may still have
+// been stored, in which case the next write fails its precondition. The record is read back to recognize that
+func (s *Semaphore) write(ctx context.Context, name string, r record, generation string) (string, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+
+	newGeneration, err := s.store.WriteObject(ctx, name, data, generation)
+	if !errors.Is(err, backup.ErrPreconditionFailed) {
+		return newGeneration, err
+	}
+
+	stored, storedGeneration, readErr := s.store.ReadObject(ctx, name)
+	if readErr == nil && string(stored) == string(data) {
+		return storedGeneration, nil
+	}
+
+	return "", err
+}
+
+func (s *Semaphore) slotName(slot int) string {
+	return fmt.Sprintf("%s%s/backup-%d.json", LeasePrefix, s.fleet, slot)
+}
+
+// Lease held by a server while it backs up
+type Lease struct {
+	s     *Semaphore
+	name  string
+	token string
+
+	mu         sync.Mutex
+	generation string
+	err        error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Name of the lease object
+func (l *Lease) Name() string {
+	return l.name
+}
+
+// Extends the lease every third of the TTL until it is released or lost
+func (l *Lease) renew() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.s.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), l.s.ttl/3)
+		err := l.update(ctx, record{l.s.holder, l.token, time.Now().Add(l.s.ttl)})
+		cancel()
+
+		// a failed renewal is tried again on the next tick while the lease has not expired
+		if errors.Is(err, ErrLeaseLost) {
+			return
+		}
+	}
+}
+
+func (l *Lease) update(ctx context.Context, r record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.err != nil {
+		return l.err
+	}
+
+	generation, err := l.s.write(ctx, l.name, r, l.generation)
+	if errors.Is(err, backup.ErrPreconditionFailed) {
+		l.err = fmt.Errorf("%w: %s", ErrLeaseLost, l.name)
+		return l.err
+	}
+
+	if err != nil {
+		return err
+	}
+
+	l.generation = generation
+	return nil
+}
+
+// Returns ErrLeaseLost if another server took over the lease after a renewal failed
+func (l *Lease) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Stops renewing the lease and frees it for other servers
+func (l *Lease) Release(ctx context.Context) error {
+	close(l.stop)
+	<-l.done
+
+	return l.update(ctx, record{Token: l.token})
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// Returns a delay in [0, window) derived from name, e.g. a pod name. Servers of a fleet that share a backup
+// schedule and wait for their delay first back up at different times, and each server at the same time every run
+func Jitter(name string, window time.Duration) time.Duration {
+	if window <= 0 {
+		return 0
+	}
+
+	return time.Duration(hash(name) % uint64(window))
+}
@@ -0,0 +1,346 @@
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+	"github.com/saulmaldonado/agones-mc/pkg/backup/local"
+)
+
+func newStore(t *testing.T) backup.ConditionalWriter {
+	client, err := local.New(filepath.Join(t.TempDir(), "backups"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, ok := backup.ConditionalWriterOf(client)
+	if !ok {
+		t.Fatal("local client is not a ConditionalWriter")
+	}
+
+	return store
+}
+
+func newSemaphore(store backup.ConditionalWriter, slots int, holder string) *Semaphore {
+	s := NewSemaphore(store, "mc", slots, holder, time.Second)
+	s.Poll = 10 * time.Millisecond
+	return s
+}
+
+func readRecord(t *testing.T, store backup.ConditionalWriter, name string) (record, string) {
+	data, generation, err := store.ReadObject(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatal(err)
+	}
+
+	return r, generation
+}
+
+func writeRecord(t *testing.T, store backup.ConditionalWriter, name string, r record, generation string) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.WriteObject(context.Background(), name, data, generation); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func acquire(t *testing.T, s *Semaphore) *Lease {
+	lease, err := s.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		select {
+		case <-lease.stop:
+		default:
+			lease.Release(context.Background())
+		}
+	})
+
+	return lease
+}
+
+func TestAcquire(t *testing.T) {
+	store := newStore(t)
+
+	a := acquire(t, newSemaphore(store, 2, "mc-a"))
+	b := acquire(t, newSemaphore(store, 2, "mc-b"))
+
+	if a.Name() == b.Name() {
+		t.Fatalf("both servers acquired %s", a.Name())
+	}
+
+	for _, lease := range []*Lease{a, b} {
+		if r, _ := readRecord(t, store, lease.Name()); r.Token != lease.token || !r.Expires.After(time.Now()) {
+			t.Errorf("%s holds %+v", lease.Name(), r)
+		}
+	}
+
+	// every lease is held
+	c := newSemaphore(store, 2, "mc-c")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Acquire while every lease is held = %v", err)
+	}
+
+	// a released lease is free for the next server
+	if err := a.Release(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if r, _ := readRecord(t, store, a.Name()); r.Holder != "" {
+		t.Fatalf("released lease is held by %s", r.Holder)
+	}
+
+	if lease := acquire(t, c); lease.Name() != a.Name() {
+		t.Fatalf("acquired %s, want the released %s", lease.Name(), a.Name())
+	}
+}
+
+func TestAcquireWaits(t *testing.T) {
+	store := newStore(t)
+	a := acquire(t, newSemaphore(store, 1, "mc-a"))
+
+	acquired := make(chan *Lease, 1)
+	go func() {
+		lease, err := newSemaphore(store, 1, "mc-b").Acquire(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- lease
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquired a held lease")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := a.Release(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case lease := <-acquired:
+		if lease != nil {
+			lease.Release(context.Background())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("lease was not acquired after it was released")
+	}
+}
+
+func TestAcquireInvalid(t *testing.T) {
+	store := newStore(t)
+
+	if _, err := NewSemaphore(store, "mc", 0, "mc-a", time.Minute).Acquire(context.Background()); err == nil {
+		t.Error("Acquire without leases succeeded")
+	}
+
+	if _, err := NewSemaphore(store, "mc", 1, "mc-a", time.Millisecond).Acquire(context.Background()); err == nil {
+		t.Error("Acquire with a TTL of a millisecond succeeded")
+	}
+}
+
+func TestTryAcquire(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		held record
+		want bool
+	}{
+		{"held by another server", record{"mc-b", "b", time.Now().Add(time.Minute)}, false},
+		{"expired", record{"mc-b", "b", time.Now().Add(-time.Second)}, true},
+		{"released", record{Token: "b"}, true},
+		// left behind by an earlier process of this server
+		{"stale lease of this server", record{"mc-a", "old", time.Now().Add(time.Minute)}, true},
+	}
+
+	for _, tt := range tests {
+		store := newStore(t)
+		s := newSemaphore(store, 1, "mc-a")
+		name := s.slotName(0)
+
+		writeRecord(t, store, name, tt.held, "")
+
+		lease, err := s.tryAcquire(ctx, 0, "a")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if (lease != nil) != tt.want {
+			t.Errorf("%s: acquired %v, want %v", tt.name, lease != nil, tt.want)
+		}
+
+		r, generation := readRecord(t, store, name)
+		if lease == nil {
+			if r.Holder != tt.held.Holder || r.Token != tt.held.Token || !r.Expires.Equal(tt.held.Expires) {
+				t.Errorf("%s: lease changed to %+v", tt.name, r)
+			}
+			continue
+		}
+
+		if r.Holder != "mc-a" || r.Token != "a" || lease.generation != generation {
+			t.Errorf("%s: lease %+v at generation %s, acquired at %s", tt.name, r, generation, lease.generation)
+		}
+	}
+}
+
+// Store whose writes are retried once, like a write whose response was lost, so the retry fails its precondition
+// even though the first attempt was stored
+type lostResponseStore struct {
+	backup.ConditionalWriter
+}
+
+func (s lostResponseStore) WriteObject(ctx context.Context, name string, data []byte, generation string) (string, error) {
+	if _, err := s.ConditionalWriter.WriteObject(ctx, name, data, generation); err != nil {
+		return "", err
+	}
+
+	return s.ConditionalWriter.WriteObject(ctx, name, data, generation)
+}
+
+func TestLostWrite(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t)
+	s := newSemaphore(lostResponseStore{store}, 1, "mc-a")
+
+	// the stored record has our token, so the lease is ours
+	lease, err := s.tryAcquire(ctx, 0, "a")
+	if err != nil || lease == nil {
+		t.Fatalf("tryAcquire = %v, %v", lease, err)
+	}
+
+	_, generation := readRecord(t, store, lease.Name())
+	if lease.generation != generation {
+		t.Fatalf("lease acquired at generation %s, stored at %s", lease.generation, generation)
+	}
+
+	if err := lease.update(ctx, record{"mc-a", "a", time.Now().Add(time.Minute)}); err != nil {
+		t.Fatalf("renewal after a lost write = %v", err)
+	}
+
+	// a write of another server is not mistaken for ours
+	r, generation := readRecord(t, store, lease.Name())
+	writeRecord(t, store, lease.Name(), record{"mc-b", "b", r.Expires}, generation)
+
+	if err := lease.update(ctx, record{"mc-a", "a", time.Now().Add(time.Minute)}); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("renewal after a competing write = %v, want ErrLeaseLost", err)
+	}
+}
+
+func TestLeaseLost(t *testing.T) {
+	store := newStore(t)
+	lease := acquire(t, newSemaphore(store, 1, "mc-a"))
+
+	if err := lease.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// another server takes over the lease, e.g. after renewals failed until it expired. The write is retried
+	// if it races with a renewal
+	data, err := json.Marshal(record{"mc-b", "b", time.Now().Add(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		_, generation := readRecord(t, store, lease.Name())
+		_, err := store.WriteObject(context.Background(), lease.Name(), data, generation)
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, backup.ErrPreconditionFailed) {
+			t.Fatal(err)
+		}
+	}
+
+	// the next renewal finds the lease lost
+	deadline := time.Now().Add(5 * time.Second)
+	for lease.Err() == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := lease.Err(); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("Err = %v, want ErrLeaseLost", err)
+	}
+
+	// the lease of the other server is not released
+	if err := lease.Release(context.Background()); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("Release = %v, want ErrLeaseLost", err)
+	}
+
+	if r, _ := readRecord(t, store, lease.Name()); r.Holder != "mc-b" {
+		t.Fatalf("lease held by %q after a lost lease was released", r.Holder)
+	}
+}
+
+func TestLeaseRenew(t *testing.T) {
+	store := newStore(t)
+	lease := acquire(t, newSemaphore(store, 1, "mc-a"))
+
+	acquired, _ := readRecord(t, store, lease.Name())
+
+	// renewed every third of the TTL
+	time.Sleep(time.Second / 2)
+
+	renewed, _ := readRecord(t, store, lease.Name())
+	if !renewed.Expires.After(acquired.Expires) || renewed.Token != acquired.Token {
+		t.Fatalf("lease %+v after renewal, acquired as %+v", renewed, acquired)
+	}
+
+	if err := lease.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	window := time.Minute
+
+	for i := 0; i < 1000; i++ {
+		name := fmt.Sprintf("mc-%d", i)
+
+		d := Jitter(name, window)
+		if d < 0 || d >= window {
+			t.Fatalf("Jitter(%s) = %s, want it in [0, %s)", name, d, window)
+		}
+
+		if Jitter(name, window) != d {
+			t.Fatalf("Jitter(%s) changed", name)
+		}
+	}
+
+	if d := Jitter("mc-0", time.Nanosecond); d != 0 {
+		t.Errorf("Jitter with a window of 1ns = %s", d)
+	}
+
+	for _, window := range []time.Duration{0, -time.Minute} {
+		if d := Jitter("mc-0", window); d != 0 {
+			t.Errorf("Jitter with a window of %s = %s", window, d)
+		}
+	}
+
+	if Jitter("mc-0", window) == Jitter("mc-1", window) {
+		t.Error("servers have the same delay")
+	}
+}
@@ -0,0 +1,128 @@
+// Package notify sends the outcomes of backups, prunes and loads to webhooks
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type EventType string
+
+// Events notifiers are sent
+const (
+	BackupSucceeded EventType = "backup.succeeded"
+	BackupFailed    EventType = "backup.failed"
+	// Backups deleted by the retention policy
+	BackupPruned  EventType = "backup.pruned"
+	LoadSucceeded EventType = "load.succeeded"
+	LoadFailed    EventType = "load.failed"
+)
+
+// Outcome of a backup, prune or load
+type Event struct {
+	Type   EventType
+	Server string
+	Fleet  string
+	// Name of the backup that was made or loaded
+	Backup string
+	// Size of the backup in bytes, if known
+	Size     int64
+	Duration time.Duration
+	// Names of the pruned backups
+	Pruned []string
+	// Error the backup or load failed with
+	Error string
+	Time  time.Time
+}
+
+// Reports whether the event is a failure
+func (e Event) Failed() bool {
+	return e.Type == BackupFailed || e.Type == LoadFailed
+}
+
+// One line summary of the event for chat messages, e.g.
+// Backup mc-server-abcde-2021-07-01T00:00:00Z.zip of mc-server-abcde succeeded (1.5 GiB in 35s)
+func (e Event) Message() string {
+	var b strings.Builder
+
+	switch e.Type {
+	case BackupSucceeded, BackupFailed:
+		b.WriteString("Backup")
+	case LoadSucceeded, LoadFailed:
+		b.WriteString("Load of backup")
+	case BackupPruned:
+		fmt.Fprintf(&b, "Pruned %d backups", len(e.Pruned))
+	default:
+		b.WriteString(string(e.Type))
+	}
+
+	if e.Backup != "" {
+		fmt.Fprintf(&b, " %s", e.Backup)
+	}
+
+	if e.Server != "" {
+		fmt.Fprintf(&b, " of %s", e.Server)
+	}
+
+	switch {
+	case e.Failed():
+		fmt.Fprintf(&b, " failed: %s", e.Error)
+	case e.Type == BackupSucceeded || e.Type == LoadSucceeded:
+		b.WriteString(" succeeded")
+	}
+
+	var details []string
+	if e.Size > 0 {
+		details = append(details, formatSize(e.Size))
+	}
+	if e.Duration > 0 {
+		details = append(details, "in "+e.Duration.Round(time.Second/10).String())
+	}
+
+	if len(details) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(details, " "))
+	}
+
+	return b.String()
+}
+
+// Sends events to an external service
+type Notifier interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+// Reports whether t is one of the events. Events may also name a category such as backup or load.
+// No events matches every event
+func Matches(events []string, t EventType) bool {
+	if len(events) == 0 {
+		return true
+	}
+
+	category := strings.SplitN(string(t), ".", 2)[0]
+
+	for _, e := range events {
+		if e == string(t) || e == category || e == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Formats a byte count with a binary unit, e.g. 1.5 GiB
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,374 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+)
+
+// Payload formats of webhooks
+type Format string
+
+const (
+	// The event as a JSON object
+	JSONFormat Format = "json"
+	// Discord webhook message with an embed
+	DiscordFormat Format = "discord"
+	// Slack incoming webhook message with an attachment
+	SlackFormat Format = "slack"
+)
+
+// Embed and attachment colors
+const (
+	successColor = 0x2eb67d
+	failureColor = 0xe01e5a
+	infoColor    = 0x36c5f0
+)
+
+type WebhookOptions struct {
+	// Payload format. Detected from the URL if empty, see DetectFormat
+	Format Format
+	// Go template of the request body, executed with the Event. Overrides Format. Its json function
+	// quotes values, e.g. {"content": {{json .Message}}}
+	Template string
+	// Events sent to the webhook. See Matches
+	Events []string
+	// Timeout of each request. Defaults to 10 seconds
+	Timeout time.Duration
+	// Retries of failed requests. Defaults to backup.DefaultRetryPolicy
+	Retry *backup.RetryPolicy
+	// HTTP client used for requests. Defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// Notifier that POSTs events to a URL
+type Webhook struct {
+	url      string
+	format   Format
+	template *template.Template
+	events   []string
+	timeout  time.Duration
+	retry    backup.RetryPolicy
+	client   *http.Client
+}
+
+// Returned for responses other than 2xx
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("webhook: unexpected status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("webhook: unexpected status %d: %s", e.StatusCode, e.Body)
+}
+
+// Server errors, rate limiting and request timeouts are retried. Other client errors are not
+func (e *StatusError) Retryable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusRequestTimeout
+}
+
+func NewWebhook(rawURL string, opts WebhookOptions) (*Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("webhook URL %q is not http or https", Redact(rawURL))
+	}
+
+	w := &Webhook{
+		url:     rawURL,
+		format:  opts.Format,
+		events:  opts.Events,
+		timeout: opts.Timeout,
+		retry:   backup.DefaultRetryPolicy,
+		client:  opts.HTTPClient,
+	}
+
+	switch w.format {
+	case "":
+		w.format = DetectFormat(u)
+	case JSONFormat, DiscordFormat, SlackFormat:
+	default:
+		return nil, fmt.Errorf("unknown webhook format %q", w.format)
+	}
+
+	if opts.Template != "" {
+		if w.template, err = template.New("webhook").Funcs(templateFuncs).Parse(opts.Template); err != nil {
+			return nil, fmt.Errorf("invalid webhook template: %w", err)
+		}
+	}
+
+	if w.timeout <= 0 {
+		w.timeout = 10 * time.Second
+	}
+
+	if opts.Retry != nil {
+		w.retry = *opts.Retry
+	}
+
+	if w.client == nil {
+		w.client = http.DefaultClient
+	}
+
+	return w, nil
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// Returns the payload format of Discord and Slack webhook URLs, and JSONFormat for any other URL
+func DetectFormat(u *url.URL) Format {
+	host := strings.ToLower(u.Hostname())
+
+	switch {
+	case (host == "discord.com" || host == "discordapp.com" || strings.HasSuffix(host, ".discord.com")) && strings.HasPrefix(u.Path, "/api/webhooks/"):
+		return DiscordFormat
+	case host == "hooks.slack.com":
+		return SlackFormat
+	default:
+		return JSONFormat
+	}
+}
+
+// Scheme and host of the URL. Webhook URLs usually contain a secret token and must not be logged in full
+func Redact(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "invalid URL"
+	}
+
+	return u.Scheme + "://" + u.Host
+}
+
+// Redacted URL of the webhook
+func (w *Webhook) String() string {
+	return Redact(w.url)
+}
+
+// POSTs the event, retrying failed requests. Events the webhook is not configured for are ignored
+func (w *Webhook) Notify(ctx context.Context, e Event) error {
+	if !Matches(w.events, e.Type) {
+		return nil
+	}
+
+	body, err := w.payload(e)
+	if err != nil {
+		return err
+	}
+
+	return backup.Retry(ctx, w.retry, func() error {
+		return w.post(ctx, body)
+	}, nil)
+}
+
+func (w *Webhook) post(ctx context.Context, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "agones-mc")
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		// the error includes the URL
+		if ue, ok := err.(*url.Error); ok {
+			ue.URL = w.String()
+		}
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return &StatusError{StatusCode: res.StatusCode, Body: strings.TrimSpace(string(msg))}
+	}
+
+	io.Copy(ioutil.Discard, res.Body)
+	return nil
+}
+
+func (w *Webhook) payload(e Event) ([]byte, error) {
+	if w.template != nil {
+		var b bytes.Buffer
+		if err := w.template.Execute(&b, e); err != nil {
+			return nil, fmt.Errorf("error executing webhook template: %w", err)
+		}
+		return b.Bytes(), nil
+	}
+
+	switch w.format {
+	case DiscordFormat:
+		return json.Marshal(discordPayload(e))
+	case SlackFormat:
+		return json.Marshal(slackPayload(e))
+	default:
+		return json.Marshal(jsonPayload(e))
+	}
+}
+
+type jsonEvent struct {
+	Event    EventType `json:"event"`
+	Server   string    `json:"server,omitempty"`
+	Fleet    string    `json:"fleet,omitempty"`
+	Backup   string    `json:"backup,omitempty"`
+	Size     int64     `json:"size,omitempty"`
+	Duration float64   `json:"durationSeconds,omitempty"`
+	Pruned   []string  `json:"pruned,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Message  string    `json:"message"`
+	Time     time.Time `json:"time"`
+}
+
+func jsonPayload(e Event) jsonEvent {
+	return jsonEvent{
+		Event:    e.Type,
+		Server:   e.Server,
+		Fleet:    e.Fleet,
+		Backup:   e.Backup,
+		Size:     e.Size,
+		Duration: e.Duration.Seconds(),
+		Pruned:   e.Pruned,
+		Error:    e.Error,
+		Message:  e.Message(),
+		Time:     e.Time.UTC(),
+	}
+}
+
+type field struct {
+	Name  string
+	Value string
+}
+
+// Details of the event shown as fields of chat messages
+func fields(e Event) []field {
+	var f []field
+
+	if e.Server != "" {
+		f = append(f, field{"Server", e.Server})
+	}
+	if e.Fleet != "" {
+		f = append(f, field{"Fleet", e.Fleet})
+	}
+	if e.Backup != "" {
+		f = append(f, field{"Backup", e.Backup})
+	}
+	if e.Size > 0 {
+		f = append(f, field{"Size", formatSize(e.Size)})
+	}
+	if e.Duration > 0 {
+		f = append(f, field{"Duration", e.Duration.Round(time.Second / 10).String()})
+	}
+	if len(e.Pruned) > 0 {
+		f = append(f, field{"Pruned", strings.Join(e.Pruned, "\n")})
+	}
+	if e.Error != "" {
+		f = append(f, field{"Error", e.Error})
+	}
+
+	return f
+}
+
+func color(e Event) int {
+	switch {
+	case e.Failed():
+		return failureColor
+	case e.Type == BackupPruned:
+		return infoColor
+	default:
+		return successColor
+	}
+}
+
+type discordMessage struct {
+	Username string         `json:"username"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title     string         `json:"title"`
+	Color     int            `json:"color"`
+	Fields    []discordField `json:"fields,omitempty"`
+	Timestamp string         `json:"timestamp"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+func discordPayload(e Event) discordMessage {
+	embed := discordEmbed{Title: e.Message(), Color: color(e), Timestamp: e.Time.UTC().Format(time.RFC3339)}
+
+	for _, f := range fields(e) {
+		// Discord rejects field values over 1024 characters
+		embed.Fields = append(embed.Fields, discordField{Name: f.Name, Value: truncate(f.Value, 1024), Inline: f.Name != "Error" && f.Name != "Pruned"})
+	}
+
+	// embed titles are limited to 256 characters
+	embed.Title = truncate(embed.Title, 256)
+
+	return discordMessage{Username: "agones-mc", Embeds: []discordEmbed{embed}}
+}
+
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+type slackAttachment struct {
+	Color  string       `json:"color"`
+	Fields []slackField `json:"fields,omitempty"`
+	Ts     int64        `json:"ts"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+func slackPayload(e Event) slackMessage {
+	attachment := slackAttachment{Color: fmt.Sprintf("#%06x", color(e)), Ts: e.Time.Unix()}
+
+	for _, f := range fields(e) {
+		attachment.Fields = append(attachment.Fields, slackField{Title: f.Name, Value: f.Value, Short: f.Name != "Error" && f.Name != "Pruned"})
+	}
+
+	return slackMessage{Text: e.Message(), Attachments: []slackAttachment{attachment}}
+}
+
+// Shortens s to n characters
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+
+	return string(r[:n-3]) + "..."
+}
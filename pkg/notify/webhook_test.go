@@ -0,0 +1,333 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+)
+
+var testRetry = backup.RetryPolicy{Attempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+var testEvent = Event{
+	Type:     BackupSucceeded,
+	Server:   "mc-server-abcde",
+	Fleet:    "mc-fleet",
+	Backup:   "mc-server-abcde-2021-07-01T00:00:00Z.zip",
+	Size:     3 << 29,
+	Duration: 35 * time.Second,
+	Time:     time.Date(2021, time.July, 1, 0, 0, 0, 0, time.UTC),
+}
+
+// Webhook receiver that responds with the given statuses in turn and then 204
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+
+	if len(r.statuses) > 0 {
+		status := r.statuses[0]
+		r.statuses = r.statuses[1:]
+		w.WriteHeader(status)
+		w.Write([]byte("try again later"))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newReceiver(t *testing.T, statuses ...int) (*receiver, string) {
+	r := &receiver{statuses: statuses}
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	return r, srv.URL + "/hooks/secret-token"
+}
+
+func notify(t *testing.T, rawURL string, opts WebhookOptions, e Event) error {
+	if opts.Retry == nil {
+		opts.Retry = &testRetry
+	}
+
+	w, err := NewWebhook(rawURL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return w.Notify(context.Background(), e)
+}
+
+func TestWebhookJSON(t *testing.T) {
+	r, u := newReceiver(t)
+
+	if err := notify(t, u, WebhookOptions{}, testEvent); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.requests) != 1 {
+		t.Fatalf("%d requests, want 1", len(r.requests))
+	}
+
+	req := r.requests[0]
+	if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("%s request with content type %q", req.Method, req.Header.Get("Content-Type"))
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(r.bodies[0], &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"event":           "backup.succeeded",
+		"server":          "mc-server-abcde",
+		"fleet":           "mc-fleet",
+		"backup":          "mc-server-abcde-2021-07-01T00:00:00Z.zip",
+		"size":            float64(3 << 29),
+		"durationSeconds": float64(35),
+		"message":         "Backup mc-server-abcde-2021-07-01T00:00:00Z.zip of mc-server-abcde succeeded (1.5 GiB in 35s)",
+		"time":            "2021-07-01T00:00:00Z",
+	}
+
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+
+	if _, ok := got["error"]; ok {
+		t.Error("error is set for a successful backup")
+	}
+}
+
+func TestWebhookDiscord(t *testing.T) {
+	r, u := newReceiver(t)
+
+	e := Event{Type: BackupFailed, Server: "mc-server-abcde", Error: strings.Repeat("x", 2000), Time: testEvent.Time}
+	if err := notify(t, u, WebhookOptions{Format: DiscordFormat}, e); err != nil {
+		t.Fatal(err)
+	}
+
+	var msg discordMessage
+	if err := json.Unmarshal(r.bodies[0], &msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(msg.Embeds) != 1 {
+		t.Fatalf("%d embeds, want 1", len(msg.Embeds))
+	}
+
+	embed := msg.Embeds[0]
+	if embed.Color != failureColor || embed.Timestamp != "2021-07-01T00:00:00Z" {
+		t.Errorf("embed color %x and timestamp %s", embed.Color, embed.Timestamp)
+	}
+
+	if n := len([]rune(embed.Title)); n > 256 || !strings.HasPrefix(embed.Title, "Backup of mc-server-abcde failed: ") {
+		t.Errorf("title of %d characters: %.50s", n, embed.Title)
+	}
+
+	if len(embed.Fields) != 2 || embed.Fields[0].Name != "Server" || !embed.Fields[0].Inline {
+		t.Fatalf("fields = %+v", embed.Fields)
+	}
+
+	if f := embed.Fields[1]; f.Name != "Error" || f.Inline || len(f.Value) != 1024 || !strings.HasSuffix(f.Value, "...") {
+		t.Errorf("error field %s of %d characters, inline %v", f.Name, len(f.Value), f.Inline)
+	}
+}
+
+func TestWebhookSlack(t *testing.T) {
+	r, u := newReceiver(t)
+
+	e := Event{Type: BackupPruned, Server: "mc-server-abcde", Pruned: []string{"a.zip", "b.zip"}, Time: testEvent.Time}
+	if err := notify(t, u, WebhookOptions{Format: SlackFormat}, e); err != nil {
+		t.Fatal(err)
+	}
+
+	var msg slackMessage
+	if err := json.Unmarshal(r.bodies[0], &msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Text != "Pruned 2 backups of mc-server-abcde" {
+		t.Errorf("text = %q", msg.Text)
+	}
+
+	if len(msg.Attachments) != 1 {
+		t.Fatalf("%d attachments, want 1", len(msg.Attachments))
+	}
+
+	a := msg.Attachments[0]
+	if a.Color != "#36c5f0" || a.Ts != testEvent.Time.Unix() {
+		t.Errorf("attachment color %s and ts %d", a.Color, a.Ts)
+	}
+
+	if len(a.Fields) != 2 || a.Fields[1].Title != "Pruned" || a.Fields[1].Value != "a.zip\nb.zip" || a.Fields[1].Short {
+		t.Errorf("fields = %+v", a.Fields)
+	}
+}
+
+func TestWebhookTemplate(t *testing.T) {
+	r, u := newReceiver(t)
+
+	opts := WebhookOptions{Format: DiscordFormat, Template: `{"content": {{json .Message}}, "server": "{{.Server}}"}`}
+	if err := notify(t, u, opts, testEvent); err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]string
+	if err := json.Unmarshal(r.bodies[0], &got); err != nil {
+		t.Fatalf("template produced invalid JSON %s: %v", r.bodies[0], err)
+	}
+
+	if got["content"] != testEvent.Message() || got["server"] != testEvent.Server {
+		t.Errorf("body = %v", got)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int
+		wantErr  bool
+	}{
+		{"server error", []int{500, 502}, 3, false},
+		{"rate limited", []int{429}, 2, false},
+		{"attempts used up", []int{503, 503, 503}, 3, true},
+		{"bad request", []int{400}, 1, true},
+		{"not found", []int{404}, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, u := newReceiver(t, tt.statuses...)
+
+			err := notify(t, u, WebhookOptions{}, testEvent)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Notify = %v, want error %v", err, tt.wantErr)
+			}
+
+			var statusErr *StatusError
+			if err != nil && (!errors.As(err, &statusErr) || statusErr.Body != "try again later") {
+				t.Errorf("Notify = %v, want a StatusError with the response body", err)
+			}
+
+			if len(r.requests) != tt.requests {
+				t.Errorf("%d requests, want %d", len(r.requests), tt.requests)
+			}
+		})
+	}
+}
+
+func TestWebhookEvents(t *testing.T) {
+	r, u := newReceiver(t)
+
+	opts := WebhookOptions{Events: []string{"load", "backup.failed"}}
+	for _, e := range []EventType{BackupSucceeded, BackupFailed, BackupPruned, LoadSucceeded, LoadFailed} {
+		if err := notify(t, u, opts, Event{Type: e}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var sent []string
+	for _, body := range r.bodies {
+		var e jsonEvent
+		json.Unmarshal(body, &e)
+		sent = append(sent, string(e.Event))
+	}
+
+	if got, want := strings.Join(sent, ","), "backup.failed,load.succeeded,load.failed"; got != want {
+		t.Fatalf("sent %s, want %s", got, want)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		events []string
+		t      EventType
+		want   bool
+	}{
+		{nil, BackupFailed, true},
+		{[]string{"*"}, LoadSucceeded, true},
+		{[]string{"backup"}, BackupPruned, true},
+		{[]string{"backup"}, LoadFailed, false},
+		{[]string{"backup.failed", "load.failed"}, LoadFailed, true},
+		{[]string{"backup.failed"}, BackupSucceeded, false},
+		// categories are not prefixes of other categories
+		{[]string{"back"}, BackupFailed, false},
+	}
+
+	for _, tt := range tests {
+		if got := Matches(tt.events, tt.t); got != tt.want {
+			t.Errorf("Matches(%v, %s) = %v, want %v", tt.events, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookRedactsURL(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	u := srv.URL + "/api/webhooks/123/secret-token"
+	srv.Close()
+
+	err := notify(t, u, WebhookOptions{Retry: &backup.RetryPolicy{Attempts: 1}}, testEvent)
+	if err == nil {
+		t.Fatal("Notify succeeded without a server")
+	}
+
+	if strings.Contains(err.Error(), "secret-token") {
+		t.Fatalf("error contains the webhook token: %v", err)
+	}
+
+	var ue *url.Error
+	if !errors.As(err, &ue) || ue.URL != Redact(u) {
+		t.Fatalf("Notify = %v, want a url.Error with the redacted URL", err)
+	}
+
+	if _, err := NewWebhook("ftp://example.com/secret-token", WebhookOptions{}); err == nil || strings.Contains(err.Error(), "secret-token") {
+		t.Fatalf("NewWebhook = %v, want an error without the token", err)
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := map[string]Format{
+		"https://discord.com/api/webhooks/1/token":      DiscordFormat,
+		"https://ptb.discord.com/api/webhooks/1/token":  DiscordFormat,
+		"https://discordapp.com/api/webhooks/1/token":   DiscordFormat,
+		"https://discord.com/other":                     JSONFormat,
+		"https://hooks.slack.com/services/T/B/token":    SlackFormat,
+		"https://example.com/hooks.slack.com/discord":   JSONFormat,
+		"https://evil.com/api/webhooks/1/token":         JSONFormat,
+		"https://discord.com.evil.com/api/webhooks/1/t": JSONFormat,
+	}
+
+	for raw, want := range tests {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := DetectFormat(u); got != want {
+			t.Errorf("DetectFormat(%s) = %s, want %s", raw, got, want)
+		}
+	}
+}
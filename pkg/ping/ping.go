@@ -64,10 +64,15 @@ func NewTimed(host string, port uint16, timeout time.Duration, edition config.Ed
 		return nil, err
 	}
 
+	return &ServerPinger{host, port, sdk, NewPinger(host, port, timeout, edition)}, nil
+}
+
+// Creates a pinger for the given edition without connecting to the local Agones server
+func NewPinger(host string, port uint16, timeout time.Duration, edition config.Edition) Pinger {
 	if strings.ToLower(string(edition)) == "bedrock" {
-		return &ServerPinger{host, port, sdk, &BedrockPinger{Port: port, Host: host, Timeout: timeout}}, nil
+		return &BedrockPinger{Port: port, Host: host, Timeout: timeout}
 	}
-	return &ServerPinger{host, port, sdk, &McPinger{Port: port, Host: host, Timeout: timeout}}, nil
+	return &McPinger{Port: port, Host: host, Timeout: timeout}
 }
 
 // Pings the minecraft server and sends Health() signal to the local Agones server on localhost port 9357
@@ -0,0 +1,261 @@
+package save
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bedrock Dedicated Server console output
+const (
+	// save hold started or was already running
+	holdResponse    = "Saving..."
+	holdRunningResp = "The command is already running"
+	// save query before the held files are ready
+	notReadyResponse = "A previous save has not been completed"
+	// save query once the held files are ready. The next line lists them
+	readyResponse = "Files are now ready to be copied"
+	// save resume
+	resumeResponse = "Changes to the level are resumed"
+)
+
+// Interval save query is sent until the held files are ready
+const queryInterval = time.Second
+
+// File of a held Bedrock world, relative to the server's worlds directory, and the length it must be copied up to
+type File struct {
+	Path string
+	Size int64
+}
+
+// Bedrock holds world saving on a Bedrock Dedicated Server, which has no RCON, through its console.
+// Pause sends save hold and polls save query until the server lists the files to copy and their lengths.
+// Resume sends save resume. Files written after the hold are only consistent up to the listed lengths, see CopyFiles
+type Bedrock struct {
+	console Console
+	timeout time.Duration
+
+	mu    sync.Mutex
+	held  bool
+	files []File
+}
+
+func NewBedrock(console Console, timeout time.Duration) *Bedrock {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &Bedrock{console: console, timeout: timeout}
+}
+
+// Files listed by the server once the hold is ready
+func (b *Bedrock) Files() []File {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.files
+}
+
+func (b *Bedrock) Pause() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	deadline := time.Now().Add(b.timeout)
+
+	// the server may hold saving even if its response never arrives
+	b.held = true
+	b.files = nil
+
+	if _, err := b.command("save hold", deadline, holdResponse, holdRunningResp); err != nil {
+		return err
+	}
+
+	for {
+		res, err := b.command("save query", deadline, readyResponse, notReadyResponse)
+		if err != nil {
+			return err
+		}
+
+		if strings.Contains(res, readyResponse) {
+			break
+		}
+
+		select {
+		case <-time.After(queryInterval):
+		case <-time.After(time.Until(deadline)):
+			return fmt.Errorf("timed out after %s waiting for save query to list the world files", b.timeout)
+		}
+	}
+
+	files, err := b.awaitFiles(deadline)
+	if err != nil {
+		return err
+	}
+
+	b.files = files
+	return nil
+}
+
+func (b *Bedrock) Resume() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.held {
+		return nil
+	}
+
+	if _, err := b.command("save resume", time.Now().Add(b.timeout), resumeResponse); err != nil {
+		return err
+	}
+
+	b.held = false
+	return nil
+}
+
+// Sends cmd and waits for an output line containing one of responses. Output from before
+// the command is discarded
+func (b *Bedrock) command(cmd string, deadline time.Time, responses ...string) (string, error) {
+	b.drain()
+
+	if err := b.console.Send(cmd); err != nil {
+		return "", fmt.Errorf("%s: %w", cmd, err)
+	}
+
+	line, err := b.await(deadline, func(line string) bool {
+		for _, res := range responses {
+			if strings.Contains(line, res) {
+				return true
+			}
+		}
+		return false
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", cmd, err)
+	}
+
+	return line, nil
+}
+
+// Waits for the file list that follows the save query ready response
+func (b *Bedrock) awaitFiles(deadline time.Time) ([]File, error) {
+	var files []File
+
+	_, err := b.await(deadline, func(line string) bool {
+		var err error
+		files, err = ParseFiles(line)
+		return err == nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("save query file list: %w", err)
+	}
+
+	return files, nil
+}
+
+// Reads output lines until match returns true for one
+func (b *Bedrock) await(deadline time.Time, match func(line string) bool) (string, error) {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	for {
+		select {
+		case line, ok := <-b.console.Lines():
+			if !ok {
+				return "", fmt.Errorf("console closed")
+			}
+
+			if match(line) {
+				return line, nil
+			}
+		case <-timer.C:
+			return "", fmt.Errorf("timed out after %s waiting for a response", b.timeout)
+		}
+	}
+}
+
+// Discards buffered output lines
+func (b *Bedrock) drain() {
+	for {
+		select {
+		case _, ok := <-b.console.Lines():
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Parses the file list printed by save query, e.g. "Bedrock level/db/000005.ldb:1234, Bedrock level/db/CURRENT:16"
+func ParseFiles(line string) ([]File, error) {
+	var files []File
+
+	for _, entry := range strings.Split(strings.TrimSpace(line), ", ") {
+		i := strings.LastIndex(entry, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid file list entry %q", entry)
+		}
+
+		size, err := strconv.ParseInt(entry[i+1:], 10, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid file length in entry %q", entry)
+		}
+
+		files = append(files, File{Path: entry[:i], Size: size})
+	}
+
+	return files, nil
+}
+
+// Copies the first Size bytes of each file from the server's worlds directory into target, which
+// becomes a copy of the worlds directory holding only the listed files
+func CopyFiles(worldsDir string, files []File, target string) error {
+	for _, f := range files {
+		name := filepath.Clean(filepath.FromSlash(f.Path))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("file %q is outside the worlds directory", f.Path)
+		}
+
+		if err := copyFile(filepath.Join(worldsDir, name), filepath.Join(target, name), f.Size); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func copyFile(src, dest string, size int64) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.CopyN(out, in, size); err != nil {
+		out.Close()
+		if err == io.EOF {
+			return fmt.Errorf("%s is shorter than the %d bytes listed by save query", src, size)
+		}
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,202 @@
+package save
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// In-memory Bedrock Dedicated Server console that answers save commands
+type fakeConsole struct {
+	lines chan string
+	// File list printed once the files are ready
+	files string
+	// save query responses before the files are ready
+	notReady int
+
+	mu   sync.Mutex
+	sent []string
+}
+
+func newFakeConsole(files string, notReady int) *fakeConsole {
+	return &fakeConsole{lines: make(chan string, 16), files: files, notReady: notReady}
+}
+
+func (c *fakeConsole) Send(cmd string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sent = append(c.sent, cmd)
+
+	switch cmd {
+	case "save hold":
+		c.lines <- "[INFO] Running AutoCompaction..."
+		c.lines <- "Saving..."
+	case "save query":
+		if c.notReady > 0 {
+			c.notReady--
+			c.lines <- "A previous save has not been completed."
+			return nil
+		}
+		c.lines <- "Data saved. Files are now ready to be copied."
+		c.lines <- "[INFO] Player connected: Steve"
+		c.lines <- c.files
+	case "save resume":
+		c.lines <- "Changes to the level are resumed."
+	}
+
+	return nil
+}
+
+func (c *fakeConsole) Lines() <-chan string {
+	return c.lines
+}
+
+func (c *fakeConsole) Close() error {
+	return nil
+}
+
+func (c *fakeConsole) commands() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return strings.Join(c.sent, ",")
+}
+
+func TestBedrockHold(t *testing.T) {
+	worlds := t.TempDir()
+	level := filepath.Join(worlds, "Bedrock level")
+
+	if err := os.MkdirAll(filepath.Join(level, "db"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// the server keeps writing past the listed lengths while saving is held
+	files := map[string]string{
+		"level.dat":        "0123456789",
+		"db/CURRENT":       "MANIFEST-000001\nMANIFEST-000002\n",
+		"db/000005.ldb":    "ldb",
+		"db/MANIFEST-0001": "manifest",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(level, filepath.FromSlash(name)), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	console := newFakeConsole("Bedrock level/level.dat:4, Bedrock level/db/CURRENT:16, Bedrock level/db/000005.ldb:3", 1)
+	b := NewBedrock(console, 5*time.Second)
+
+	if err := b.Pause(); err != nil {
+		t.Fatal(err)
+	}
+
+	target := t.TempDir()
+	if err := CopyFiles(worlds, b.Files(), target); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Resume(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := console.commands(), "save hold,save query,save query,save resume"; got != want {
+		t.Fatalf("sent %s, want %s", got, want)
+	}
+
+	want := map[string]string{
+		"level.dat":     "0123",
+		"db/CURRENT":    "MANIFEST-000001\n",
+		"db/000005.ldb": "ldb",
+	}
+	for name, data := range want {
+		got, err := ioutil.ReadFile(filepath.Join(target, "Bedrock level", filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(got) != data {
+			t.Errorf("%s = %q, want %q", name, got, data)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(target, "Bedrock level", "db", "MANIFEST-0001")); !os.IsNotExist(err) {
+		t.Errorf("unlisted file was copied: %v", err)
+	}
+
+	// resuming twice does not send save resume again
+	if err := b.Resume(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := console.commands(); strings.Count(got, "save resume") != 1 {
+		t.Fatalf("sent %s, want one save resume", got)
+	}
+}
+
+// Console that never answers
+type silentConsole struct {
+	lines chan string
+}
+
+func (c *silentConsole) Send(cmd string) error { return nil }
+func (c *silentConsole) Lines() <-chan string  { return c.lines }
+func (c *silentConsole) Close() error          { return nil }
+
+func TestBedrockTimeout(t *testing.T) {
+	b := NewBedrock(&silentConsole{make(chan string)}, 100*time.Millisecond)
+
+	start := time.Now()
+	if err := b.Pause(); err == nil {
+		t.Fatal("Pause succeeded without a response")
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Pause returned after %s, want about 100ms", elapsed)
+	}
+}
+
+func TestCopyFilesErrors(t *testing.T) {
+	worlds := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(worlds, "level.dat"), []byte("0123"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		file File
+	}{
+		{"outside worlds", File{Path: "../level.dat", Size: 1}},
+		{"absolute", File{Path: "/etc/passwd", Size: 1}},
+		{"shorter than listed", File{Path: "level.dat", Size: 100}},
+		{"missing", File{Path: "missing.dat", Size: 1}},
+	}
+
+	for _, tt := range tests {
+		if err := CopyFiles(worlds, []File{tt.file}, t.TempDir()); err == nil {
+			t.Errorf("%s: CopyFiles succeeded", tt.name)
+		}
+	}
+}
+
+func TestParseFiles(t *testing.T) {
+	files, err := ParseFiles("Bedrock level/db/000005.ldb:1234, Bedrock level/db/CURRENT:16\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []File{{"Bedrock level/db/000005.ldb", 1234}, {"Bedrock level/db/CURRENT", 16}}
+	if len(files) != len(want) || files[0] != want[0] || files[1] != want[1] {
+		t.Fatalf("ParseFiles = %v, want %v", files, want)
+	}
+
+	for _, line := range []string{"", "Saving...", "level.dat:-1", "level.dat:x", ":4"} {
+		if _, err := ParseFiles(line); err == nil {
+			t.Errorf("ParseFiles(%q) succeeded", line)
+		}
+	}
+}
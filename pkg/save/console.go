@@ -0,0 +1,148 @@
+package save
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Console sends commands to a server's console and reads its output
+type Console interface {
+	// Sends a command line to the server
+	Send(cmd string) error
+	// Lines of console output written after the console was opened. Closed when the console is closed
+	Lines() <-chan string
+	Close() error
+}
+
+// Interval the output file of a FileConsole is polled for new lines
+const tailInterval = 100 * time.Millisecond
+
+// FileConsole is a Console for a server that reads commands from a named pipe and whose output is
+// appended to a file, both in a volume shared with the server's container
+type FileConsole struct {
+	in    *os.File
+	out   *os.File
+	lines chan string
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// Opens the named pipe (or file) the server reads commands from and follows the server's output file from its current end.
+// Opening a named pipe waits, until ctx is done, for the server to open it for reading
+func OpenFileConsole(ctx context.Context, input, output string) (*FileConsole, error) {
+	in, err := openInput(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := os.Open(output)
+	if err != nil {
+		in.Close()
+		return nil, err
+	}
+
+	if _, err := out.Seek(0, io.SeekEnd); err != nil {
+		in.Close()
+		out.Close()
+		return nil, err
+	}
+
+	c := &FileConsole{
+		in:    in,
+		out:   out,
+		lines: make(chan string, 64),
+		done:  make(chan struct{}),
+	}
+
+	go c.tail()
+
+	return c, nil
+}
+
+// A blocking open of a named pipe for writing blocks until there is a reader, which may be never if the server is not
+// running. The pipe is opened without blocking instead, which fails with ENXIO while there is no reader
+func openInput(ctx context.Context, input string) (*os.File, error) {
+	for {
+		in, err := os.OpenFile(input, os.O_WRONLY|os.O_APPEND|syscall.O_NONBLOCK, 0)
+		if !errors.Is(err, syscall.ENXIO) {
+			return in, err
+		}
+
+		select {
+		case <-time.After(tailInterval):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for the server to read %s: %w", input, ctx.Err())
+		}
+	}
+}
+
+func (c *FileConsole) Send(cmd string) error {
+	// a single write of a short line to a pipe is not interleaved with other writers
+	_, err := c.in.WriteString(cmd + "\n")
+	return err
+}
+
+func (c *FileConsole) Lines() <-chan string {
+	return c.lines
+}
+
+func (c *FileConsole) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = c.in.Close()
+	})
+	return err
+}
+
+// Sends every complete line appended to the output file to lines until the console is closed
+func (c *FileConsole) tail() {
+	defer close(c.lines)
+	defer c.out.Close()
+
+	r := bufio.NewReader(c.out)
+	var partial string
+
+	for {
+		chunk, err := r.ReadString('\n')
+		partial += chunk
+
+		if err == nil {
+			select {
+			case c.lines <- strings.TrimRight(partial, "\r\n"):
+			case <-c.done:
+				return
+			}
+			partial = ""
+			continue
+		}
+
+		if err != io.EOF {
+			return
+		}
+
+		// start over if the output file was truncated, e.g. by log rotation
+		if pos, err := c.out.Seek(0, io.SeekCurrent); err == nil {
+			if info, err := c.out.Stat(); err == nil && info.Size() < pos {
+				c.out.Seek(0, io.SeekStart)
+				r.Reset(c.out)
+				partial = ""
+			}
+		}
+
+		select {
+		case <-time.After(tailInterval):
+		case <-c.done:
+			return
+		}
+	}
+}
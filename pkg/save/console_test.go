@@ -0,0 +1,95 @@
+//go:build !windows
+// +build !windows
+
+package save
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFileConsole(t *testing.T) {
+	dir := t.TempDir()
+	input, output := filepath.Join(dir, "input"), filepath.Join(dir, "output")
+
+	if err := syscall.Mkfifo(input, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(output, []byte("old line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the server is not reading the pipe
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	if _, err := OpenFileConsole(ctx, input, output); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("OpenFileConsole without a reader = %v, want DeadlineExceeded", err)
+	}
+
+	// the server starts reading after the console started waiting for it
+	commands := make(chan string, 1)
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+
+		pipe, err := os.Open(input)
+		if err != nil {
+			close(commands)
+			return
+		}
+
+		defer pipe.Close()
+
+		line, _ := bufio.NewReader(pipe).ReadString('\n')
+		commands <- line
+	}()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	console, err := OpenFileConsole(ctx, input, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer console.Close()
+
+	if err := console.Send("save hold"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := <-commands; got != "save hold\n" {
+		t.Fatalf("server read %q, want save hold", got)
+	}
+
+	out, err := os.OpenFile(output, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer out.Close()
+
+	// lines written in pieces are only sent once complete
+	out.WriteString("Sav")
+	time.Sleep(2 * tailInterval)
+	out.WriteString("ing...\r\nnext\n")
+
+	for _, want := range []string{"Saving...", "next"} {
+		select {
+		case line := <-console.Lines():
+			if line != want {
+				t.Fatalf("line = %q, want %q", line, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package save
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/james4k/rcon"
+)
+
+// Response to save-all flush once every world has been written to disk
+const savedResponse = "Saved the game"
+
+// Java pauses world saving on a Java Edition server over RCON. Pause turns autosave off with save-off and
+// waits for save-all flush to write the world to disk. Resume turns autosave back on with save-on
+type Java struct {
+	addr     string
+	password string
+	timeout  time.Duration
+	// broadcast to players with say before saving is paused
+	message string
+
+	mu     sync.Mutex
+	rc     *rcon.RemoteConsole
+	paused bool
+}
+
+func NewJava(host string, port int, password string, timeout time.Duration, message string) *Java {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &Java{
+		addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		password: password,
+		timeout:  timeout,
+		message:  message,
+	}
+}
+
+func (j *Java) Pause() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.password == "" {
+		return fmt.Errorf("RCON password is empty")
+	}
+
+	deadline := time.Now().Add(j.timeout)
+
+	if err := j.dial(deadline); err != nil {
+		return err
+	}
+
+	if j.message != "" {
+		if err := j.command("say "+j.message, "", deadline); err != nil {
+			return err
+		}
+	}
+
+	// the server may have turned saving off even if its response never arrives
+	j.paused = true
+
+	if err := j.command("save-off", "", deadline); err != nil {
+		return err
+	}
+
+	return j.command("save-all flush", savedResponse, deadline)
+}
+
+func (j *Java) Resume() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if !j.paused {
+		return nil
+	}
+
+	defer j.close()
+
+	var err error
+	if j.rc != nil {
+		err = j.command("save-on", "", time.Now().Add(j.timeout))
+	}
+
+	// the connection is redialed if it was closed by a failed command or by the server while the world was copied
+	if j.rc == nil {
+		deadline := time.Now().Add(j.timeout)
+		if err = j.dial(deadline); err == nil {
+			err = j.command("save-on", "", deadline)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	j.paused = false
+	return nil
+}
+
+func (j *Java) dial(deadline time.Time) error {
+	j.close()
+
+	type result struct {
+		rc  *rcon.RemoteConsole
+		err error
+	}
+
+	resC := make(chan result, 1)
+	go func() {
+		rc, err := rcon.Dial(j.addr, j.password)
+		resC <- result{rc, err}
+	}()
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case res := <-resC:
+		if res.err != nil {
+			return res.err
+		}
+		j.rc = res.rc
+		return nil
+	case <-timer.C:
+		// a connection made after the timeout is closed
+		go func() {
+			if res := <-resC; res.rc != nil {
+				res.rc.Close()
+			}
+		}()
+		return fmt.Errorf("timed out connecting to RCON at %s", j.addr)
+	}
+}
+
+// Sends cmd and reads responses until one to cmd contains want. The connection is closed on errors
+// since a read may still be pending on it
+func (j *Java) command(cmd, want string, deadline time.Time) error {
+	rc := j.rc
+
+	err := withTimeout(time.Until(deadline), fmt.Sprintf("%q response", cmd), func() error {
+		reqID, err := rc.Write(cmd)
+		if err != nil {
+			return err
+		}
+
+		for {
+			res, resID, err := rc.Read()
+			if err != nil {
+				return err
+			}
+
+			if resID == reqID && strings.Contains(res, want) {
+				return nil
+			}
+		}
+	})
+
+	if err != nil {
+		j.close()
+		return fmt.Errorf("%s: %w", cmd, err)
+	}
+
+	return nil
+}
+
+func (j *Java) close() {
+	if j.rc != nil {
+		j.rc.Close()
+		j.rc = nil
+	}
+}
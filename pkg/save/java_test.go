@@ -0,0 +1,288 @@
+package save
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// RCON server that answers commands like a Java Edition server
+type fakeRCON struct {
+	password string
+	// Commands whose connection is closed instead of answering them, once
+	hangup map[string]bool
+	// Commands that are never answered
+	silent map[string]bool
+
+	mu    sync.Mutex
+	sent  []string
+	dials int
+}
+
+// Starts the server and returns its port
+func (s *fakeRCON) start(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeRCON) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		var header struct{ Size, ID, Type int32 }
+		if err := binary.Read(conn, binary.LittleEndian, &header); err != nil {
+			return
+		}
+
+		body := make([]byte, header.Size-8)
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+
+		payload := strings.TrimRight(string(body), "\x00")
+
+		// auth requests are answered with an auth response whose ID is -1 if the password is wrong
+		if header.Type == 3 {
+			s.mu.Lock()
+			s.dials++
+			id := header.ID
+			if payload != s.password {
+				id = -1
+			}
+			s.mu.Unlock()
+
+			if !writePacket(conn, id, 2, "") {
+				return
+			}
+			continue
+		}
+
+		s.mu.Lock()
+		s.sent = append(s.sent, payload)
+		hangup := s.hangup[payload]
+		delete(s.hangup, payload)
+		silent := s.silent[payload]
+		s.mu.Unlock()
+
+		if hangup {
+			return
+		}
+
+		if silent {
+			continue
+		}
+
+		var responses []string
+		switch {
+		case payload == "save-off":
+			responses = []string{"Automatic saving is now disabled"}
+		case payload == "save-all flush":
+			// the server logs the save before it is done
+			responses = []string{"Saving the game (this may take a moment!)", "Saved the game"}
+		case payload == "save-on":
+			responses = []string{"Automatic saving is now enabled"}
+		case strings.HasPrefix(payload, "say "):
+			responses = []string{""}
+		}
+
+		for _, res := range responses {
+			if !writePacket(conn, header.ID, 0, res) {
+				return
+			}
+		}
+	}
+}
+
+func writePacket(w io.Writer, id, typ int32, body string) bool {
+	var packet bytes.Buffer
+	binary.Write(&packet, binary.LittleEndian, []int32{int32(10 + len(body)), id, typ})
+	packet.WriteString(body + "\x00\x00")
+
+	_, err := w.Write(packet.Bytes())
+	return err == nil
+}
+
+func (s *fakeRCON) commands() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return strings.Join(s.sent, ",")
+}
+
+func TestJavaPause(t *testing.T) {
+	server := &fakeRCON{password: "secret"}
+	j := NewJava("127.0.0.1", server.start(t), "secret", time.Second, "Backing up the world")
+
+	if err := j.Pause(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := server.commands(); got != "say Backing up the world,save-off,save-all flush" {
+		t.Fatalf("commands while pausing: %s", got)
+	}
+
+	if err := j.Resume(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := server.commands(); got != "say Backing up the world,save-off,save-all flush,save-on" {
+		t.Fatalf("commands: %s", got)
+	}
+
+	// saving is only resumed once
+	if err := j.Resume(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := server.commands(); strings.Count(got, "save-on") != 1 {
+		t.Fatalf("commands after resuming twice: %s", got)
+	}
+}
+
+func TestJavaResumeAfterFailedPause(t *testing.T) {
+	tests := []struct {
+		name   string
+		server *fakeRCON
+		want   string
+	}{
+		{"connection closed", &fakeRCON{password: "secret", hangup: map[string]bool{"save-all flush": true}}, "save-off,save-all flush,save-on"},
+		{"flush timed out", &fakeRCON{password: "secret", silent: map[string]bool{"save-all flush": true}}, "save-off,save-all flush,save-on"},
+		{"save-off timed out", &fakeRCON{password: "secret", silent: map[string]bool{"save-off": true}}, "save-off,save-on"},
+	}
+
+	for _, tt := range tests {
+		j := NewJava("127.0.0.1", tt.server.start(t), "secret", 200*time.Millisecond, "")
+
+		if err := j.Pause(); err == nil {
+			t.Fatalf("%s: Pause succeeded", tt.name)
+		}
+
+		// the server may have turned saving off, so it is turned back on over a new connection
+		if err := j.Resume(); err != nil {
+			t.Fatalf("%s: Resume = %v", tt.name, err)
+		}
+
+		if got := tt.server.commands(); got != tt.want {
+			t.Errorf("%s: commands %s, want %s", tt.name, got, tt.want)
+		}
+
+		tt.server.mu.Lock()
+		dials := tt.server.dials
+		tt.server.mu.Unlock()
+
+		if dials != 2 {
+			t.Errorf("%s: dialed %d times, want 2", tt.name, dials)
+		}
+	}
+}
+
+func TestJavaResumeRedials(t *testing.T) {
+	// the server closes the connection while the world is copied
+	server := &fakeRCON{password: "secret", hangup: map[string]bool{"save-on": true}}
+	j := NewJava("127.0.0.1", server.start(t), "secret", time.Second, "")
+
+	if err := j.Pause(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := j.Resume(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := server.commands(); got != "save-off,save-all flush,save-on,save-on" {
+		t.Fatalf("commands: %s", got)
+	}
+}
+
+func TestJavaResumeFails(t *testing.T) {
+	server := &fakeRCON{password: "secret"}
+	port := server.start(t)
+	j := NewJava("127.0.0.1", port, "secret", 200*time.Millisecond, "")
+
+	if err := j.Pause(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the connection is lost and new connections are rejected, e.g. while the server restarts
+	server.mu.Lock()
+	server.password = "changed"
+	server.mu.Unlock()
+
+	j.close()
+
+	if err := j.Resume(); err == nil {
+		t.Fatal("Resume succeeded while the server was unreachable")
+	}
+
+	server.mu.Lock()
+	server.password = "secret"
+	server.mu.Unlock()
+
+	// a failed resume is tried again
+	if err := j.Resume(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := server.commands(); got != "save-off,save-all flush,save-on" {
+		t.Fatalf("commands: %s", got)
+	}
+}
+
+func TestJavaPauseErrors(t *testing.T) {
+	server := &fakeRCON{password: "secret"}
+	port := server.start(t)
+
+	tests := map[string]*Java{
+		"empty password": NewJava("127.0.0.1", port, "", time.Second, ""),
+		"wrong password": NewJava("127.0.0.1", port, "wrong", time.Second, ""),
+		"closed port":    NewJava("127.0.0.1", closedPort(t), "secret", time.Second, ""),
+	}
+
+	for name, j := range tests {
+		if err := j.Pause(); err == nil {
+			t.Errorf("%s: Pause succeeded", name)
+		}
+
+		// saving was never paused
+		if err := j.Resume(); err != nil {
+			t.Errorf("%s: Resume = %v", name, err)
+		}
+	}
+
+	if got := server.commands(); got != "" {
+		t.Fatalf("commands sent without pausing: %s", got)
+	}
+}
+
+// Port on localhost that nothing listens on
+func closedPort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	return port
+}
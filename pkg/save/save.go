@@ -0,0 +1,34 @@
+package save
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultTimeout bounds pausing and resuming world saves
+const DefaultTimeout = time.Minute
+
+// Saver pauses world saving on a server so the world files can be copied while the server is running.
+// Resume may be called concurrently with Pause, e.g. from a signal handler, and waits for it to return
+type Saver interface {
+	// Flushes the world to disk and stops the server from writing to it until Resume is called
+	Pause() error
+	// Turns world saving back on. Safe to call if Pause failed or was never called
+	Resume() error
+}
+
+// Runs fn, giving up once timeout passes. fn keeps running in the background after a timeout
+func withTimeout(timeout time.Duration, what string, fn func() error) error {
+	errC := make(chan error, 1)
+	go func() { errC <- fn() }()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-errC:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("timed out after %s waiting for %s", timeout, what)
+	}
+}
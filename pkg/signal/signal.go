@@ -29,3 +29,25 @@ func SetupSignalHandler(log *zap.Logger) chan bool {
 
 	return stop
 }
+
+// Calls fn in the background on the first SIGTERM or interrupt received before stop is called.
+// While it is registered the signals no longer terminate the process
+func OnTerminate(fn func()) (stop func()) {
+	sigC := make(chan os.Signal, 1)
+	done := make(chan struct{})
+
+	signal.Notify(sigC, syscall.SIGTERM, os.Interrupt)
+
+	go func() {
+		select {
+		case <-sigC:
+			fn()
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigC)
+		close(done)
+	}
+}
@@ -0,0 +1,132 @@
+// Package trigger watches a GameServer for on-demand backup requests made with an annotation and for its shutdown
+package trigger
+
+import (
+	"sync"
+
+	sdkpb "agones.dev/agones/pkg/sdk"
+	sdk "agones.dev/agones/sdks/go"
+)
+
+// Default annotation a backup is requested with. Its value identifies the request, so a new backup
+// is requested by setting it to a new value, e.g. a timestamp
+const RequestAnnotation = "agones-mc/backup-requested"
+
+// Annotations written through the SDK when a requested backup finishes. Agones prefixes annotations
+// set through the SDK with SDKPrefix, e.g. agones.dev/sdk-last-backup
+const (
+	SDKPrefix = "agones.dev/sdk-"
+	// Name of the last requested backup
+	LastBackup = "last-backup"
+	// running, succeeded or failed: <error>
+	LastBackupStatus = "last-backup-status"
+	// Value of the request annotation the last backup was made for
+	LastBackupRequest = "last-backup-request"
+)
+
+// GameServer state once the server is shutting down
+const ShutdownState = "Shutdown"
+
+// Statuses of requested backups
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Agones SDK methods used by Watcher
+type SDK interface {
+	WatchGameServer(f sdk.GameServerCallback) error
+	SetAnnotation(key, value string) error
+}
+
+// Watcher sends the IDs of backups requested on the GameServer. Requests that were already handled,
+// including by an earlier process according to LastBackupRequest, are not sent again.
+// It also reports when the GameServer shuts down
+type Watcher struct {
+	sdk        SDK
+	annotation string
+	requests   chan string
+	shutdown   chan struct{}
+
+	mu       sync.Mutex
+	last     string
+	shutOnce sync.Once
+}
+
+// Starts watching the GameServer for changes of annotation
+func Watch(s SDK, annotation string) (*Watcher, error) {
+	if annotation == "" {
+		annotation = RequestAnnotation
+	}
+
+	// a request made while a backup runs waits for it and newer requests replace it
+	w := &Watcher{sdk: s, annotation: annotation, requests: make(chan string, 1), shutdown: make(chan struct{})}
+
+	if err := s.WatchGameServer(w.update); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// IDs of requested backups
+func (w *Watcher) Requests() <-chan string {
+	return w.requests
+}
+
+// Closed once the GameServer is in the Shutdown state or is being deleted, e.g. when its fleet is scaled down
+func (w *Watcher) Shutdown() <-chan struct{} {
+	return w.shutdown
+}
+
+// Records the start of the requested backup on the GameServer
+func (w *Watcher) Started(id string) error {
+	if err := w.sdk.SetAnnotation(LastBackupRequest, id); err != nil {
+		return err
+	}
+
+	return w.sdk.SetAnnotation(LastBackupStatus, StatusRunning)
+}
+
+// Records the result of the requested backup on the GameServer
+func (w *Watcher) Finished(name string, backupErr error) error {
+	status := StatusSucceeded
+	if backupErr != nil {
+		status = StatusFailed + ": " + backupErr.Error()
+	} else if err := w.sdk.SetAnnotation(LastBackup, name); err != nil {
+		return err
+	}
+
+	return w.sdk.SetAnnotation(LastBackupStatus, status)
+}
+
+func (w *Watcher) update(gs *sdkpb.GameServer) {
+	if gs.GetStatus().GetState() == ShutdownState || gs.GetObjectMeta().GetDeletionTimestamp() != 0 {
+		w.shutOnce.Do(func() { close(w.shutdown) })
+	}
+
+	annotations := gs.GetObjectMeta().GetAnnotations()
+
+	id := annotations[w.annotation]
+	if id == "" {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if id == w.last || id == annotations[SDKPrefix+LastBackupRequest] {
+		return
+	}
+
+	w.last = id
+
+	// replaces a pending request that was not picked up yet
+	select {
+	case <-w.requests:
+	default:
+	}
+
+	w.requests <- id
+}
@@ -0,0 +1,160 @@
+package world
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/saulmaldonado/agones-mc/internal/config"
+)
+
+const (
+	// Region files start with a table of 1024 chunk locations followed by 1024 chunk timestamps
+	regionSectorSize = 4096
+	regionHeaderSize = 2 * regionSectorSize
+	regionChunks     = 1024
+
+	// Extension of Anvil region files in Java Edition region, entities and poi directories
+	regionExt = ".mca"
+
+	// File Bedrock Edition's LevelDB database cannot be opened without
+	bedrockDBCurrent = "db/CURRENT"
+)
+
+// Error returned by Verifier for worlds that fail sanity checks
+type InvalidWorldError struct {
+	File string
+	Err  error
+}
+
+func (e *InvalidWorldError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("invalid world: %s", e.Err)
+	}
+	return fmt.Sprintf("invalid world file %q: %s", e.File, e.Err)
+}
+
+func (e *InvalidWorldError) Unwrap() error {
+	return e.Err
+}
+
+// Runs basic sanity checks on the files of a world as they are read from a directory or archive
+type Verifier struct {
+	edition config.Edition
+	level   *Level
+	regions int
+	db      bool
+}
+
+func NewVerifier(edition config.Edition) *Verifier {
+	return &Verifier{edition: edition}
+}
+
+// Checks a file of the world. name is slash separated and relative to the world root.
+// level.dat must be parseable and region files must have valid headers. Other files are skipped
+func (v *Verifier) File(name string, r io.Reader) error {
+	var err error
+
+	switch {
+	case name == LevelDat:
+		v.level, err = ParseLevel(r, v.edition)
+	case name == bedrockDBCurrent:
+		v.db = true
+	case v.edition != config.BedrockEdition && path.Ext(name) == regionExt:
+		v.regions++
+		err = CheckRegion(r)
+	}
+
+	if err != nil {
+		return &InvalidWorldError{name, err}
+	}
+
+	return nil
+}
+
+// Checks every file of the world in dir
+func (v *Verifier) Dir(dir string) error {
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		return v.File(filepath.ToSlash(rel), f)
+	})
+}
+
+// Returns the parsed level.dat once every file has been checked, or an error if required files are missing
+func (v *Verifier) Done() (*Level, error) {
+	if v.level == nil {
+		return nil, &InvalidWorldError{Err: errors.New("level.dat is missing")}
+	}
+
+	if v.edition == config.BedrockEdition && !v.db {
+		return nil, &InvalidWorldError{Err: errors.New("db/CURRENT is missing")}
+	}
+
+	return v.level, nil
+}
+
+// Number of region files checked
+func (v *Verifier) Regions() int {
+	return v.regions
+}
+
+// Checks the header of an Anvil region file. Every chunk location must point past the header
+// and inside the file. Empty region files are valid
+func CheckRegion(r io.Reader) error {
+	header := make([]byte, regionHeaderSize)
+
+	n, err := io.ReadFull(r, header)
+	if err == io.EOF {
+		return nil
+	}
+
+	if err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("region header truncated at %d bytes", n)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	rest, err := io.Copy(ioutil.Discard, r)
+	if err != nil {
+		return err
+	}
+
+	sectors := (int64(regionHeaderSize) + rest + regionSectorSize - 1) / regionSectorSize
+
+	for i := 0; i < regionChunks; i++ {
+		location := binary.BigEndian.Uint32(header[i*4:])
+		offset, count := int64(location>>8), int64(location&0xff)
+
+		if location == 0 {
+			continue
+		}
+
+		if offset < regionHeaderSize/regionSectorSize || count == 0 || offset+count > sectors {
+			return fmt.Errorf("chunk %d has invalid location: sector %d, count %d, file has %d sectors", i, offset, count, sectors)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package world
+
+import (
+	"fmt"
+
+	"github.com/saulmaldonado/agones-mc/internal/config"
+)
+
+// Presets of the files to back up
+const (
+	// The server's worlds
+	WorldOnly = "world-only"
+	// The server's data directory without logs, caches and files the server image provides
+	FullServer = "full-server"
+	// The server's configuration files, permissions and data packs
+	ConfigsOnly = "configs-only"
+	// No preset. Only BACKUP_INCLUDE is backed up
+	NoPreset = "none"
+)
+
+// Files agones-mc itself writes to the volume while loading and backing up worlds
+var tempFiles = []string{".bedrock-*", ".stage-*", ".world-*", "**/.tmp-*", "**/*.tmp-*", ".agones-mc-backup"}
+
+var javaConfigs = []string{
+	ServerProperties,
+	"*.json",
+	"*.yml",
+	"*.yaml",
+	"*.toml",
+	"*.txt",
+	"config",
+	"defaultconfigs",
+	"plugins/**/*.yml",
+	"plugins/**/*.yaml",
+	"plugins/**/*.json",
+	"plugins/**/*.toml",
+	"plugins/**/*.conf",
+	"plugins/**/*.properties",
+}
+
+var javaServerFiles = []string{
+	"**/session.lock",
+	"logs",
+	"crash-reports",
+	"cache",
+	"libraries",
+	"versions",
+	"bundler",
+	"*.jar",
+}
+
+var bedrockConfigs = []string{
+	ServerProperties,
+	"permissions.json",
+	"allowlist.json",
+	"whitelist.json",
+	"worlds/*/world_behavior_packs.json",
+	"worlds/*/world_resource_packs.json",
+}
+
+var bedrockServerFiles = []string{
+	"bedrock_server*",
+	"*.so",
+	"*.debug",
+	"release-notes.txt",
+	"bedrock_server_how_to.html",
+	"behavior_packs/vanilla*",
+	"behavior_packs/chemistry*",
+	"resource_packs/vanilla*",
+	"resource_packs/chemistry*",
+	"definitions",
+	"logs",
+}
+
+// Returns the include and exclude globs of the named preset for the edition. level is the server's main world
+// and worlds the paths of all of its world directories relative to the server's data directory
+func Preset(name string, edition config.Edition, level string, worlds []string) (include, exclude []string, err error) {
+	bedrock := edition == config.BedrockEdition
+
+	switch name {
+	case WorldOnly:
+		include = append(include, worlds...)
+		if !bedrock {
+			exclude = append(exclude, "**/session.lock")
+		}
+	case FullServer:
+		include = []string{"**"}
+		if bedrock {
+			exclude = append(exclude, bedrockServerFiles...)
+		} else {
+			exclude = append(exclude, javaServerFiles...)
+		}
+	case ConfigsOnly:
+		if bedrock {
+			include = append(include, bedrockConfigs...)
+		} else {
+			include = append(append(include, javaConfigs...), level+"/datapacks")
+		}
+	case NoPreset, "":
+	default:
+		return nil, nil, fmt.Errorf("unknown backup preset %q", name)
+	}
+
+	return include, append(exclude, tempFiles...), nil
+}
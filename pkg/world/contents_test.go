@@ -0,0 +1,133 @@
+package world
+
+import (
+	"testing"
+
+	"github.com/saulmaldonado/agones-mc/internal/config"
+	"github.com/saulmaldonado/agones-mc/pkg/backup"
+)
+
+func TestPreset(t *testing.T) {
+	javaWorlds := []string{"survival", "survival_nether", "survival_the_end"}
+	bedrockWorlds := []string{"worlds/Bedrock level"}
+
+	tests := []struct {
+		preset  string
+		edition config.Edition
+		// paths of files and whether the preset backs them up
+		files map[string]bool
+	}{
+		{WorldOnly, config.JavaEdition, map[string]bool{
+			"survival/level.dat":              true,
+			"survival/region/r.0.0.mca":       true,
+			"survival_nether/DIM-1/r.0.0.mca": true,
+			"survival_the_end/level.dat":      true,
+			"survival/session.lock":           false,
+			"survival/region/.tmp-r.0.0.mca":  false,
+			"server.properties":               false,
+			"world/level.dat":                 false,
+			"logs/latest.log":                 false,
+		}},
+		{WorldOnly, config.BedrockEdition, map[string]bool{
+			"worlds/Bedrock level/level.dat":  true,
+			"worlds/Bedrock level/db/CURRENT": true,
+			"worlds/Other level/level.dat":    false,
+			"server.properties":               false,
+			".bedrock-123/db/CURRENT":         false,
+		}},
+		{FullServer, config.JavaEdition, map[string]bool{
+			"survival/level.dat":            true,
+			"server.properties":             true,
+			"ops.json":                      true,
+			"plugins/dynmap/config.yml":     true,
+			"plugins/dynmap.jar":            true,
+			"mods/jei.jar":                  true,
+			"survival/session.lock":         false,
+			"logs/latest.log":               false,
+			"crash-reports/crash.txt":       false,
+			"cache/mojang_1.17.jar":         false,
+			"libraries/com/google/gson.jar": false,
+			"versions/1.17/server.jar":      false,
+			"server.jar":                    false,
+			".stage-123/0/level.dat":        false,
+			".world-123/level.dat":          false,
+			".agones-mc-backup":             false,
+		}},
+		{FullServer, config.BedrockEdition, map[string]bool{
+			"worlds/Bedrock level/level.dat":        true,
+			"server.properties":                     true,
+			"permissions.json":                      true,
+			"behavior_packs/custom/manifest.json":   true,
+			"bedrock_server":                        false,
+			"bedrock_server_symbols.debug":          false,
+			"libCrypto.so":                          false,
+			"behavior_packs/vanilla_1.17/pack.json": false,
+			"resource_packs/chemistry/pack.json":    false,
+			"definitions/attachables/bow.json":      false,
+			"release-notes.txt":                     false,
+			".bedrock-123/db/CURRENT":               false,
+		}},
+		{ConfigsOnly, config.JavaEdition, map[string]bool{
+			"server.properties":              true,
+			"ops.json":                       true,
+			"bukkit.yml":                     true,
+			"config/jei.toml":                true,
+			"defaultconfigs/forge.toml":      true,
+			"plugins/dynmap/config.yml":      true,
+			"plugins/LuckPerms/db.conf":      true,
+			"survival/datapacks/pack.zip":    true,
+			"plugins/dynmap.jar":             false,
+			"plugins/dynmap/web/tiles/0.png": false,
+			"survival/level.dat":             false,
+			"survival_nether/datapacks/a":    false,
+			"logs/latest.log":                false,
+		}},
+		{ConfigsOnly, config.BedrockEdition, map[string]bool{
+			"server.properties": true,
+			"permissions.json":  true,
+			"allowlist.json":    true,
+			"worlds/Bedrock level/world_behavior_packs.json": true,
+			"worlds/Bedrock level/level.dat":                 false,
+			"valid_known_packs.json":                         false,
+		}},
+		{NoPreset, config.JavaEdition, map[string]bool{
+			"survival/level.dat": false,
+			"server.properties":  false,
+		}},
+	}
+
+	for _, tt := range tests {
+		worlds := javaWorlds
+		if tt.edition == config.BedrockEdition {
+			worlds = bedrockWorlds
+		}
+
+		include, exclude, err := Preset(tt.preset, tt.edition, worlds[0], worlds)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tt.edition, tt.preset, err)
+		}
+
+		contents := &backup.Contents{Preset: tt.preset, Include: include, Exclude: exclude}
+		if err := contents.Validate(); err != nil {
+			t.Fatalf("%s %s: %v", tt.edition, tt.preset, err)
+		}
+
+		for file, want := range tt.files {
+			if got := contents.Select(file, false) == backup.Include; got != want {
+				t.Errorf("%s %s backs up %s: %v, want %v", tt.edition, tt.preset, file, got, want)
+			}
+		}
+	}
+}
+
+func TestPresetUnknown(t *testing.T) {
+	if _, _, err := Preset("everything", config.JavaEdition, "world", []string{"world"}); err == nil {
+		t.Fatal("Preset of an unknown preset succeeded")
+	}
+
+	// the temp files are excluded even without a preset
+	_, exclude, err := Preset("", config.JavaEdition, "world", []string{"world"})
+	if err != nil || len(exclude) != len(tempFiles) {
+		t.Fatalf("Preset without a preset excludes %v, %v", exclude, err)
+	}
+}
@@ -0,0 +1,114 @@
+package world
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/saulmaldonado/agones-mc/internal/config"
+)
+
+// Name of the world metadata file at the root of a world directory
+const LevelDat = "level.dat"
+
+// World metadata read from level.dat
+type Level struct {
+	// Name of the world
+	Name string
+	// Java Edition world format version (Data.DataVersion)
+	DataVersion int32
+	// Java Edition name of the version the world was last played with
+	VersionName string
+	// Bedrock Edition world format version from the level.dat header
+	StorageVersion int32
+}
+
+// Reads the level.dat of the world in worldPath
+func ReadLevel(worldPath string, edition config.Edition) (*Level, error) {
+	f, err := os.Open(filepath.Join(worldPath, LevelDat))
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return ParseLevel(f, edition)
+}
+
+// Parses level.dat data. Java Edition level.dat is gzipped big endian NBT,
+// Bedrock Edition level.dat is little endian NBT with an 8 byte header of storage version and length
+func ParseLevel(r io.Reader, edition config.Edition) (*Level, error) {
+	if edition == config.BedrockEdition {
+		return readBedrockLevel(bufio.NewReader(r))
+	}
+
+	return readJavaLevel(r)
+}
+
+func readJavaLevel(r io.Reader) (*Level, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid level.dat: %w", err)
+	}
+
+	defer gz.Close()
+
+	d := &nbtDecoder{bufio.NewReader(gz), binary.BigEndian}
+
+	_, root, err := d.decodeRoot()
+	if err != nil {
+		return nil, fmt.Errorf("invalid level.dat: %w", err)
+	}
+
+	data, ok := root.(map[string]interface{})["Data"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid level.dat: missing Data compound")
+	}
+
+	level := &Level{}
+	level.Name, _ = data["LevelName"].(string)
+	level.DataVersion, _ = data["DataVersion"].(int32)
+
+	if version, ok := data["Version"].(map[string]interface{}); ok {
+		level.VersionName, _ = version["Name"].(string)
+	}
+
+	return level, nil
+}
+
+func readBedrockLevel(r io.Reader) (*Level, error) {
+	var header struct {
+		StorageVersion int32
+		Length         int32
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("invalid level.dat header: %w", err)
+	}
+
+	if header.Length < 0 || header.Length > maxNBTArrayLen {
+		return nil, fmt.Errorf("invalid level.dat length %d", header.Length)
+	}
+
+	body := make([]byte, header.Length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("invalid level.dat: %w", err)
+	}
+
+	d := &nbtDecoder{bytes.NewReader(body), binary.LittleEndian}
+
+	_, root, err := d.decodeRoot()
+	if err != nil {
+		return nil, fmt.Errorf("invalid level.dat: %w", err)
+	}
+
+	level := &Level{StorageVersion: header.StorageVersion}
+	level.Name, _ = root.(map[string]interface{})["LevelName"].(string)
+
+	return level, nil
+}
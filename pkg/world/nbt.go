@@ -0,0 +1,187 @@
+package world
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// NBT tag types
+const (
+	tagEnd byte = iota
+	tagByte
+	tagShort
+	tagInt
+	tagLong
+	tagFloat
+	tagDouble
+	tagByteArray
+	tagString
+	tagList
+	tagCompound
+	tagIntArray
+	tagLongArray
+)
+
+const (
+	// Limits guarding against corrupt data allocating huge arrays or recursing forever
+	maxNBTArrayLen = 1 << 24
+	maxNBTDepth    = 512
+)
+
+var errNBTTooDeep = errors.New("nbt: nesting too deep")
+
+// Minimal NBT decoder. Java Edition uses big endian NBT and Bedrock Edition little endian NBT.
+// Compounds are decoded as map[string]interface{} and lists as []interface{}
+type nbtDecoder struct {
+	r     io.Reader
+	order binary.ByteOrder
+}
+
+// Decodes the root named tag. Returns its name and value
+func (d *nbtDecoder) decodeRoot() (string, interface{}, error) {
+	tag, err := d.readByte()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if tag != tagCompound {
+		return "", nil, fmt.Errorf("nbt: root tag is %d, expected compound", tag)
+	}
+
+	name, err := d.readString()
+	if err != nil {
+		return "", nil, err
+	}
+
+	value, err := d.decode(tag, 0)
+	return name, value, err
+}
+
+func (d *nbtDecoder) decode(tag byte, depth int) (interface{}, error) {
+	if depth > maxNBTDepth {
+		return nil, errNBTTooDeep
+	}
+
+	switch tag {
+	case tagByte:
+		b, err := d.readByte()
+		return int8(b), err
+	case tagShort:
+		var v int16
+		err := binary.Read(d.r, d.order, &v)
+		return v, err
+	case tagInt:
+		var v int32
+		err := binary.Read(d.r, d.order, &v)
+		return v, err
+	case tagLong:
+		var v int64
+		err := binary.Read(d.r, d.order, &v)
+		return v, err
+	case tagFloat:
+		var v uint32
+		err := binary.Read(d.r, d.order, &v)
+		return math.Float32frombits(v), err
+	case tagDouble:
+		var v uint64
+		err := binary.Read(d.r, d.order, &v)
+		return math.Float64frombits(v), err
+	case tagByteArray:
+		n, err := d.readLen()
+		if err != nil {
+			return nil, err
+		}
+		v := make([]byte, n)
+		_, err = io.ReadFull(d.r, v)
+		return v, err
+	case tagString:
+		return d.readString()
+	case tagList:
+		elem, err := d.readByte()
+		if err != nil {
+			return nil, err
+		}
+		n, err := d.readLen()
+		if err != nil {
+			return nil, err
+		}
+		var list []interface{}
+		for i := 0; i < n; i++ {
+			v, err := d.decode(elem, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case tagCompound:
+		compound := make(map[string]interface{})
+		for {
+			child, err := d.readByte()
+			if err != nil {
+				return nil, err
+			}
+			if child == tagEnd {
+				return compound, nil
+			}
+			name, err := d.readString()
+			if err != nil {
+				return nil, err
+			}
+			if compound[name], err = d.decode(child, depth+1); err != nil {
+				return nil, err
+			}
+		}
+	case tagIntArray:
+		n, err := d.readLen()
+		if err != nil {
+			return nil, err
+		}
+		v := make([]int32, n)
+		err = binary.Read(d.r, d.order, v)
+		return v, err
+	case tagLongArray:
+		n, err := d.readLen()
+		if err != nil {
+			return nil, err
+		}
+		v := make([]int64, n)
+		err = binary.Read(d.r, d.order, v)
+		return v, err
+	default:
+		return nil, fmt.Errorf("nbt: unknown tag type %d", tag)
+	}
+}
+
+func (d *nbtDecoder) readByte() (byte, error) {
+	var b [1]byte
+	_, err := io.ReadFull(d.r, b[:])
+	return b[0], err
+}
+
+func (d *nbtDecoder) readLen() (int, error) {
+	var n int32
+	if err := binary.Read(d.r, d.order, &n); err != nil {
+		return 0, err
+	}
+
+	if n < 0 || n > maxNBTArrayLen {
+		return 0, fmt.Errorf("nbt: invalid length %d", n)
+	}
+
+	return int(n), nil
+}
+
+func (d *nbtDecoder) readString() (string, error) {
+	var n uint16
+	if err := binary.Read(d.r, d.order, &n); err != nil {
+		return "", err
+	}
+
+	b := make([]byte, n)
+	_, err := io.ReadFull(d.r, b)
+	return string(b), err
+}
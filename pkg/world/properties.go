@@ -0,0 +1,125 @@
+package world
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/saulmaldonado/agones-mc/internal/config"
+)
+
+const (
+	// Server configuration file at the root of the server's data directory
+	ServerProperties = "server.properties"
+
+	// Default world directory names when server.properties sets no level-name
+	DefaultJavaLevel    = "world"
+	DefaultBedrockLevel = "Bedrock level"
+
+	// Directories Bukkit, Spigot and Paper servers store the nether and the end in, next to the main world
+	netherSuffix = "_nether"
+	endSuffix    = "_the_end"
+)
+
+// Reads the key=value pairs of a properties file. Comments and blank lines are skipped
+func ReadProperties(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	props := make(map[string]string)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+
+		i := strings.IndexAny(line, "=:")
+		if i < 0 {
+			props[line] = ""
+			continue
+		}
+
+		props[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+	}
+
+	return props, scanner.Err()
+}
+
+// Returns the directory the edition's worlds are stored in. Java Edition worlds are stored at the root
+// of the server's data directory and Bedrock Edition worlds in its worlds directory
+func Dir(volume string, edition config.Edition) string {
+	if edition == config.BedrockEdition {
+		return filepath.Join(volume, "worlds")
+	}
+	return volume
+}
+
+// Returns the server's level-name from server.properties in volume. The edition's default world name
+// is returned if server.properties does not exist, e.g. before the server first starts, or sets no level-name
+func LevelName(volume string, edition config.Edition) (string, error) {
+	name := DefaultJavaLevel
+	if edition == config.BedrockEdition {
+		name = DefaultBedrockLevel
+	}
+
+	props, err := ReadProperties(filepath.Join(volume, ServerProperties))
+	if os.IsNotExist(err) {
+		return name, nil
+	}
+
+	if err != nil {
+		return name, err
+	}
+
+	if level := props["level-name"]; level != "" {
+		name = level
+	}
+
+	return name, nil
+}
+
+// Returns the names of the server's world directories in Dir, starting with the main world level.
+// Java Edition servers also have <level>_nether and <level>_the_end on Bukkit, Spigot and Paper.
+// Bedrock Edition servers may have any number of worlds in their worlds directory
+func Worlds(volume string, edition config.Edition, level string) ([]string, error) {
+	worlds := []string{level}
+
+	if edition != config.BedrockEdition {
+		for _, suffix := range []string{netherSuffix, endSuffix} {
+			if info, err := os.Stat(filepath.Join(volume, level+suffix)); err == nil && info.IsDir() {
+				worlds = append(worlds, level+suffix)
+			}
+		}
+
+		return worlds, nil
+	}
+
+	infos, err := ioutil.ReadDir(Dir(volume, edition))
+	if os.IsNotExist(err) {
+		return worlds, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var others []string
+	for _, info := range infos {
+		if info.IsDir() && info.Name() != level && !strings.HasPrefix(info.Name(), ".") {
+			others = append(others, info.Name())
+		}
+	}
+
+	sort.Strings(others)
+
+	return append(worlds, others...), nil
+}